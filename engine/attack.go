@@ -0,0 +1,150 @@
+package engine
+
+// directionTable maps the difference of two 0x88 squares to the step
+// leading from one to the other, or 0 if they are not on a line
+var directionTable [240]int8
+
+func init() {
+	for from := int8(0); from < boardSize; from++ {
+		if uint8(from)&0x88 != 0 {
+			continue
+		}
+		for _, delta := range deltaAll {
+			for to := from + delta; uint8(to)&0x88 == 0; to += delta {
+				directionTable[int(to)-int(from)+119] = delta
+			}
+		}
+	}
+}
+
+// direction returns the step from one square towards another on the same
+// rank, file or diagonal, otherwise 0
+func direction(from, to int8) int8 {
+	return directionTable[int(to)-int(from)+119]
+}
+
+func diagonal(delta int8) bool {
+	return delta == moveUpLeft || delta == moveUpRight || delta == moveDownLeft || delta == moveDownRight
+}
+
+// slides tells whether a piece moves any distance in the given direction
+func slides(piece int8, delta int8) bool {
+	switch abs(piece) {
+	case Queen:
+		return true
+	case Bishop:
+		return diagonal(delta)
+	case Rook:
+		return !diagonal(delta)
+	}
+	return false
+}
+
+func bit(sq int8) Bitboard {
+	return squareBit(sq64(Square(sq)))
+}
+
+// IsSquareAttacked tells whether a piece of the given color attacks a square
+func (b *Board) IsSquareAttacked(sq Square, byColor int8) bool {
+	return b.attackers(int8(sq), byColor, true) != 0
+}
+
+// Attackers returns the squares of all pieces of both colors attacking a
+// square, bit n of the set is the square rank*8+file
+func (b *Board) Attackers(sq Square) Bitboard {
+	return b.attackers(int8(sq), White, false) | b.attackers(int8(sq), Black, false)
+}
+
+// Checkers returns the squares of the pieces giving check to the side to
+// move
+func (b *Board) Checkers() Bitboard {
+	return b.attackers(int8(b.kingSquare(b.sideToMove)), opponent(b.sideToMove), false)
+}
+
+// InCheck tells whether the side to move is in check, never in variants
+// without check
+func (b *Board) InCheck() bool {
+	if b.variant != nil && b.variant.rules().noCheck {
+		return false
+	}
+	return b.IsSquareAttacked(b.kingSquare(b.sideToMove), opponent(b.sideToMove))
+}
+
+// Pinned returns the squares of the pieces of the given color which can't
+// leave the line between their king and an opposing slider
+func (b *Board) Pinned(color int8) Bitboard {
+	king := int8(b.kingSquare(color))
+	pinned := Bitboard(0)
+
+	for _, delta := range deltaAll {
+		candidate := int8(Invalid)
+		for sq := king + delta; uint8(sq)&0x88 == 0; sq += delta {
+			piece := b.data[sq]
+			if piece == Empty {
+				continue
+			}
+			if piece*color > 0 {
+				if candidate != int8(Invalid) {
+					break
+				}
+				candidate = sq
+				continue
+			}
+			if candidate != int8(Invalid) && slides(piece, delta) {
+				pinned |= bit(candidate)
+			}
+			break
+		}
+	}
+
+	return pinned
+}
+
+func (b *Board) kingSquare(color int8) Square {
+	if color == White {
+		return b.whiteKingPosition
+	}
+	return b.blackKingPosition
+}
+
+// attackers collects the pieces of a color attacking a square, with stop
+// set it returns as soon as the first one is found
+func (b *Board) attackers(sq int8, color int8, stop bool) Bitboard {
+	set := Bitboard(0)
+
+	// pawns attack diagonally forward
+	for _, delta := range [2]int8{moveUpLeft, moveUpRight} {
+		from := sq - delta*color
+		if uint8(from)&0x88 == 0 && b.data[from] == Pawn*color {
+			if set |= bit(from); stop {
+				return set
+			}
+		}
+	}
+
+	for _, delta := range deltaKnight {
+		from := sq + delta
+		if uint8(from)&0x88 == 0 && b.data[from] == Knight*color {
+			if set |= bit(from); stop {
+				return set
+			}
+		}
+	}
+
+	for _, delta := range deltaAll {
+		for from := sq + delta; uint8(from)&0x88 == 0; from += delta {
+			piece := b.data[from]
+			if piece == Empty {
+				continue
+			}
+			if piece*color > 0 && (slides(piece, delta) || (piece == King*color && from == sq+delta)) {
+				if set |= bit(from); stop {
+					return set
+				}
+			}
+			break
+		}
+	}
+
+	return set
+}
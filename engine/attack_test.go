@@ -0,0 +1,52 @@
+package engine
+
+import "testing"
+
+func TestAttackers(t *testing.T) {
+	b := NewBoard("4k3/8/8/3n4/8/2P2R2/8/4K3 w - - 0 1")
+
+	expected := bit(int8(D5)) | bit(int8(F3))
+	if attackers := b.Attackers(E3); attackers != expected {
+		t.Errorf("Expected attackers\n%s\nbut got\n%s\n", expected, attackers)
+	}
+
+	if !b.IsSquareAttacked(F4, White) || !b.IsSquareAttacked(F4, Black) {
+		t.Errorf("Expected f4 to be attacked by both colors\n")
+	}
+	if b.IsSquareAttacked(A8, White) {
+		t.Errorf("Expected a8 not to be attacked by white\n")
+	}
+}
+
+func TestCheckers(t *testing.T) {
+	b := NewBoard("4k3/8/3N4/8/8/8/8/4R1K1 b - - 0 1")
+
+	expected := bit(int8(D6)) | bit(int8(E1))
+	if checkers := b.Checkers(); checkers != expected {
+		t.Errorf("Expected checkers\n%s\nbut got\n%s\n", expected, checkers)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	b := NewBoard("4k3/4r3/8/8/1b6/2N5/3PR3/4K3 w - - 0 1")
+
+	// the knight and the pawn on d2 shield each other, the rook is pinned
+	expected := bit(int8(E2))
+	if pinned := b.Pinned(White); pinned != expected {
+		t.Errorf("Expected pinned pieces\n%s\nbut got\n%s\n", expected, pinned)
+	}
+}
+
+func TestAttackQueriesDontAllocate(t *testing.T) {
+	b := NewBoard(position2FEN)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		b.IsSquareAttacked(E4, Black)
+		b.Attackers(E4)
+		b.Checkers()
+		b.Pinned(White)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations but got %f\n", allocs)
+	}
+}
@@ -0,0 +1,35 @@
+package engine
+
+import "testing"
+
+func TestBenchIsDeterministic(t *testing.T) {
+	single := Bench(BenchOptions{Depth: 3, Threads: 1})
+	parallel := Bench(BenchOptions{Depth: 3, Threads: 4})
+
+	if single.Nodes == 0 || single.Nodes != parallel.Nodes {
+		t.Errorf("Expected the same node count but got %d and %d\n", single.Nodes, parallel.Nodes)
+	}
+}
+
+func TestBenchPositions(t *testing.T) {
+	if len(benchPositions) != 50 {
+		t.Errorf("Expected 50 positions but got %d\n", len(benchPositions))
+	}
+
+	for _, fen := range benchPositions {
+		b, err := parseFEN(fen)
+		if err != nil || generateFEN(b) != fen || len(NewGenerator(b).GenerateMoves()) == 0 {
+			t.Errorf("Expected a playable position but got %s\n", fen)
+		}
+	}
+}
+
+func TestBenchHash(t *testing.T) {
+	size := searchHashSize
+	if result := Bench(BenchOptions{Depth: 2, Threads: 2, Hash: 1}); result.Nodes == 0 {
+		t.Errorf("Expected a search with a small table but got no nodes\n")
+	}
+	if searchHashSize != size {
+		t.Errorf("Expected the hash size to stay %d MB but got %d\n", size, searchHashSize)
+	}
+}
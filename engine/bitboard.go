@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"math/bits"
+	"math/rand"
+	"strings"
+)
+
+// Bitboard is a set of squares, bit n is the square rank*8+file
+type Bitboard uint64
+
+const (
+	fileA Bitboard = 0x0101010101010101
+	fileH Bitboard = fileA << 7
+	rank1 Bitboard = 0xff
+	rank8 Bitboard = rank1 << 56
+)
+
+var (
+	knightAttacks [64]Bitboard
+	kingAttacks   [64]Bitboard
+	pawnAttacks   [2][64]Bitboard // by color index
+
+	rookMagics   [64]magic
+	bishopMagics [64]magic
+)
+
+// magic maps the relevant occupancy of a slider's lines to its attacks:
+// the masked occupancy multiplied by the magic number leaves a unique
+// table index in the upper bits
+type magic struct {
+	mask    Bitboard
+	magic   uint64
+	shift   uint
+	attacks []Bitboard
+}
+
+func (m *magic) index(occupied Bitboard) uint64 {
+	return uint64(occupied&m.mask) * m.magic >> m.shift
+}
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		for _, delta := range deltaKnight {
+			knightAttacks[sq] |= stepAttack(sq, delta)
+		}
+		for _, delta := range deltaKing {
+			kingAttacks[sq] |= stepAttack(sq, delta)
+		}
+		pawnAttacks[0][sq] = stepAttack(sq, moveUpLeft) | stepAttack(sq, moveUpRight)
+		pawnAttacks[1][sq] = stepAttack(sq, moveDownLeft) | stepAttack(sq, moveDownRight)
+	}
+
+	// the magics are searched at startup, a fixed seed keeps it fast and
+	// reproducible
+	r := rand.New(rand.NewSource(4711))
+	for sq := 0; sq < 64; sq++ {
+		rookMagics[sq] = findMagic(sq, deltaRook, r)
+		bishopMagics[sq] = findMagic(sq, deltaBishop, r)
+	}
+}
+
+func squareBit(sq int) Bitboard {
+	return Bitboard(1) << uint(sq)
+}
+
+// sq0x88 converts a bitboard square index to the 0x88 representation
+func sq0x88(sq int) Square {
+	return Square(square(int8(sq/8), int8(sq%8)))
+}
+
+func (b Bitboard) count() int {
+	return bits.OnesCount64(uint64(b))
+}
+
+// first returns the index of the lowest square of a non empty set
+func (b Bitboard) first() int {
+	return bits.TrailingZeros64(uint64(b))
+}
+
+// pop removes the lowest square and returns its index
+func (b *Bitboard) pop() int {
+	sq := bits.TrailingZeros64(uint64(*b))
+	*b &= *b - 1
+	return sq
+}
+
+func (b Bitboard) String() string {
+	s := ""
+	for rank := 7; rank >= 0; rank-- {
+		line := []string{}
+		for file := 0; file < 8; file++ {
+			if b&squareBit(rank*8+file) != 0 {
+				line = append(line, "x")
+			} else {
+				line = append(line, ".")
+			}
+		}
+		s += strings.Join(line, " ") + "\n"
+	}
+	return s
+}
+
+// stepAttack returns the target of a single step in 0x88 delta notation,
+// or an empty set if it leaves the board
+func stepAttack(sq int, delta int8) Bitboard {
+	to := int8(sq0x88(sq)) + delta
+	if uint8(to)&0x88 != 0 {
+		return 0
+	}
+	return squareBit(sq64(Square(to)))
+}
+
+// slidingAttack walks the given directions until a blocker is hit
+func slidingAttack(sq int, deltas []int8, occupied Bitboard) Bitboard {
+	attacks := Bitboard(0)
+	for _, delta := range deltas {
+		for to := int8(sq0x88(sq)) + delta; uint8(to)&0x88 == 0; to += delta {
+			bit := squareBit(sq64(Square(to)))
+			attacks |= bit
+			if occupied&bit != 0 {
+				break
+			}
+		}
+	}
+	return attacks
+}
+
+// relevantMask contains the squares whose occupancy changes the attacks,
+// i.e. the lines without their last square
+func relevantMask(sq int, deltas []int8) Bitboard {
+	mask := Bitboard(0)
+	for _, delta := range deltas {
+		for to := int8(sq0x88(sq)) + delta; uint8(to+delta)&0x88 == 0; to += delta {
+			mask |= squareBit(sq64(Square(to)))
+		}
+	}
+	return mask
+}
+
+func findMagic(sq int, deltas []int8, r *rand.Rand) magic {
+	mask := relevantMask(sq, deltas)
+	n := mask.count()
+
+	// enumerate all subsets of the mask (carry rippler)
+	occupancies := make([]Bitboard, 0, 1<<uint(n))
+	attacks := make([]Bitboard, 0, 1<<uint(n))
+	for occ := Bitboard(0); ; {
+		occupancies = append(occupancies, occ)
+		attacks = append(attacks, slidingAttack(sq, deltas, occ))
+		occ = (occ - mask) & mask
+		if occ == 0 {
+			break
+		}
+	}
+
+	m := magic{mask: mask, shift: uint(64 - n), attacks: make([]Bitboard, 1<<uint(n))}
+	used := make([]bool, len(m.attacks))
+
+	for {
+		m.magic = r.Uint64() & r.Uint64() & r.Uint64()
+		if (uint64(mask)*m.magic)>>56 == 0 {
+			continue
+		}
+
+		for i := range used {
+			used[i] = false
+		}
+
+		ok := true
+		for i, occ := range occupancies {
+			index := m.index(occ)
+			if used[index] && m.attacks[index] != attacks[i] {
+				ok = false
+				break
+			}
+			used[index] = true
+			m.attacks[index] = attacks[i]
+		}
+
+		if ok {
+			return m
+		}
+	}
+}
+
+func rookAttacks(sq int, occupied Bitboard) Bitboard {
+	m := &rookMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func bishopAttacks(sq int, occupied Bitboard) Bitboard {
+	m := &bishopMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func queenAttacks(sq int, occupied Bitboard) Bitboard {
+	return rookAttacks(sq, occupied) | bishopAttacks(sq, occupied)
+}
@@ -20,6 +20,9 @@ type HistoryItem struct {
 	blackCastle   int8
 	enPassant     Square
 	halfMoveClock int
+	checks        [2]int8
+	pockets       [2][pocketPieces]int8
+	promoted      Bitboard
 	hash          int64
 }
 
@@ -36,9 +39,15 @@ type Board struct {
 	blackCastle       int8
 	whiteKingPosition Square
 	blackKingPosition Square
+	castling          *castlingSetup
+	variant           Variant
+	checks            [2]int8               // checks given by color index, counted in Three-check
+	pockets           [2][pocketPieces]int8 // pieces in hand by color index and piece-1 in Crazyhouse
+	promoted          Bitboard              // the promoted pieces in Crazyhouse
 	status            int
 	zobristTable      *ZobristTable
 	currentHash       int64
+	nnue              *nnueState
 }
 
 // NewBoard creates a new chessboard from given fen
@@ -49,9 +58,6 @@ func NewBoard(fen string) *Board {
 		fmt.Printf("invalid FEN: \"%s\"\n", fen)
 	}
 
-	b.zobristTable = NewZobristTable()
-	b.currentHash = b.generateHash()
-
 	return b
 }
 
@@ -60,6 +66,17 @@ func (b *Board) legalSquare(square int8) bool {
 	return !(uint8(square)&0x88 != 0)
 }
 
+// Clone returns an independent copy of the board, e.g. for a search or
+// another goroutine. The history has room for the moves of a search, so
+// making them doesn't allocate, the accumulators of the network are
+// created on first use.
+func (b *Board) Clone() *Board {
+	c := *b
+	c.history = append(make([]HistoryItem, 0, len(b.history)+2*searchMaxPly), b.history...)
+	c.nnue = nil
+	return &c
+}
+
 // MakeMove does a move on the board
 func (b *Board) MakeMove(m Move) {
 
@@ -69,8 +86,16 @@ func (b *Board) MakeMove(m Move) {
 		blackCastle:   b.blackCastle,
 		enPassant:     b.enPassant,
 		halfMoveClock: b.halfMoveClock,
+		checks:        b.checks,
+		pockets:       b.pockets,
+		promoted:      b.promoted,
+		hash:          b.currentHash,
 	}
 
+	// castling rights, en passant and side to move are hashed again at the
+	// end, pieces are hashed by put
+	b.currentHash ^= b.stateHash()
+
 	b.halfMoveClock++
 	b.enPassant = Invalid
 
@@ -78,10 +103,18 @@ func (b *Board) MakeMove(m Move) {
 		b.fullMoves++
 	}
 
+	if b.nnue != nil {
+		b.nnue.push()
+	}
+
+	if b.variant != nil && b.variant.rules().drops {
+		b.updatePockets(m)
+	}
+
 	switch m.Special {
 	case moveOrdinary:
-		b.data[m.From] = Empty
-		b.data[m.To] = m.MovedPiece
+		b.put(int8(m.From), Empty)
+		b.put(int8(m.To), m.MovedPiece)
 
 		if m.Content != Empty {
 			b.halfMoveClock = 0
@@ -90,26 +123,8 @@ func (b *Board) MakeMove(m Move) {
 		switch m.MovedPiece {
 		case WhiteKing:
 			b.whiteKingPosition = m.To
-			if m.From == whiteKingStartSquare {
-				b.whiteCastle = castleNone
-			}
 		case BlackKing:
 			b.blackKingPosition = m.To
-			if m.From == blackKingStartSquare {
-				b.blackCastle = castleNone
-			}
-		case WhiteRook:
-			if m.From == whiteRookShortSquare {
-				b.whiteCastle &= ^castleShort
-			} else if m.From == whiteRookLongSquare {
-				b.whiteCastle &= ^castleLong
-			}
-		case BlackRook:
-			if m.From == blackRookShortSquare {
-				b.blackCastle &= ^castleShort
-			} else if m.From == whiteRookLongSquare {
-				b.blackCastle &= ^castleLong
-			}
 		case WhitePawn:
 			b.halfMoveClock = 0
 			steps := rank(int8(m.To)) - rank(int8(m.From))
@@ -126,54 +141,49 @@ func (b *Board) MakeMove(m Move) {
 			}
 		}
 
-	case moveCastelingShort:
-		// king
-		b.data[m.To] = m.MovedPiece
-		b.data[m.From] = Empty
-		// rook
-		rookPos := int8(m.From) + castleShortDistanceRook*nextFile
-		b.data[int8(m.From)+nextFile] = b.data[rookPos]
-		b.data[rookPos] = Empty
+	case moveCastelingShort, moveCastelingLong:
+		// in Chess960 the king or the rook may stay or end on the other's square
+		king, kingTo, rook, rookTo := b.castling.squares(pieceColor(m.MovedPiece), castlingDir(m))
+		b.put(king, Empty)
+		b.put(rook, Empty)
+		b.put(kingTo, m.MovedPiece)
+		b.put(rookTo, Rook*pieceColor(m.MovedPiece))
 		if m.MovedPiece == WhiteKing {
 			b.whiteCastle = castleNone
-			b.whiteKingPosition = m.To
+			b.whiteKingPosition = Square(kingTo)
 		} else {
 			b.blackCastle = castleNone
-			b.blackKingPosition = m.To
-		}
-	case moveCastelingLong:
-		// king
-		b.data[m.To] = m.MovedPiece
-		b.data[m.From] = Empty
-		// rook
-		rookPos := int8(m.From) - castleLongDistanceRook*nextFile
-		b.data[int8(m.From)-nextFile] = b.data[rookPos]
-		b.data[rookPos] = Empty
-		if m.MovedPiece == WhiteKing {
-			b.whiteCastle = castleNone
-			b.whiteKingPosition = m.To
-		} else {
-			b.blackCastle = castleNone
-			b.blackKingPosition = m.To
+			b.blackKingPosition = Square(kingTo)
 		}
 	case movePromotion:
-		b.data[m.From] = Empty
-		b.data[m.To] = m.Promoted
+		b.put(int8(m.From), Empty)
+		b.put(int8(m.To), m.Promoted)
 		b.halfMoveClock = 0
 	case moveEnPassant:
-		b.data[m.From] = Empty
-		b.data[m.To] = m.MovedPiece
-		b.data[int8(m.To)-m.MovedPiece*nextRank] = Empty
+		b.put(int8(m.From), Empty)
+		b.put(int8(m.To), m.MovedPiece)
+		b.put(int8(m.To)-m.MovedPiece*nextRank, Empty)
 		b.halfMoveClock = 0
+	case moveDrop:
+		b.put(int8(m.To), m.MovedPiece)
 	}
 
+	// moving the king or a rook and capturing a rook loses castling rights
+	mask := &b.castling.mask
+	b.whiteCastle &= mask[sq64(m.From)][0] & mask[sq64(m.To)][0]
+	b.blackCastle &= mask[sq64(m.From)][1] & mask[sq64(m.To)][1]
+
 	b.sideToMove = opponent(b.sideToMove)
 	b.ply++
 
-	historyItem.hash = b.currentHash
-	b.history = append(b.history, historyItem)
+	if b.variant != nil && b.variant.rules().countChecks && b.InCheck() {
+		if i := colorIndex(opponent(b.sideToMove)); b.checks[i] < threeCheckWin {
+			b.checks[i]++
+		}
+	}
 
-	b.updateHash(m)
+	b.currentHash ^= b.stateHash()
+	b.history = append(b.history, historyItem)
 }
 
 // UndoMove undoes the last move on the board
@@ -184,6 +194,12 @@ func (b *Board) UndoMove() {
 	}
 
 	historyItem := b.history[len(b.history)-1]
+
+	if historyItem.move.Special == moveNull {
+		b.UndoNullMove()
+		return
+	}
+
 	b.history = b.history[0 : len(b.history)-1]
 
 	// update previous flags
@@ -191,12 +207,13 @@ func (b *Board) UndoMove() {
 	b.blackCastle = historyItem.blackCastle
 	b.enPassant = historyItem.enPassant
 	b.halfMoveClock = historyItem.halfMoveClock
+	b.checks = historyItem.checks
+	b.pockets = historyItem.pockets
+	b.promoted = historyItem.promoted
+	b.currentHash = historyItem.hash
 
 	m := historyItem.move
 
-	// XXX: might to be done at the end?
-	b.updateHash(m)
-
 	switch {
 	case m.Special == moveOrdinary || m.Special == movePromotion:
 		b.data[m.To] = m.Content
@@ -207,22 +224,12 @@ func (b *Board) UndoMove() {
 		case BlackKing:
 			b.blackKingPosition = m.From
 		}
-	case m.Special == moveCastelingShort:
-		b.data[m.From] = m.MovedPiece
-		b.data[int8(m.From)+castleShortDistanceRook*nextFile] = b.data[int8(m.From)+nextFile]
-		b.data[m.To] = Empty
-		b.data[int8(m.From)+nextFile] = Empty
-		switch m.MovedPiece {
-		case WhiteKing:
-			b.whiteKingPosition = m.From
-		case BlackKing:
-			b.blackKingPosition = m.From
-		}
-	case m.Special == moveCastelingLong:
-		b.data[m.From] = m.MovedPiece
-		b.data[int8(m.From)-castleLongDistanceRook*nextFile] = b.data[int8(m.From)-nextFile]
-		b.data[m.To] = Empty
-		b.data[int8(m.From)-nextFile] = Empty
+	case m.Special == moveCastelingShort || m.Special == moveCastelingLong:
+		king, kingTo, rook, rookTo := b.castling.squares(pieceColor(m.MovedPiece), castlingDir(m))
+		b.data[kingTo] = Empty
+		b.data[rookTo] = Empty
+		b.data[rook] = Rook * pieceColor(m.MovedPiece)
+		b.data[king] = m.MovedPiece
 		switch m.MovedPiece {
 		case WhiteKing:
 			b.whiteKingPosition = m.From
@@ -233,17 +240,80 @@ func (b *Board) UndoMove() {
 		b.data[m.From] = m.MovedPiece
 		b.data[m.To] = Empty
 		b.data[int8(m.To)-m.MovedPiece*nextRank] = m.Content
+	case m.Special == moveDrop:
+		b.data[m.To] = Empty
 	}
 
 	b.sideToMove = opponent(b.sideToMove)
 	b.ply--
 
+	if b.nnue != nil {
+		b.nnue.pop(b)
+	}
+
 	if b.sideToMove == Black {
 		b.fullMoves--
 	}
 
 }
 
+// MakeNullMove passes the right to move to the opponent
+func (b *Board) MakeNullMove() {
+	b.history = append(b.history, HistoryItem{
+		move:          Move{From: Invalid, To: Invalid, Special: moveNull},
+		whiteCastle:   b.whiteCastle,
+		blackCastle:   b.blackCastle,
+		enPassant:     b.enPassant,
+		halfMoveClock: b.halfMoveClock,
+		checks:        b.checks,
+		pockets:       b.pockets,
+		promoted:      b.promoted,
+		hash:          b.currentHash,
+	})
+
+	b.currentHash ^= b.stateHash()
+
+	// positions before a null move can not be repeated
+	b.halfMoveClock = 0
+	b.enPassant = Invalid
+
+	if b.sideToMove == Black {
+		b.fullMoves++
+	}
+
+	b.sideToMove = opponent(b.sideToMove)
+	b.ply++
+
+	b.currentHash ^= b.stateHash()
+}
+
+// UndoNullMove undoes a null move
+func (b *Board) UndoNullMove() {
+	historyItem := b.history[len(b.history)-1]
+	b.history = b.history[0 : len(b.history)-1]
+
+	b.enPassant = historyItem.enPassant
+	b.halfMoveClock = historyItem.halfMoveClock
+	b.currentHash = historyItem.hash
+
+	b.sideToMove = opponent(b.sideToMove)
+	b.ply--
+
+	if b.sideToMove == Black {
+		b.fullMoves--
+	}
+}
+
+// put places a piece (or Empty) on a square and keeps the network
+// accumulators up to date
+func (b *Board) put(square int8, piece int8) {
+	if b.nnue != nil {
+		b.nnue.update(square, b.data[square], piece)
+	}
+	b.currentHash ^= b.pieceHash(square, b.data[square]) ^ b.pieceHash(square, piece)
+	b.data[square] = piece
+}
+
 func (b *Board) isEmpty(squares ...Square) bool {
 	for _, s := range squares {
 		if b.data[uint8(s)] != Empty {
@@ -266,60 +336,138 @@ func (b *Board) repetitions() int {
 	return r
 }
 
-func (b *Board) updateHash(m Move) {
-	key := b.currentHash
-	color := 0
-	if b.sideToMove == Black {
-		color = 1
+// updateStatus determines whether the game on the board is over
+func (b *Board) updateStatus() int {
+	gen := NewGenerator(b)
+	moves := gen.GenerateMoves()
+
+	if b.variant != nil && len(moves) == 0 {
+		b.status = b.variant.result(b, gen.kingUnderCheck)
+		return b.status
+	}
+
+	switch {
+	case len(moves) == 0 && gen.kingUnderCheck && b.sideToMove == White:
+		b.status = statusBlackMates
+	case len(moves) == 0 && gen.kingUnderCheck:
+		b.status = statusWhiteMates
+	case len(moves) == 0:
+		b.status = statusStaleMate
+	// the variants have other ways to win with little material
+	case b.halfMoveClock >= 100 || b.repetitions() >= 2 || b.variant == nil && b.insufficientMaterial():
+		b.status = statusDraw
+	case gen.kingUnderCheck:
+		b.status = statusCheck
+	default:
+		b.status = statusNormal
 	}
-	piece := abs(m.MovedPiece) - 1
 
-	key ^= b.zobristTable.hashPieces[piece][color][int8(m.From)]
-	key ^= b.zobristTable.hashPieces[piece][color][int8(m.To)]
+	return b.status
+}
+
+// gameOver tells whether the last updateStatus found the game to be over
+func (b *Board) gameOver() bool {
+	return b.status != statusNormal && b.status != statusCheck
+}
 
-	if m.Content != Empty {
-		key ^= b.zobristTable.hashPieces[abs(m.Content)-1][color][int8(m.To)]
+// onlyPawns is true if a side has no pieces besides pawns and king
+func (b *Board) onlyPawns(color int8) bool {
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			piece := b.data[square(rank, file)] * color
+			if piece > Pawn && piece < King {
+				return false
+			}
+		}
 	}
+	return true
+}
 
-	switch m.Special {
-	case moveCastelingLong:
-		if color == 0 {
-			key ^= b.zobristTable.hashCastelingWhite[castleLong]
-		} else {
-			key ^= b.zobristTable.hashCastelingBlack[castleLong]
+// passedPawn is true if no opposing pawn can stop a pawn of the given
+// color on its square
+func (b *Board) passedPawn(sq int8, pawn int8) bool {
+	for f := file(sq) - 1; f <= file(sq)+1; f++ {
+		if f < 0 || f >= size {
+			continue
 		}
-	case moveCastelingShort:
-		if color == 0 {
-			key ^= b.zobristTable.hashCastelingWhite[castleShort]
-		} else {
-			key ^= b.zobristTable.hashCastelingBlack[castleLong]
+		for r := rank(sq) + pawn; r >= 0 && r < size; r += pawn {
+			if b.data[square(r, f)] == -pawn {
+				return false
+			}
 		}
-	case moveEnPassant:
-		key ^= b.zobristTable.hashEnPassant[int8(m.To)-int8(m.MovedPiece)*nextRank]
-	case movePromotion:
-		key ^= b.zobristTable.hashPromotion[abs(m.Promoted)-1]
 	}
+	return true
+}
 
-	b.currentHash = key
+// insufficientMaterial is true if there are only kings and at most a
+// single minor piece left
+func (b *Board) insufficientMaterial() bool {
+	minors := 0
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			switch abs(b.data[square(rank, file)]) {
+			case Empty, King:
+			case Knight, Bishop:
+				minors++
+			default:
+				return false
+			}
+		}
+	}
+	return minors <= 1
 }
 
-func (b *Board) generateHash() int64 {
-	key := int64(0)
+func (b *Board) pieceHash(square int8, piece int8) int64 {
+	switch {
+	case piece > Empty:
+		return b.zobristTable.hashPieces[piece-1][0][square]
+	case piece < Empty:
+		return b.zobristTable.hashPieces[-piece-1][1][square]
+	}
+	return 0
+}
 
-	for square := int8(0); square < boardSize; square++ {
-		piece := b.data[square]
-		if piece > Empty {
-			key ^= b.zobristTable.hashPieces[piece-1][0][square]
-		} else if piece < Empty {
-			key ^= b.zobristTable.hashPieces[-piece-1][1][square]
+// stateHash covers everything but the pieces: castling rights, en passant
+// square, side to move, the checks given in Three-check and the pockets and
+// promoted pieces of Crazyhouse
+func (b *Board) stateHash() int64 {
+	key := b.zobristTable.hashCastelingWhite[b.whiteCastle]
+	key ^= b.zobristTable.hashCastelingBlack[b.blackCastle]
+
+	if b.checks != [2]int8{} {
+		key ^= b.zobristTable.hashChecks[0][b.checks[0]] ^ b.zobristTable.hashChecks[1][b.checks[1]]
+	}
+
+	if b.pockets != [2][pocketPieces]int8{} {
+		for color := range b.pockets {
+			for i, count := range b.pockets[color] {
+				key ^= b.zobristTable.hashPockets[color][i][count]
+			}
 		}
 	}
+	for promoted := b.promoted; promoted != 0; {
+		key ^= b.zobristTable.hashPromoted[promoted.pop()]
+	}
+
+	if b.enPassant != Invalid {
+		key ^= b.zobristTable.hashEnPassant[b.enPassant]
+	}
 
-	key ^= b.zobristTable.hashCastelingWhite[b.whiteCastle]
-	key ^= b.zobristTable.hashCastelingBlack[b.blackCastle]
 	if b.sideToMove == Black {
 		key ^= b.zobristTable.hashSide
 	}
 
 	return key
 }
+
+// generateHash hashes the whole position. The variant never changes during
+// a game, so it is only part of this key and not of stateHash.
+func (b *Board) generateHash() int64 {
+	key := b.stateHash() ^ b.zobristTable.hashVariants[variantIndex(b.variant)]
+
+	for square := int8(0); square < boardSize; square++ {
+		key ^= b.pieceHash(square, b.data[square])
+	}
+
+	return key
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIncrementalHashMatchesGeneratedHash(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+
+	for _, fen := range []string{defaultFEN, position2FEN, "8/8/1k6/2b5/2pP4/8/5K2/8 b - d3 0 1"} {
+		b := NewBoard(fen)
+		hashes := []int64{b.currentHash}
+
+		for ply := 0; ply < 100; ply++ {
+			moves := NewGenerator(b).GenerateMoves()
+			if len(moves) == 0 {
+				break
+			}
+
+			if r.Intn(5) == 0 {
+				b.MakeNullMove()
+			} else {
+				b.MakeMove(moves[r.Intn(len(moves))])
+			}
+
+			if b.currentHash != b.generateHash() {
+				t.Fatalf("Expected hash %d but got %d for %s\n", b.generateHash(), b.currentHash, generateFEN(b))
+			}
+			hashes = append(hashes, b.currentHash)
+		}
+
+		for i := len(hashes) - 2; i >= 0; i-- {
+			b.UndoMove()
+			if b.currentHash != hashes[i] {
+				t.Fatalf("Expected hash %d but got %d after undo to %s\n", hashes[i], b.currentHash, generateFEN(b))
+			}
+		}
+	}
+}
+
+func TestHashDependsOnSideToMove(t *testing.T) {
+	white := NewBoard("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	black := NewBoard("4k3/8/8/8/8/8/8/4K3 b - - 0 1")
+
+	if white.currentHash == black.currentHash {
+		t.Errorf("Expected different hashes for different sides to move\n")
+	}
+}
+
+func TestNullMove(t *testing.T) {
+	fen := "8/8/1k6/2b5/2pP4/8/5K2/8 b - d3 0 1"
+	b := NewBoard(fen)
+
+	b.MakeNullMove()
+
+	if b.sideToMove != White || b.enPassant != Invalid {
+		t.Errorf("Expected white to move without en passant square but got %s\n", generateFEN(b))
+	}
+
+	b.UndoNullMove()
+
+	if actual := generateFEN(b); actual != fen {
+		t.Errorf("Expected %s but got %s\n", fen, actual)
+	}
+}
+
+func TestPassedPawn(t *testing.T) {
+	b := NewBoard("4k3/8/2p5/8/1P5P/8/8/4K3 w - - 0 1")
+
+	if b.passedPawn(int8(B4), WhitePawn) {
+		t.Errorf("Expected b4 not to be a passed pawn\n")
+	}
+	if !b.passedPawn(int8(H4), WhitePawn) {
+		t.Errorf("Expected h4 to be a passed pawn\n")
+	}
+	if b.passedPawn(int8(C6), BlackPawn) {
+		t.Errorf("Expected c6 not to be a passed pawn\n")
+	}
+}
+
+func TestCastlingRightsLostByRookCapture(t *testing.T) {
+	b := NewBoard("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+
+	b.MakeMove(Move{From: A1, To: A8, MovedPiece: WhiteRook, Content: BlackRook, Promoted: Empty})
+
+	if b.whiteCastle != castleShort || b.blackCastle != castleShort {
+		t.Errorf("Expected only short castling left but got %d and %d\n", b.whiteCastle, b.blackCastle)
+	}
+}
@@ -0,0 +1,271 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	chess960Positions = 960
+	chess960Standard  = 518 // the index of the standard start position
+)
+
+// castlingSetup holds the start squares of the kings and the castling rooks
+// by color index. They are the same for all standard games, in Chess960
+// they depend on the start position.
+type castlingSetup struct {
+	king      [2]Square
+	rookShort [2]Square
+	rookLong  [2]Square
+	mask      [64][2]int8 // the castling rights which remain when a piece leaves or enters a square
+	chess960  bool        // castling moves are written as the king taking the rook
+}
+
+var standardCastling = newCastlingSetup([2]Square{E1, E8}, [2]Square{H1, H8}, [2]Square{A1, A8}, false)
+
+func newCastlingSetup(king, rookShort, rookLong [2]Square, chess960 bool) *castlingSetup {
+	c := &castlingSetup{king: king, rookShort: rookShort, rookLong: rookLong, chess960: chess960}
+
+	all := castleShort | castleLong
+	for sq := range c.mask {
+		c.mask[sq] = [2]int8{all, all}
+	}
+	for i := 0; i < 2; i++ {
+		c.mask[sq64(rookLong[i])][i] = castleShort
+		c.mask[sq64(rookShort[i])][i] = castleLong
+		c.mask[sq64(king[i])][i] = castleNone
+	}
+
+	return c
+}
+
+// squares returns the 0x88 squares of king and rook before and after
+// castling, the king always ends on the g or c file and the rook next to it
+func (c *castlingSetup) squares(color, dir int8) (king, kingTo, rook, rookTo int8) {
+	i := colorIndex(color)
+	king, rook = int8(c.king[i]), int8(c.rookLong[i])
+	kingFile, rookFile := int8(2), int8(3)
+	if dir == castleShort {
+		rook = int8(c.rookShort[i])
+		kingFile, rookFile = 6, 5
+	}
+
+	return king, square(rank(king), kingFile), rook, square(rank(king), rookFile)
+}
+
+// move returns the castling move, in Chess960 its target is the rook so it
+// can't be confused with a king move to the same square
+func (c *castlingSetup) move(color, dir int8) Move {
+	king, kingTo, rook, _ := c.squares(color, dir)
+	m := Move{From: Square(king), To: Square(kingTo), Content: Empty, MovedPiece: King * color, Special: moveCastelingLong}
+	if dir == castleShort {
+		m.Special = moveCastelingShort
+	}
+	if c.chess960 {
+		m.To = Square(rook)
+	}
+	return m
+}
+
+// flip returns the setup with the colors swapped and the ranks mirrored
+func (c *castlingSetup) flip() *castlingSetup {
+	mirror := func(squares [2]Square) [2]Square {
+		return [2]Square{squares[1] ^ 0x70, squares[0] ^ 0x70}
+	}
+	return newCastlingSetup(mirror(c.king), mirror(c.rookShort), mirror(c.rookLong), c.chess960)
+}
+
+// parseCastling reads the castling field of a FEN: KQkq, X-FEN which
+// names the file of a rook which is not the outermost one, and Shredder-FEN
+// which names the files of all castling rooks. Rights of a king which is not
+// on its back rank are dropped.
+func parseCastling(b *Board, field string) error {
+	king := [2]Square{E1, E8}
+	rookShort, rookLong := [2]Square{H1, H8}, [2]Square{A1, A8}
+	chess960 := false
+
+	for _, r := range field {
+		if r == '-' {
+			continue
+		}
+
+		color, i, letter := White, 0, r
+		if r >= 'a' && r <= 'z' {
+			color, i, letter = Black, 1, r-'a'+'A'
+		}
+
+		kingSquare := b.whiteKingPosition
+		backRank := int8(0)
+		if color == Black {
+			kingSquare, backRank = b.blackKingPosition, size-1
+		}
+		if b.data[kingSquare] != King*color || rank(int8(kingSquare)) != backRank {
+			// the right can never be used
+			continue
+		}
+		king[i] = kingSquare
+
+		kingFile := file(int8(kingSquare))
+		switch {
+		case letter == 'K':
+			// the outermost rook
+			for f := size - 1; f > kingFile; f-- {
+				if b.data[square(backRank, f)] == Rook*color {
+					rookShort[i] = Square(square(backRank, f))
+					break
+				}
+			}
+			b.setCastle(color, castleShort)
+		case letter == 'Q':
+			for f := int8(0); f < kingFile; f++ {
+				if b.data[square(backRank, f)] == Rook*color {
+					rookLong[i] = Square(square(backRank, f))
+					break
+				}
+			}
+			b.setCastle(color, castleLong)
+		case letter >= 'A' && letter <= 'H':
+			f := int8(letter - 'A')
+			if f > kingFile {
+				rookShort[i] = Square(square(backRank, f))
+				b.setCastle(color, castleShort)
+			} else if f < kingFile {
+				rookLong[i] = Square(square(backRank, f))
+				b.setCastle(color, castleLong)
+			} else {
+				return errors.New("invalid FEN: castling rook on the king's file")
+			}
+			chess960 = true
+		default:
+			return errors.New("invalid FEN: invalid castling rights")
+		}
+	}
+
+	setup := newCastlingSetup(king, rookShort, rookLong, chess960)
+	if !chess960 && setup.king == standardCastling.king && setup.rookShort == standardCastling.rookShort &&
+		setup.rookLong == standardCastling.rookLong {
+		setup = standardCastling
+	} else {
+		setup.chess960 = true
+	}
+	b.castling = setup
+
+	return nil
+}
+
+func (b *Board) setCastle(color, dir int8) {
+	if color == White {
+		b.whiteCastle |= dir
+	} else {
+		b.blackCastle |= dir
+	}
+}
+
+// castlingField writes the castling rights in X-FEN: the file of a rook is
+// only given if there is another rook further out on the same side
+func castlingField(b *Board) string {
+	s := ""
+	for _, color := range []int8{White, Black} {
+		rights := b.whiteCastle
+		if color == Black {
+			rights = b.blackCastle
+		}
+
+		for _, dir := range []int8{castleShort, castleLong} {
+			if rights&dir == 0 {
+				continue
+			}
+
+			_, _, rook, _ := b.castling.squares(color, dir)
+			letter := 'K'
+			outer, step := square(rank(rook), size-1), nextFile
+			if dir == castleLong {
+				letter, outer, step = 'Q', square(rank(rook), 0), -nextFile
+			}
+			for sq := rook + step; sq != outer+step; sq += step {
+				if b.data[sq] == Rook*color {
+					letter = 'A' + rune(file(rook))
+				}
+			}
+
+			if color == Black {
+				letter += 'a' - 'A'
+			}
+			s += string(letter)
+		}
+	}
+
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// chess960FEN returns the start position of the given index (0-959) in
+// the numbering of Scharnagl, 518 is the standard start position
+func chess960FEN(index int) (string, error) {
+	if index < 0 || index >= chess960Positions {
+		return "", errors.New("invalid Chess960 position, expected 0-959")
+	}
+
+	pieces := make([]byte, size)
+	n := index
+
+	// the bishops on a light and a dark square
+	pieces[2*(n%4)+1] = 'b'
+	n /= 4
+	pieces[2*(n%4)] = 'b'
+	n /= 4
+
+	// the queen and the knights on the free squares
+	place := func(piece byte, nth int) {
+		for i := range pieces {
+			if pieces[i] == 0 {
+				if nth == 0 {
+					pieces[i] = piece
+					return
+				}
+				nth--
+			}
+		}
+	}
+	place('q', n%6)
+	n /= 6
+
+	knights := [10][2]int{{0, 0}, {0, 1}, {0, 2}, {0, 3}, {1, 1}, {1, 2}, {1, 3}, {2, 2}, {2, 3}, {3, 3}}
+	place('n', knights[n][0])
+	place('n', knights[n][1])
+
+	// the king between the rooks
+	place('r', 0)
+	place('k', 0)
+	place('r', 0)
+
+	black := string(pieces)
+	return black + "/pppppppp/8/8/8/8/PPPPPPPP/" + strings.ToUpper(black) + " w KQkq - 0 1", nil
+}
+
+// NewChess960Board creates the Chess960 start position of the given index,
+// castling moves are written as the king taking the rook even for the
+// standard start position
+func NewChess960Board(index int) (*Board, error) {
+	fen, err := chess960FEN(index)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := parseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	b.setChess960()
+	return b, nil
+}
+
+// setChess960 writes castling moves as the king taking the rook
+func (b *Board) setChess960() {
+	if !b.castling.chess960 {
+		c := b.castling
+		b.castling = newCastlingSetup(c.king, c.rookShort, c.rookLong, true)
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChess960FEN(t *testing.T) {
+	for index, expected := range map[int]string{0: "bbqnnrkr", 518: "rnbqkbnr", 959: "rkrnnqbb"} {
+		fen, err := chess960FEN(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(fen, expected+"/pppppppp/8/8/8/8/PPPPPPPP/"+strings.ToUpper(expected)+" w KQkq") {
+			t.Errorf("Expected %s for position %d but got %s\n", expected, index, fen)
+		}
+	}
+
+	for _, index := range []int{-1, 960} {
+		if _, err := chess960FEN(index); err == nil {
+			t.Errorf("Expected an error for position %d\n", index)
+		}
+	}
+}
+
+func TestChess960StartPositions(t *testing.T) {
+	seen := map[string]bool{}
+	for index := 0; index < chess960Positions; index++ {
+		fen, _ := chess960FEN(index)
+		rank := strings.Split(fen, "/")[0]
+		if seen[rank] {
+			t.Fatalf("Expected unique positions but got %s twice\n", rank)
+		}
+		seen[rank] = true
+
+		b, err := NewChess960Board(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bishops := strings.Index(rank, "b") + strings.LastIndex(rank, "b")
+		king := strings.Index(rank, "k")
+		if bishops%2 == 0 || king < strings.Index(rank, "r") || king > strings.LastIndex(rank, "r") {
+			t.Errorf("Expected bishops on both colors and the king between the rooks but got %s\n", rank)
+		}
+		if actual := generateFEN(b); actual != fen {
+			t.Errorf("Expected %s but got %s\n", fen, actual)
+		}
+
+		// castling may be legal right away, e.g. with the king on d1 and a
+		// rook on c1, so the two move generators are compared
+		if nodes, expected := newPosition(b).Perft(3), RunPerft(b, 3, 1).Nodes; nodes != expected {
+			t.Errorf("Expected %d nodes at depth 3 for position %d but got %d\n", expected, index, nodes)
+		}
+	}
+}
+
+func TestParseCastling(t *testing.T) {
+	for fen, expected := range map[string]string{
+		// Shredder-FEN of the start position
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		// an inner rook is named by its file
+		"4k3/8/8/8/8/8/8/RK1R3R w DA - 0 1": "4k3/8/8/8/8/8/8/RK1R3R w DQ - 0 1",
+		"4k3/8/8/8/8/8/8/RK1R3R w DQ - 0 1": "4k3/8/8/8/8/8/8/RK1R3R w DQ - 0 1",
+		"1rkr4/8/8/8/8/8/8/4K3 b - - 0 1":   "1rkr4/8/8/8/8/8/8/4K3 b - - 0 1",
+		// rights of a king off its back rank are dropped
+		"8/8/8/8/8/8/4k3/R3K2R w KQkq - 0 1": "8/8/8/8/8/8/4k3/R3K2R w KQ - 0 1",
+	} {
+		b, err := parseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := generateFEN(b); actual != expected {
+			t.Errorf("Expected %s but got %s\n", expected, actual)
+		}
+	}
+
+	b, _ := parseFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1")
+	if !b.castling.chess960 {
+		t.Errorf("Expected Shredder-FEN to select Chess960\n")
+	}
+	if b, _ := parseFEN(defaultFEN); b.castling != standardCastling {
+		t.Errorf("Expected the standard castling setup\n")
+	}
+
+	if _, err := parseFEN("4k3/8/8/8/8/8/8/4K3 w E - 0 1"); err == nil {
+		t.Errorf("Expected an error for a castling rook on the king's file\n")
+	}
+}
+
+func TestChess960Castling(t *testing.T) {
+	for _, c := range []struct {
+		fen, move, after string
+	}{
+		// king and rook swap their squares
+		{"4k3/8/8/8/8/8/8/5KR1 w G - 0 1", "f1g1", "4k3/8/8/8/8/8/8/5RK1 b - - 1 1"},
+		// the king stays on its square
+		{"4k3/8/8/8/8/8/8/R5KR w HA - 0 1", "g1h1", "4k3/8/8/8/8/8/8/R4RK1 b - - 1 1"},
+		// the king moves past the rook's target
+		{"4k3/8/8/8/8/8/8/R5KR w HA - 0 1", "g1a1", "4k3/8/8/8/8/8/8/2KR3R b - - 1 1"},
+		{"rk5r/8/8/8/8/8/8/4K3 b ha - 0 1", "b8a8", "2kr3r/8/8/8/8/8/8/4K3 w - - 1 2"},
+	} {
+		b := NewBoard(c.fen)
+		fen, hash := generateFEN(b), b.currentHash
+
+		m, err := parseSAN(b, c.move)
+		if err != nil {
+			t.Fatalf("Expected %s to be legal in %s but got %v\n", c.move, c.fen, err)
+		}
+		if m.Special != moveCastelingShort && m.Special != moveCastelingLong || m.coordinate() != c.move {
+			t.Errorf("Expected %s to castle but got %v\n", c.move, m)
+		}
+
+		b.MakeMove(m)
+		if actual := generateFEN(b); actual != c.after {
+			t.Errorf("Expected %s after %s but got %s\n", c.after, c.move, actual)
+		}
+		if b.currentHash != b.generateHash() {
+			t.Errorf("Expected the incremental hash after %s\n", c.move)
+		}
+		b.UndoMove()
+		if actual := generateFEN(b); actual != fen || b.currentHash != hash {
+			t.Errorf("Expected %s after undo but got %s\n", fen, actual)
+		}
+
+		p, _ := NewPosition(c.fen)
+		p.MakeMove(m)
+		if actual := p.FEN(); actual != c.after {
+			t.Errorf("Expected %s after %s but got %s\n", c.after, c.move, actual)
+		}
+		p.UndoMove()
+		if actual := p.FEN(); actual != fen {
+			t.Errorf("Expected %s after undo but got %s\n", fen, actual)
+		}
+	}
+}
+
+func TestChess960CastlingLegality(t *testing.T) {
+	for fen, expected := range map[string]int{
+		// the rook on b1 shields the king from the queen
+		"4k3/8/8/8/8/8/8/qRK5 w B - 0 1": 0,
+		// the king passes an attacked square
+		"3rk3/8/8/8/8/8/8/R5KR w HA - 0 1": 1,
+		// a piece between the rook and its target
+		"4k3/8/8/8/8/8/8/1RKN4 w B - 0 1": 0,
+		"4k3/8/8/8/8/8/8/1RK5 w B - 0 1":  1,
+	} {
+		b := NewBoard(fen)
+		castles := 0
+		for _, m := range NewGenerator(b).GenerateMoves() {
+			if m.Special == moveCastelingShort || m.Special == moveCastelingLong {
+				castles++
+			}
+		}
+
+		p, _ := NewPosition(fen)
+		positionCastles := 0
+		for _, m := range p.GenerateMoves(nil) {
+			if m.Special == moveCastelingShort || m.Special == moveCastelingLong {
+				positionCastles++
+			}
+		}
+
+		if castles != expected || positionCastles != expected {
+			t.Errorf("Expected %d castling moves in %s but got %d and %d\n", expected, fen, castles, positionCastles)
+		}
+	}
+}
+
+func TestKingTakesRook(t *testing.T) {
+	b := NewBoard("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+
+	m, err := parseSAN(b, "e1h1")
+	if err != nil || m.Special != moveCastelingShort || m.coordinate() != "e1g1" {
+		t.Errorf("Expected e1h1 to castle short but got %v (%v)\n", m, err)
+	}
+
+	b.setChess960()
+	if m, err := parseSAN(b, "O-O-O"); err != nil || m.coordinate() != "e1a1" {
+		t.Errorf("Expected e1a1 in Chess960 but got %v (%v)\n", m, err)
+	}
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	pocketPieces = 5  // pawns to queens may be dropped
+	pocketMax    = 16 // all pawns of both colors
+
+	evalBonusInHand = 20 // a piece in hand may be dropped where it is needed
+)
+
+// pocketOrder is the order of the pieces in a FEN pocket
+var pocketOrder = []int8{Queen, Rook, Bishop, Knight, Pawn}
+
+// crazyhouse puts captured pieces into the pocket of the capturing side,
+// from where they may be dropped instead of a move. Promoted pieces are
+// pawns again once captured.
+type crazyhouse struct{}
+
+func (crazyhouse) Name() string { return "crazyhouse" }
+func (crazyhouse) StartFEN() string {
+	return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1"
+}
+func (crazyhouse) rules() variantRules { return variantRules{drops: true} }
+func (crazyhouse) over(b *Board) bool  { return false }
+
+func (crazyhouse) result(b *Board, inCheck bool) int {
+	return standardResult(b, inCheck)
+}
+
+// evaluate adds the pieces in hand, which are worth a bit more than on the
+// board
+func (crazyhouse) evaluate(b *Board) int {
+	score := evaluateStandard(b)
+	us, them := colorIndex(b.sideToMove), colorIndex(opponent(b.sideToMove))
+	for i := 0; i < pocketPieces; i++ {
+		value := seeValue(int8(i+1)) + evalBonusInHand
+		score += value * (int(b.pockets[us][i]) - int(b.pockets[them][i]))
+	}
+	return score
+}
+
+// updatePockets moves a captured piece into the pocket of the capturing
+// side and takes a dropped one out, the promoted pieces move along
+func (b *Board) updatePockets(m Move) {
+	us := colorIndex(pieceColor(m.MovedPiece))
+	from, to := bit(int8(m.From)), bit(int8(m.To))
+
+	if m.Content != Empty {
+		piece := abs(m.Content)
+		if b.promoted&to != 0 {
+			piece = Pawn
+		}
+		b.pockets[us][piece-1]++
+	}
+
+	switch m.Special {
+	case moveDrop:
+		b.pockets[us][abs(m.MovedPiece)-1]--
+	case movePromotion:
+		b.promoted |= to
+	case moveOrdinary:
+		if b.promoted&from != 0 {
+			b.promoted = b.promoted&^from | to
+		} else {
+			b.promoted &^= to
+		}
+	}
+}
+
+// parsePocket reads the pieces in hand, e.g. "QNpp"
+func parsePocket(b *Board, pocket string) error {
+	for _, r := range pocket {
+		piece, ok := sanPieces[byte(strings.ToUpper(string(r))[0])]
+		if r == 'P' || r == 'p' {
+			piece, ok = Pawn, true
+		}
+		if !ok || piece == King {
+			return errors.New("invalid FEN: invalid pocket")
+		}
+
+		i := 0
+		if r >= 'a' && r <= 'z' {
+			i = 1
+		}
+		if b.pockets[i][piece-1]++; b.pockets[i][piece-1] > pocketMax {
+			return errors.New("invalid FEN: invalid pocket")
+		}
+	}
+	return nil
+}
+
+// checkPocketMaterial rejects more pieces of a kind on the board and in the
+// pockets than a pocket can hold, as captures could put them all into one.
+// Promoted pieces count as pawns.
+func checkPocketMaterial(b *Board) error {
+	counts := [pocketPieces]int{}
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			sq := square(rank, file)
+			piece := abs(b.data[sq])
+			if piece == Empty || piece == King {
+				continue
+			}
+			if b.promoted&bit(sq) != 0 {
+				piece = Pawn
+			}
+			counts[piece-1]++
+		}
+	}
+	for i := range counts {
+		if counts[i]+int(b.pockets[0][i])+int(b.pockets[1][i]) > pocketMax {
+			return errors.New("invalid FEN: too many pieces for the pockets")
+		}
+	}
+	return nil
+}
+
+// pocketField writes the pieces in hand in brackets, white ones first
+func pocketField(b *Board) string {
+	s := "["
+	for _, color := range []int8{White, Black} {
+		for _, piece := range pocketOrder {
+			s += strings.Repeat(pieceString(piece*color), int(b.pockets[colorIndex(color)][piece-1]))
+		}
+	}
+	return s + "]"
+}
@@ -0,0 +1,155 @@
+package engine
+
+import "testing"
+
+func TestCrazyhouseFEN(t *testing.T) {
+	for _, c := range []struct {
+		fen, expected string
+	}{
+		{"", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1"},
+		{"4k3/8/8/8/8/8/8/4K3[pQpN] b - - 0 1", "4k3/8/8/8/8/8/8/4K3[QNpp] b - - 0 1"},
+		// the pocket as ninth rank and a promoted queen
+		{"4k2Q~/8/8/8/8/8/8/4K3/Bb w - - 0 1", "4k2Q~/8/8/8/8/8/8/4K3[Bb] w - - 0 1"},
+	} {
+		b, err := NewVariantBoard("crazyhouse", c.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := generateFEN(b); actual != c.expected {
+			t.Errorf("Expected %s but got %s\n", c.expected, actual)
+		}
+		if b.currentHash != b.generateHash() {
+			t.Errorf("Expected the hash to cover the pockets of %s\n", c.fen)
+		}
+	}
+
+	for _, fen := range []string{"4k3/8/8/8/8/8/8/4K3[Kx] w - - 0 1", "~4k3/8/8/8/8/8/8/4K3[] w - - 0 1",
+		// more pieces of a kind than a pocket holds
+		"4k3/8/8/8/8/8/3p4/4K3[PPPPPPPPPPPPPPPP] w - - 0 1", "4k3/8/8/8/8/8/3Q~4/4K3[PPPPPPPPPPPPPPPP] w - - 0 1",
+		"4k3/8/8/8/8/8/3n4/4K3[NNNNNNNNNNNNNNNN] w - - 0 1", "4k3/pppppppp/8/8/8/8/PPPPPPPP/4K3/p w - - 0 1"} {
+		if _, err := NewVariantBoard("crazyhouse", fen); err == nil {
+			t.Errorf("Expected an error for %s\n", fen)
+		}
+	}
+
+	// all pieces may be in the pockets
+	b, err := NewVariantBoard("crazyhouse", "4k3/8/8/8/8/8/3p4/4K3[PPPPPPPPPPPPPPP] w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	playMovesOn(t, b, "Kxd2")
+	if b.pockets[0][Pawn-1] != pocketMax || b.currentHash != b.generateHash() {
+		t.Errorf("Expected all pawns in the pocket but got %v\n", b.pockets)
+	}
+
+	// a promoted piece is another position than an original one
+	promoted, _ := NewVariantBoard("crazyhouse", "4k3/8/8/8/8/8/3Q~4/4K3[] w - - 0 1")
+	original, _ := NewVariantBoard("crazyhouse", "4k3/8/8/8/8/8/3Q4/4K3[] w - - 0 1")
+	if promoted.currentHash == original.currentHash {
+		t.Errorf("Expected the promoted queen to change the hash\n")
+	}
+
+	// the pockets only belong to Crazyhouse
+	if b, _ := NewVariantBoard("chess", "4k3/8/8/8/8/8/8/4K3[Q] w - - 0 1"); b.pockets != [2][pocketPieces]int8{} {
+		t.Errorf("Expected no pockets in standard chess but got %v\n", b.pockets)
+	}
+}
+
+func TestCrazyhousePockets(t *testing.T) {
+	b, _ := NewVariantBoard("crazyhouse", "4k3/8/8/3q4/8/8/8/3RK3[] w - - 0 1")
+	fen, hash := generateFEN(b), b.currentHash
+
+	for _, c := range []struct {
+		move, expected string
+	}{
+		{"Rxd5", "4k3/8/8/3R4/8/8/8/4K3[Q] b - - 0 1"},
+		{"Kf7", "8/5k2/8/3R4/8/8/8/4K3[Q] w - - 1 2"},
+		{"Q@e6+", "8/5k2/4Q3/3R4/8/8/8/4K3[] b - - 2 2"},
+		{"Kxe6", "8/8/4k3/3R4/8/8/8/4K3[q] w - - 0 3"},
+	} {
+		m, err := parseSAN(b, c.move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.MakeMove(m)
+		if actual := generateFEN(b); actual != c.expected || b.currentHash != b.generateHash() {
+			t.Errorf("Expected %s after %s but got %s\n", c.expected, c.move, actual)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		b.UndoMove()
+	}
+	if actual := generateFEN(b); actual != fen || b.currentHash != hash {
+		t.Errorf("Expected %s after undo but got %s\n", fen, actual)
+	}
+}
+
+func TestCrazyhousePromoted(t *testing.T) {
+	b, _ := NewVariantBoard("crazyhouse", "4k3/1P6/8/8/8/8/r7/4K3[] w - - 0 1")
+
+	for _, san := range []string{"b8=Q+", "Kd7", "Qb2", "Rxb2"} {
+		m, err := parseSAN(b, san)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.MakeMove(m)
+	}
+
+	// the queen was a pawn and is one again in the pocket
+	expected := "8/3k4/8/8/8/8/1r6/4K3[p] w - - 0 3"
+	if actual := generateFEN(b); actual != expected {
+		t.Errorf("Expected %s but got %s\n", expected, actual)
+	}
+}
+
+func TestCrazyhouseDrops(t *testing.T) {
+	for _, c := range []struct {
+		fen      string
+		expected int
+	}{
+		// pawns are not dropped on the first and last rank
+		{"4k3/8/8/8/8/8/8/4K3[P] w - - 0 1", 5 + 48},
+		{"4k3/8/8/8/8/8/8/4K3[N] w - - 0 1", 5 + 62},
+		// a check is evaded by dropping in between
+		{"4k3/8/8/8/8/8/8/r3K3[N] w - - 0 1", 3 + 3},
+		// there is no drop against a contact check
+		{"4k3/8/8/8/8/8/8/3qK3[N] w - - 0 1", 2},
+	} {
+		b, _ := NewVariantBoard("crazyhouse", c.fen)
+		if actual := len(NewGenerator(b).GenerateMoves()); actual != c.expected {
+			t.Errorf("Expected %d moves in %s but got %d\n", c.expected, c.fen, actual)
+		}
+	}
+}
+
+func TestCrazyhouseSAN(t *testing.T) {
+	b, _ := NewVariantBoard("crazyhouse", "4k3/8/8/8/8/8/8/4K3[NPp] w - - 0 1")
+
+	for _, c := range []struct {
+		san, expected string
+	}{
+		{"N@d6+", "N@d6+"},
+		{"n@f6", "N@f6+"},
+		{"@e4", "P@e4"},
+		{"P@e4", "P@e4"},
+	} {
+		m, err := parseSAN(b, c.san)
+		if err != nil {
+			t.Errorf("Expected a move for %s but got %v\n", c.san, err)
+			continue
+		}
+		if actual := formatSAN(b, m); actual != c.expected {
+			t.Errorf("Expected %s but got %s\n", c.expected, actual)
+		}
+		if !NewGenerator(b).IsLegal(m) {
+			t.Errorf("Expected %s to be legal\n", c.san)
+		}
+	}
+
+	for _, san := range []string{"P@e8", "B@e4", "K@e4", "N@e1"} {
+		if _, err := parseSAN(b, san); err == nil {
+			t.Errorf("Expected an error for %s\n", san)
+		}
+	}
+}
@@ -0,0 +1,648 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A database is a directory of three files, which are only appended to:
+// the imported games as PGN, a record per game and a record per position
+// of each game. A game is complete once its record is written, whatever
+// an interrupted import left behind is cut off on opening.
+const (
+	databasePGN       = "games.pgn"
+	databaseGames     = "games.idx"
+	databasePositions = "positions.idx"
+
+	gameRecordSize     = 16 // offset, length, result, variant and plies
+	positionRecordSize = 26 // hash, material, game, ply and move
+
+	resultUnknown = 2 // besides 1, 0 and -1 from white's view
+)
+
+// Database is a collection of games indexed by the Zobrist hashes and the
+// material of their positions
+type Database struct {
+	dir       string
+	pgn       *os.File
+	gameIndex *os.File
+	posIndex  *os.File
+	games     []dbGame
+	positions []dbPosition
+	byHash    map[int64][]int32 // indexes of positions
+	pgnSize   int64
+	broken    error // a failed write that couldn't be undone, no more imports
+	mutex     sync.Mutex
+}
+
+type dbGame struct {
+	offset  int64
+	length  uint32
+	result  int8
+	variant uint8 // 0 for chess, otherwise the index in variants plus 1
+	plies   uint16
+}
+
+// dbPosition is a position of a game and the move played in it, the last
+// position of a game has no move
+type dbPosition struct {
+	hash     int64
+	material uint64
+	game     uint32
+	ply      uint16
+	move     PackedMove
+}
+
+// DatabaseGame is a game found in a database
+type DatabaseGame struct {
+	ID     int
+	Ply    int // the position was first reached after this many half moves
+	White  string
+	Black  string
+	Event  string
+	Date   string
+	Result string
+}
+
+// MoveStat counts the games a move was played in and their results
+type MoveStat struct {
+	Move  string // in SAN
+	UCI   string
+	Games int
+	White int // wins of white
+	Draws int
+	Black int
+	Score float64 // percentage for the side to move of the games with a result
+}
+
+// ImportStats counts the imported games, games with illegal moves or an
+// unknown variant are skipped
+type ImportStats struct {
+	Games   int
+	Skipped int
+	Errors  []error // why games were skipped
+}
+
+// OpenDatabase opens the database in the given directory, which is created
+// if needed
+func OpenDatabase(dir string) (*Database, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	db := &Database{dir: dir, byHash: map[int64][]int32{}}
+	var err error
+	for _, f := range []struct {
+		name string
+		file **os.File
+	}{{databasePGN, &db.pgn}, {databaseGames, &db.gameIndex}, {databasePositions, &db.posIndex}} {
+		if *f.file, err = os.OpenFile(filepath.Join(dir, f.name), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if err := db.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// load reads the indexes and cuts off an unfinished import
+func (db *Database) load() error {
+	data, err := io.ReadAll(db.gameIndex)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+gameRecordSize <= len(data); i += gameRecordSize {
+		r := data[i : i+gameRecordSize]
+		db.games = append(db.games, dbGame{
+			offset:  int64(binary.LittleEndian.Uint64(r)),
+			length:  binary.LittleEndian.Uint32(r[8:]),
+			result:  int8(r[12]),
+			variant: r[13],
+			plies:   binary.LittleEndian.Uint16(r[14:]),
+		})
+	}
+
+	if data, err = io.ReadAll(db.posIndex); err != nil {
+		return err
+	}
+	for i := 0; i+positionRecordSize <= len(data); i += positionRecordSize {
+		r := data[i : i+positionRecordSize]
+		p := dbPosition{
+			hash:     int64(binary.LittleEndian.Uint64(r)),
+			material: binary.LittleEndian.Uint64(r[8:]),
+			game:     binary.LittleEndian.Uint32(r[16:]),
+			ply:      binary.LittleEndian.Uint16(r[20:]),
+			move:     PackedMove(binary.LittleEndian.Uint32(r[22:])),
+		}
+		if int(p.game) >= len(db.games) {
+			break
+		}
+		db.byHash[p.hash] = append(db.byHash[p.hash], int32(len(db.positions)))
+		db.positions = append(db.positions, p)
+	}
+
+	if len(db.games) > 0 {
+		last := db.games[len(db.games)-1]
+		db.pgnSize = last.offset + int64(last.length)
+	}
+	return db.truncate()
+}
+
+// truncate cuts the files back to the games in memory, the files are
+// appended to, so the next game follows the last complete one
+func (db *Database) truncate() error {
+	for _, t := range []struct {
+		name string
+		size int64
+	}{{databaseGames, int64(len(db.games) * gameRecordSize)}, {databasePositions, int64(len(db.positions) * positionRecordSize)}, {databasePGN, db.pgnSize}} {
+		if err := os.Truncate(filepath.Join(db.dir, t.name), t.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the files of the database
+func (db *Database) Close() error {
+	var err error
+	for _, f := range []*os.File{db.pgn, db.gameIndex, db.posIndex} {
+		if f != nil {
+			if e := f.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Count returns the number of games in the database
+func (db *Database) Count() int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return len(db.games)
+}
+
+// Import adds the games of a PGN file to the database
+func (db *Database) Import(r io.Reader) (ImportStats, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.broken != nil {
+		return ImportStats{}, db.broken
+	}
+	stats, number := ImportStats{}, 0
+	err := readPGN(r, func(g *pgnGame, text string) error {
+		number++
+		game, positions, err := replayPGN(g, uint32(len(db.games)))
+		if err != nil {
+			stats.Skipped++
+			stats.Errors = append(stats.Errors, fmt.Errorf("game %d: %v", number, err))
+			return nil
+		}
+		if err := db.append(strings.TrimSpace(text)+"\n\n", game, positions); err != nil {
+			return err
+		}
+		stats.Games++
+		return nil
+	})
+	return stats, err
+}
+
+// replayPGN plays the moves of a game and returns its records
+func replayPGN(g *pgnGame, id uint32) (dbGame, []dbPosition, error) {
+	variant, chess960 := pgnVariant(g.tag("Variant"))
+	b, err := NewVariantBoard(variant, g.fen)
+	if err != nil {
+		return dbGame{}, nil, err
+	}
+	if chess960 {
+		b.setChess960()
+	}
+	if err := validatePosition(b); err != nil {
+		return dbGame{}, nil, err
+	}
+	if len(g.moves) > 0xffff {
+		return dbGame{}, nil, errors.New("too many moves")
+	}
+
+	positions := make([]dbPosition, 0, len(g.moves)+1)
+	for ply, move := range g.moves {
+		m, err := parseSAN(b, move)
+		if err != nil {
+			return dbGame{}, nil, err
+		}
+		positions = append(positions, dbPosition{hash: positionKey(b), material: materialKey(b), game: id, ply: uint16(ply), move: m.Pack()})
+		b.MakeMove(m)
+	}
+	positions = append(positions, dbPosition{hash: positionKey(b), material: materialKey(b), game: id, ply: uint16(len(g.moves))})
+
+	game := dbGame{result: resultUnknown, variant: variantIndex(b.variant), plies: uint16(len(g.moves))}
+	switch g.result {
+	case "1-0":
+		game.result = 1
+	case "0-1":
+		game.result = -1
+	case "1/2-1/2":
+		game.result = 0
+	}
+	return game, positions, nil
+}
+
+// pgnVariant returns the variant and whether castling follows Chess960
+// for the Variant tag of a game
+func pgnVariant(tag string) (string, bool) {
+	name := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(tag))
+	switch name {
+	case "chess960", "fischerandom", "fischerrandom":
+		return "", true
+	case "threecheck":
+		return "3check", false
+	}
+	return name, false
+}
+
+// append writes a game, its record last. A failed write is undone, so
+// the files keep matching the games in memory.
+func (db *Database) append(text string, game dbGame, positions []dbPosition) error {
+	game.offset, game.length = db.pgnSize, uint32(len(text))
+	if err := db.write(text, game, positions); err != nil {
+		if e := db.truncate(); e != nil {
+			db.broken = fmt.Errorf("database %s needs to be reopened: %v", db.dir, e)
+		}
+		return err
+	}
+
+	db.pgnSize += int64(len(text))
+	for _, p := range positions {
+		db.byHash[p.hash] = append(db.byHash[p.hash], int32(len(db.positions)))
+		db.positions = append(db.positions, p)
+	}
+	db.games = append(db.games, game)
+	return nil
+}
+
+func (db *Database) write(text string, game dbGame, positions []dbPosition) error {
+	if _, err := db.pgn.WriteString(text); err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, len(positions)*positionRecordSize)
+	for _, p := range positions {
+		data = binary.LittleEndian.AppendUint64(data, uint64(p.hash))
+		data = binary.LittleEndian.AppendUint64(data, p.material)
+		data = binary.LittleEndian.AppendUint32(data, p.game)
+		data = binary.LittleEndian.AppendUint16(data, p.ply)
+		data = binary.LittleEndian.AppendUint32(data, uint32(p.move))
+	}
+	if _, err := db.posIndex.Write(data); err != nil {
+		return err
+	}
+
+	record := binary.LittleEndian.AppendUint64(nil, uint64(game.offset))
+	record = binary.LittleEndian.AppendUint32(record, game.length)
+	record = append(record, byte(game.result), game.variant)
+	record = binary.LittleEndian.AppendUint16(record, game.plies)
+	_, err := db.gameIndex.Write(record)
+	return err
+}
+
+// Find returns the games that reached the position of the board, at most
+// limit of them unless limit is 0
+func (db *Database) Find(b *Board, limit int) ([]DatabaseGame, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	variant := variantIndex(b.variant)
+	return db.found(limit, func(found func(dbPosition)) {
+		for _, i := range db.byHash[positionKey(b)] {
+			if p := db.positions[i]; db.games[p.game].variant == variant {
+				found(p)
+			}
+		}
+	})
+}
+
+// FindMaterial returns the games that reached the material of a signature
+// like KRPvKR, white's pieces first
+func (db *Database) FindMaterial(signature string, limit int) ([]DatabaseGame, error) {
+	key, err := parseMaterial(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.found(limit, func(found func(dbPosition)) {
+		for _, p := range db.positions {
+			if p.material == key {
+				found(p)
+			}
+		}
+	})
+}
+
+// found collects the games of the positions passed to found by the search,
+// each game with the first ply it was found at
+func (db *Database) found(limit int, search func(found func(dbPosition))) ([]DatabaseGame, error) {
+	plies := map[uint32]int{}
+	search(func(p dbPosition) {
+		if ply, ok := plies[p.game]; !ok || int(p.ply) < ply {
+			plies[p.game] = int(p.ply)
+		}
+	})
+
+	ids := make([]int, 0, len(plies))
+	for id := range plies {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	games := make([]DatabaseGame, 0, len(ids))
+	for _, id := range ids {
+		text, err := db.text(id)
+		if err != nil {
+			return nil, err
+		}
+		g := parsePGN(text)
+		games = append(games, DatabaseGame{ID: id, Ply: plies[uint32(id)], White: g.tag("White"), Black: g.tag("Black"),
+			Event: g.tag("Event"), Date: g.tag("Date"), Result: g.result})
+	}
+	return games, nil
+}
+
+// Explore counts the moves played in the position of the board and the
+// results they led to, the most frequent first
+func (db *Database) Explore(b *Board) []MoveStat {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	type gameMove struct {
+		game uint32
+		move PackedMove
+	}
+	seen := map[gameMove]bool{}
+	counts := map[PackedMove]*MoveStat{}
+
+	variant := variantIndex(b.variant)
+	legal := NewGenerator(b).GenerateMoves()
+	for _, i := range db.byHash[positionKey(b)] {
+		p := db.positions[i]
+		game := db.games[p.game]
+		if p.move == 0 || game.variant != variant || seen[gameMove{p.game, p.move}] {
+			continue
+		}
+		seen[gameMove{p.game, p.move}] = true
+
+		s := counts[p.move]
+		if s == nil {
+			m, ok := Move{}, false
+			for _, legalMove := range legal {
+				if legalMove.Pack() == p.move {
+					m, ok = legalMove, true
+				}
+			}
+			if !ok {
+				continue
+			}
+			s = &MoveStat{Move: formatSAN(b, m), UCI: m.coordinate()}
+			counts[p.move] = s
+		}
+
+		s.Games++
+		switch game.result {
+		case 1:
+			s.White++
+		case 0:
+			s.Draws++
+		case -1:
+			s.Black++
+		}
+	}
+
+	stats := make([]MoveStat, 0, len(counts))
+	for _, s := range counts {
+		if results := s.White + s.Draws + s.Black; results > 0 {
+			wins := s.White
+			if b.sideToMove == Black {
+				wins = s.Black
+			}
+			s.Score = 100 * (float64(wins) + float64(s.Draws)/2) / float64(results)
+		}
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Games != stats[j].Games {
+			return stats[i].Games > stats[j].Games
+		}
+		return stats[i].Move < stats[j].Move
+	})
+	return stats
+}
+
+// PGN returns the text of a game
+func (db *Database) PGN(id int) (string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.text(id)
+}
+
+func (db *Database) text(id int) (string, error) {
+	if id < 0 || id >= len(db.games) {
+		return "", fmt.Errorf("no game %d", id)
+	}
+	g := db.games[id]
+	data := make([]byte, g.length)
+	if _, err := db.pgn.ReadAt(data, g.offset); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// positionKey is the Zobrist hash of the board without an en passant square
+// no pawn can capture on, so transpositions after a double step match
+func positionKey(b *Board) int64 {
+	key := b.currentHash
+	if b.enPassant == Invalid {
+		return key
+	}
+	from := int(b.enPassant) - 16*int(b.sideToMove)
+	for _, sq := range []int{from - 1, from + 1} {
+		if sq >= 0 && sq&0x88 == 0 && b.data[sq] == Pawn*b.sideToMove {
+			return key
+		}
+	}
+	return key ^ b.zobristTable.hashEnPassant[b.enPassant]
+}
+
+// materialPieces are the letters of a material signature
+const materialPieces = "PNBRQK"
+
+// materialKey packs the number of each piece of both sides in four bits
+func materialKey(b *Board) uint64 {
+	key := uint64(0)
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			if piece := b.data[square(rank, file)]; piece > 0 {
+				key = addMaterial(key, White, piece)
+			} else if piece < 0 {
+				key = addMaterial(key, Black, -piece)
+			}
+		}
+	}
+	return key
+}
+
+func addMaterial(key uint64, color, piece int8) uint64 {
+	shift := uint(colorIndex(color)*24 + int(piece-1)*4)
+	if key>>shift&15 < 15 {
+		key += 1 << shift
+	}
+	return key
+}
+
+// parseMaterial reads a signature like KRPvKR
+func parseMaterial(signature string) (uint64, error) {
+	sides := strings.Split(signature, "v")
+	if len(sides) != 2 {
+		return 0, fmt.Errorf("invalid material %q, expected e.g. KRPvKR", signature)
+	}
+
+	key := uint64(0)
+	for i, side := range sides {
+		color := White
+		if i == 1 {
+			color = Black
+		}
+		for _, c := range strings.ToUpper(side) {
+			piece := strings.IndexRune(materialPieces, c)
+			if piece < 0 {
+				return 0, fmt.Errorf("invalid material %q, expected e.g. KRPvKR", signature)
+			}
+			key = addMaterial(key, color, int8(piece+1))
+		}
+	}
+	return key, nil
+}
+
+// DatabaseOptions selects a database and the position of its queries
+type DatabaseOptions struct {
+	Dir     string
+	Variant string
+	FEN     string   // the start position if empty
+	Moves   []string // played from the position
+	Limit   int      // most games listed, 0 for all
+}
+
+// RunDatabase runs a database command: import <files>, games and explore
+// for the position of the options, material <signature> or pgn <id>
+func RunDatabase(options DatabaseOptions, command string, args []string) error {
+	db, err := OpenDatabase(options.Dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "import":
+		for _, path := range args {
+			if err := importFile(db, path); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%d games in %s\n", db.Count(), options.Dir)
+
+	case "games", "explore":
+		b, err := NewVariantBoard(options.Variant, options.FEN)
+		if err != nil {
+			return err
+		}
+		for _, move := range options.Moves {
+			m, err := parseSAN(b, move)
+			if err != nil {
+				return err
+			}
+			b.MakeMove(m)
+		}
+		if command == "explore" {
+			printMoveStats(db.Explore(b))
+			return nil
+		}
+		games, err := db.Find(b, options.Limit)
+		if err != nil {
+			return err
+		}
+		printDatabaseGames(games)
+
+	case "material":
+		if len(args) != 1 {
+			return errors.New("usage: material <signature>")
+		}
+		games, err := db.FindMaterial(args[0], options.Limit)
+		if err != nil {
+			return err
+		}
+		printDatabaseGames(games)
+
+	case "pgn":
+		if len(args) != 1 {
+			return errors.New("usage: pgn <id>")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		text, err := db.PGN(id)
+		if err != nil {
+			return err
+		}
+		fmt.Print(text)
+
+	default:
+		return fmt.Errorf("unknown database command %q", command)
+	}
+	return nil
+}
+
+func importFile(db *Database, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stats, err := db.Import(f)
+	fmt.Printf("%s: %d games imported, %d skipped\n", path, stats.Games, stats.Skipped)
+	for _, e := range stats.Errors {
+		fmt.Printf("  %v\n", e)
+	}
+	return err
+}
+
+func printMoveStats(stats []MoveStat) {
+	fmt.Printf("move     games   white  draws  black  score\n")
+	for _, s := range stats {
+		fmt.Printf("%-7s %6d  %6d %6d %6d  %5.1f%%\n", s.Move, s.Games, s.White, s.Draws, s.Black, s.Score)
+	}
+}
+
+func printDatabaseGames(games []DatabaseGame) {
+	for _, g := range games {
+		fmt.Printf("%6d  %s - %s  %s  %s %s (ply %d)\n", g.ID, g.White, g.Black, g.Result, g.Event, g.Date, g.Ply)
+	}
+}
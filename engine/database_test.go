@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const databaseTestPGN = `[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0
+
+[White "C"]
+[Black "D"]
+[Result "0-1"]
+
+1. Nf3 Nc6 2. e4 e5 3. Bc4 0-1
+
+[White "E"]
+[Black "F"]
+[Result "1/2-1/2"]
+
+1. e4 c5 1/2-1/2
+
+[White "G"]
+[Black "H"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+
+[White "Broken"]
+[Result "*"]
+
+1. e4 e4 *
+
+[Variant "Antichess"]
+[Result "*"]
+
+1. e4 e5 *
+`
+
+func openTestDatabase(t *testing.T) (*Database, string) {
+	dir := t.TempDir()
+	db, err := OpenDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Import(strings.NewReader(databaseTestPGN))
+	if err != nil || stats.Games != 5 || stats.Skipped != 1 || len(stats.Errors) != 1 {
+		t.Fatalf("Expected 5 games and one skipped but got %v %v\n", stats, err)
+	}
+	return db, dir
+}
+
+func TestDatabaseFind(t *testing.T) {
+	db, _ := openTestDatabase(t)
+	defer db.Close()
+
+	// the first two games transpose, the en passant square of the second
+	// doesn't matter as no pawn can capture
+	b := NewBoard("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq e6 0 3")
+	games, err := db.Find(b, 0)
+	if err != nil || len(games) != 2 || games[0].White != "A" || games[1].White != "C" || games[0].Ply != 4 || games[1].Result != "0-1" {
+		t.Errorf("Expected the games of A and C but got %v %v\n", games, err)
+	}
+
+	if games, _ := db.Find(NewBoard(defaultFEN), 2); len(games) != 2 || games[0].ID != 0 {
+		t.Errorf("Expected the limit to apply but got %v\n", games)
+	}
+
+	// the Antichess game is not a game of chess
+	b, _ = NewVariantBoard("antichess", "")
+	if games, _ := db.Find(b, 0); len(games) != 1 || games[0].ID != 4 {
+		t.Errorf("Expected only the Antichess game but got %v\n", games)
+	}
+
+	text, err := db.PGN(2)
+	if err != nil || !strings.HasPrefix(text, `[White "E"]`) || !strings.HasSuffix(text, "1/2-1/2\n\n") {
+		t.Errorf("Expected the PGN of the third game but got %q %v\n", text, err)
+	}
+}
+
+func TestDatabaseExplore(t *testing.T) {
+	db, _ := openTestDatabase(t)
+	defer db.Close()
+
+	stats := db.Explore(NewBoard(defaultFEN))
+	if len(stats) != 2 || stats[0].Move != "e4" || stats[0].Games != 3 || stats[1].Move != "Nf3" || stats[1].UCI != "g1f3" {
+		t.Fatalf("Expected e4 and Nf3 but got %v\n", stats)
+	}
+	if s := stats[0]; s.White != 2 || s.Draws != 1 || s.Black != 0 || s.Score < 83.3 || s.Score > 83.4 {
+		t.Errorf("Expected 2 wins and a draw for e4 but got %v\n", s)
+	}
+
+	// the score is the one of the side to move
+	b := NewBoard(defaultFEN)
+	playMovesOn(t, b, "e4")
+	stats = db.Explore(b)
+	if len(stats) != 2 || stats[0].Move != "e5" || stats[0].Score != 0 || stats[1].Move != "c5" || stats[1].Score != 50 {
+		t.Errorf("Expected e5 and c5 but got %v\n", stats)
+	}
+}
+
+func TestDatabaseMaterial(t *testing.T) {
+	db, _ := openTestDatabase(t)
+	defer db.Close()
+
+	// only the mating game loses a pawn
+	games, err := db.FindMaterial("KQRRBBNNPPPPPPPPvKQRRBBNNPPPPPPP", 0)
+	if err != nil || len(games) != 1 || games[0].White != "G" || games[0].Ply != 7 {
+		t.Errorf("Expected the mating game but got %v %v\n", games, err)
+	}
+
+	for _, signature := range []string{"KRvKR", "KR", "KXvK"} {
+		games, err := db.FindMaterial(signature, 0)
+		if len(games) != 0 || (err == nil) != (signature == "KRvKR") {
+			t.Errorf("Expected nothing for %s but got %v %v\n", signature, games, err)
+		}
+	}
+}
+
+func TestDatabaseReopen(t *testing.T) {
+	db, dir := openTestDatabase(t)
+	db.Close()
+
+	// an interrupted import leaves the start of a game behind
+	for name, tail := range map[string]string{databasePGN: "[Event \"cut\"]\n", databasePositions: strings.Repeat("x", positionRecordSize+3), databaseGames: "xyz"} {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(tail)
+		f.Close()
+	}
+
+	db, err := OpenDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Count() != 5 || len(db.positions) != 6+6+3+8+3 {
+		t.Errorf("Expected 5 games with 26 positions but got %d %d\n", db.Count(), len(db.positions))
+	}
+
+	if stats, err := db.Import(strings.NewReader("1. d4 d5 1/2-1/2\n")); err != nil || stats.Games != 1 {
+		t.Fatalf("Expected a game but got %v %v\n", stats, err)
+	}
+	db.Close()
+
+	db, _ = OpenDatabase(dir)
+	defer db.Close()
+	b := NewBoard(defaultFEN)
+	playMovesOn(t, b, "d4", "d5")
+	if games, _ := db.Find(b, 0); len(games) != 1 || games[0].ID != 5 || games[0].Result != "1/2-1/2" {
+		t.Errorf("Expected the game appended after the repair but got %v\n", games)
+	}
+	if text, _ := db.PGN(5); text != "1. d4 d5 1/2-1/2\n\n" {
+		t.Errorf("Expected the text of the game but got %q\n", text)
+	}
+}
+
+func TestDatabaseWriteError(t *testing.T) {
+	full, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip("skipping without /dev/full")
+	}
+	defer full.Close()
+
+	db, dir := openTestDatabase(t)
+
+	// the game and positions written before the failing record are undone
+	gameIndex := db.gameIndex
+	db.gameIndex = full
+	if _, err := db.Import(strings.NewReader("1. d4 d5 1/2-1/2\n")); err == nil || db.Count() != 5 {
+		t.Errorf("Expected an error and 5 games but got %d %v\n", db.Count(), err)
+	}
+	db.gameIndex = gameIndex
+
+	if stats, err := db.Import(strings.NewReader("1. c4 c5 1-0\n")); err != nil || stats.Games != 1 {
+		t.Fatalf("Expected a game but got %v %v\n", stats, err)
+	}
+	db.Close()
+
+	db, _ = OpenDatabase(dir)
+	defer db.Close()
+	if db.Count() != 6 || len(db.positions) != 26+3 {
+		t.Errorf("Expected 6 games with 29 positions but got %d %d\n", db.Count(), len(db.positions))
+	}
+	if text, _ := db.PGN(5); text != "1. c4 c5 1-0\n\n" {
+		t.Errorf("Expected the game after the failed one but got %q\n", text)
+	}
+	b := NewBoard(defaultFEN)
+	playMovesOn(t, b, "d4")
+	if games, _ := db.Find(b, 0); len(games) != 0 {
+		t.Errorf("Expected no positions of the failed game but got %v\n", games)
+	}
+}
+
+// playMovesOn makes the given moves on a board
+func playMovesOn(t *testing.T, b *Board, moves ...string) {
+	for _, move := range moves {
+		m, err := parseSAN(b, move)
+		if err != nil {
+			t.Fatalf("Expected %s to be legal but got %v\n", move, err)
+		}
+		b.MakeMove(m)
+	}
+}
+
+func TestPositionKey(t *testing.T) {
+	for _, c := range []struct {
+		fen   string
+		equal bool
+	}{
+		{"4k3/8/8/8/4P3/8/8/4K3 b - e3 0 1", true},
+		{"4k3/8/8/8/3pP3/8/8/4K3 b - e3 0 1", false},
+		{"4k3/8/8/3Pp3/8/8/8/4K3 w - e6 0 1", false},
+		{"4k3/8/8/4p3/8/8/8/4K3 w - e6 0 1", true},
+	} {
+		without := strings.Replace(c.fen, " e3 ", " - ", 1)
+		without = strings.Replace(without, " e6 ", " - ", 1)
+		if equal := positionKey(NewBoard(c.fen)) == positionKey(NewBoard(without)); equal != c.equal {
+			t.Errorf("Expected the key of %s to match the one without en passant %v but got %v\n", c.fen, c.equal, equal)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+)
+
+// epdRecord is a position of an EPD file with its operations, e.g.
+// bm Qg6; id "WAC.001";
+type epdRecord struct {
+	fen string
+	ops map[string][]string
+}
+
+// parseEPD splits an EPD line into the position and its operations, quoted
+// operands may contain spaces and semicolons
+func parseEPD(line string) (epdRecord, error) {
+	tokens := epdTokens(line)
+	if len(tokens) < 4 {
+		return epdRecord{}, errors.New("invalid EPD")
+	}
+
+	record := epdRecord{fen: strings.Join(tokens[:4], " "), ops: map[string][]string{}}
+	if _, err := parseFEN(record.fen); err != nil {
+		return record, err
+	}
+
+	opcode := ""
+	for _, token := range tokens[4:] {
+		switch {
+		case token == ";":
+			opcode = ""
+		case opcode == "":
+			opcode = token
+			record.ops[opcode] = []string{}
+		default:
+			record.ops[opcode] = append(record.ops[opcode], token)
+		}
+	}
+
+	return record, nil
+}
+
+// epdTokens splits a line at white space, semicolons are tokens of their
+// own and quotes are removed from strings
+func epdTokens(line string) []string {
+	tokens := []string{}
+	token, quoted, inToken := "", false, false
+
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, token)
+		}
+		token, inToken = "", false
+	}
+
+	for _, c := range line {
+		switch {
+		case c == '"':
+			if quoted {
+				quoted = false
+				flush()
+			} else {
+				flush()
+				quoted, inToken = true, true
+			}
+		case quoted:
+			token += string(c)
+		case c == ';':
+			flush()
+			tokens = append(tokens, ";")
+		case c == ' ' || c == '\t':
+			flush()
+		default:
+			token += string(c)
+			inToken = true
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// id returns the id of the position or the given default
+func (r epdRecord) id(def string) string {
+	if id := r.ops["id"]; len(id) > 0 {
+		return id[0]
+	}
+	return def
+}
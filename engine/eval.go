@@ -1,16 +1,9 @@
 package engine
 
 const (
-	pawnValue   = 100
-	knightValue = 325
-	bishopValue = 325
-	rookValue   = 500
-	queenValue  = 1050
-	kingValue   = 40000
+	kingValue = 40000
 
-	evalPenaltyDoublePawn    = -8
 	evalBonusCasteling       = 16
-	evalBonusCheck           = 50
 	evalBonusEndgamePawnMove = 50
 	evalEndGameLevel         = 1500
 	evalMateSearchLevel      = 600
@@ -20,6 +13,18 @@ const (
 	scoreDraw = 0
 )
 
+// tunable evaluation weights, see params.go
+var (
+	pawnValue   = 100
+	knightValue = 325
+	bishopValue = 325
+	rookValue   = 500
+	queenValue  = 1050
+
+	evalPenaltyDoublePawn = -8
+	evalBonusCheck        = 50
+)
+
 var (
 	flipTable = []int{
 		112, 113, 114, 115, 116, 117, 118, 119, 0, 0, 0, 0, 0, 0, 0, 0,
@@ -112,77 +117,130 @@ var (
 
 // Evaluate the score of a given board
 func Evaluate(b *Board) int {
+	if b.variant != nil {
+		return b.variant.evaluate(b)
+	}
+	return evaluateStandard(b)
+}
+
+// evaluateStandard is the evaluation of standard chess, which the variants
+// may adjust
+func evaluateStandard(b *Board) int {
+	if activeNetwork != nil {
+		return evaluateNetwork(b)
+	}
+	return evaluateClassic(b)
+}
 
-	scoreWhite := 0
-	scoreBlack := 0
+// terms of the handcrafted evaluation, each is summed up per color index
+const (
+	termMaterial = iota
+	termPieces
+	termKings
+	termCheck
+	numTerms
+)
 
-	materialWhite := 0
-	materialBlack := 0
+var termNames = [numTerms]string{"material", "pieces", "kings", "check"}
+
+// evalTerm is a part of the evaluation from white's point of view
+type evalTerm struct {
+	name         string
+	white, black int
+}
+
+// evaluateClassic is the handcrafted evaluation
+func evaluateClassic(b *Board) int {
+	terms := classicTerms(b)
+	score := 0
+	for _, term := range terms {
+		score += term[0] - term[1]
+	}
+	return int(b.sideToMove) * score
+}
+
+// classicTerms computes the terms of the handcrafted evaluation
+func classicTerms(b *Board) [numTerms][2]int {
+	var terms [numTerms][2]int
+	material, pieces := &terms[termMaterial], &terms[termPieces]
 
 	for rank := int8(0); rank < size; rank++ {
 		for file := int8(0); file < size; file++ {
 			sq := square(rank, file)
 			switch b.data[sq] {
 			case WhitePawn:
-				materialWhite += pawnValue
-				scoreWhite += evaluatePawn(b, sq)
+				material[0] += pawnValue
+				pieces[0] += evaluatePawn(b, sq)
 			case WhiteKnight:
-				materialWhite += knightValue
-				scoreWhite += evaluateKnight(b, sq)
+				material[0] += knightValue
+				pieces[0] += evaluateKnight(b, sq)
 			case WhiteBishop:
-				materialWhite += bishopValue
-				scoreWhite += evaluateBishop(b, sq)
+				material[0] += bishopValue
+				pieces[0] += evaluateBishop(b, sq)
 			case WhiteRook:
-				materialWhite += rookValue
-				scoreWhite += evaluateRook(b, sq)
+				material[0] += rookValue
+				pieces[0] += evaluateRook(b, sq)
 			case WhiteQueen:
-				materialWhite += queenValue
-				scoreWhite += evaluateQueen(b, sq)
+				material[0] += queenValue
+				pieces[0] += evaluateQueen(b, sq)
 			case BlackPawn:
-				materialBlack += pawnValue
-				scoreBlack += evaluatePawn(b, sq)
+				material[1] += pawnValue
+				pieces[1] += evaluatePawn(b, sq)
 			case BlackKnight:
-				materialBlack += knightValue
-				scoreBlack += evaluateKnight(b, sq)
+				material[1] += knightValue
+				pieces[1] += evaluateKnight(b, sq)
 			case BlackBishop:
-				materialBlack += bishopValue
-				scoreBlack += evaluateBishop(b, sq)
+				material[1] += bishopValue
+				pieces[1] += evaluateBishop(b, sq)
 			case BlackRook:
-				materialBlack += rookValue
-				scoreBlack += evaluateRook(b, sq)
+				material[1] += rookValue
+				pieces[1] += evaluateRook(b, sq)
 			case BlackQueen:
-				materialBlack += queenValue
-				scoreBlack += evaluateQueen(b, sq)
+				material[1] += queenValue
+				pieces[1] += evaluateQueen(b, sq)
 			}
 		}
 	}
 
 	// mate level?
-	if materialWhite <= evalMateSearchLevel || materialBlack <= evalMateSearchLevel {
-		generator := NewGenerator(b)
-
-		if generator.CheckSimple() {
+	if material[0] <= evalMateSearchLevel || material[1] <= evalMateSearchLevel {
+		if b.InCheck() {
 			// if white is to move, black just made a check move
 			if b.sideToMove == White {
-				scoreBlack += evalBonusCheck
+				terms[termCheck][1] += evalBonusCheck
 			} else {
-				scoreWhite += evalBonusCheck
+				terms[termCheck][0] += evalBonusCheck
 			}
 		}
 	}
 
 	// evaluate kings
-	scoreWhite += evaluateKing(b, int8(b.whiteKingPosition), materialWhite, materialBlack)
-	scoreBlack += evaluateKing(b, int8(b.blackKingPosition), materialWhite, materialBlack)
+	terms[termKings][0] = evaluateKing(b, int8(b.whiteKingPosition), material[0], material[1])
+	terms[termKings][1] = evaluateKing(b, int8(b.blackKingPosition), material[0], material[1])
 
-	// special moves
+	return terms
+}
 
-	// casteling bonus
+// traceEvaluation lists the terms of the evaluation, a network or the
+// adjustments of a variant are a single term each
+func traceEvaluation(b *Board) []evalTerm {
+	trace := []evalTerm{}
+	standard := 0
 
-	scoreWhite += materialWhite
-	scoreBlack += materialBlack
+	if activeNetwork != nil {
+		standard = int(b.sideToMove) * evaluateNetwork(b)
+		trace = append(trace, evalTerm{name: "network", white: standard})
+	} else {
+		for i, term := range classicTerms(b) {
+			standard += term[0] - term[1]
+			trace = append(trace, evalTerm{name: termNames[i], white: term[0], black: term[1]})
+		}
+	}
 
-	return int(b.sideToMove) * (scoreWhite - scoreBlack)
+	if b.variant != nil {
+		trace = append(trace, evalTerm{name: b.variant.Name(), white: int(b.sideToMove)*Evaluate(b) - standard})
+	}
+	return trace
 }
 
 func evaluateKing(b *Board, sq int8, materialWhite int, materialBlack int) int {
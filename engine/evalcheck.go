@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// EvalFailure describes a position for which the evaluation is inconsistent
+type EvalFailure struct {
+	FEN    string
+	Reason string
+}
+
+func (f EvalFailure) String() string {
+	return fmt.Sprintf("%s: %s", f.FEN, f.Reason)
+}
+
+// CheckEvaluation verifies the evaluation of the given positions
+//
+// For every position the score has to be the same for the color flipped
+// board (ranks mirrored, colors and side to move swapped), and for the left
+// right mirrored board where all involved piece square tables are symmetric
+// and no castling rights are left. Making and undoing any legal move must
+// neither change the score nor the position itself.
+func CheckEvaluation(fens []string) []EvalFailure {
+	failures := []EvalFailure{}
+
+	for _, fen := range fens {
+		b, err := parseFEN(fen)
+		if err != nil {
+			failures = append(failures, EvalFailure{fen, err.Error()})
+			continue
+		}
+		failures = append(failures, checkEvaluation(b)...)
+	}
+
+	return failures
+}
+
+func checkEvaluation(b *Board) []EvalFailure {
+	failures := []EvalFailure{}
+	fen := generateFEN(b)
+	score := Evaluate(b)
+
+	// scores are relative to the side to move, so swapping colors and side
+	// negates the score from white's point of view
+	if flipped := Evaluate(flipBoard(b)); flipped != score {
+		failures = append(failures, EvalFailure{fen,
+			fmt.Sprintf("color flip scores %d instead of %d", flipped, score)})
+	}
+
+	if mirrorApplicable(b) {
+		if mirrored := Evaluate(mirrorBoard(b)); mirrored != score {
+			failures = append(failures, EvalFailure{fen,
+				fmt.Sprintf("left-right mirror scores %d instead of %d", mirrored, score)})
+		}
+	}
+
+	hash := b.currentHash
+	for _, move := range NewGenerator(b).GenerateMoves() {
+		b.MakeMove(move)
+		b.UndoMove()
+
+		if after := Evaluate(b); after != score {
+			failures = append(failures, EvalFailure{fen,
+				fmt.Sprintf("%s scores %d instead of %d after undo", move, after, score)})
+		}
+
+		if after := generateFEN(b); after != fen || b.currentHash != hash {
+			failures = append(failures, EvalFailure{fen,
+				fmt.Sprintf("%s leaves %s after undo", move, after)})
+		}
+	}
+
+	return failures
+}
+
+// flipBoard mirrors the ranks of a board and swaps the colors
+func flipBoard(b *Board) *Board {
+	f := &Board{
+		sideToMove:    opponent(b.sideToMove),
+		whiteCastle:   b.blackCastle,
+		blackCastle:   b.whiteCastle,
+		enPassant:     Invalid,
+		halfMoveClock: b.halfMoveClock,
+		fullMoves:     b.fullMoves,
+		castling:      b.castling.flip(),
+		zobristTable:  b.zobristTable,
+	}
+
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			f.data[square(size-1-rank, file)] = -b.data[square(rank, file)]
+		}
+	}
+
+	if b.enPassant != Invalid {
+		f.enPassant = Square(square(size-1-rank(int8(b.enPassant)), file(int8(b.enPassant))))
+	}
+
+	f.whiteKingPosition = Square(square(size-1-rank(int8(b.blackKingPosition)), file(int8(b.blackKingPosition))))
+	f.blackKingPosition = Square(square(size-1-rank(int8(b.whiteKingPosition)), file(int8(b.whiteKingPosition))))
+	f.currentHash = f.generateHash()
+
+	return f
+}
+
+// mirrorBoard mirrors the files of a board, castling rights are dropped
+func mirrorBoard(b *Board) *Board {
+	m := &Board{
+		sideToMove:    b.sideToMove,
+		enPassant:     Invalid,
+		halfMoveClock: b.halfMoveClock,
+		fullMoves:     b.fullMoves,
+		castling:      standardCastling,
+		zobristTable:  b.zobristTable,
+	}
+
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			m.data[square(rank, size-1-file)] = b.data[square(rank, file)]
+		}
+	}
+
+	if b.enPassant != Invalid {
+		m.enPassant = Square(square(rank(int8(b.enPassant)), size-1-file(int8(b.enPassant))))
+	}
+
+	m.whiteKingPosition = Square(square(rank(int8(b.whiteKingPosition)), size-1-file(int8(b.whiteKingPosition))))
+	m.blackKingPosition = Square(square(rank(int8(b.blackKingPosition)), size-1-file(int8(b.blackKingPosition))))
+	m.currentHash = m.generateHash()
+
+	return m
+}
+
+// mirrorApplicable tells whether a left-right mirrored board has to score
+// the same: castling is not symmetric and neither are some of the piece
+// square tables
+func mirrorApplicable(b *Board) bool {
+	if b.whiteCastle != castleNone || b.blackCastle != castleNone {
+		return false
+	}
+
+	tables := map[int8][][]int{
+		Pawn:   {pawnTable},
+		Knight: {knightTable},
+		Bishop: {bishopTable},
+		Rook:   {rookTable},
+		Queen:  {queenTable},
+		King:   {kingTableMiddle, kingTableEnd},
+	}
+
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			piece := abs(b.data[square(rank, file)])
+			if piece == Empty {
+				continue
+			}
+			for _, table := range tables[piece] {
+				if !symmetricTable(table) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+func symmetricTable(table []int) bool {
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size/2; file++ {
+			if table[square(rank, file)] != table[square(rank, size-1-file)] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// randomPositions plays random games from the given positions and returns
+// the FEN of every position reached
+func randomPositions(fens []string, games, plies int, seed int64) []string {
+	r := rand.New(rand.NewSource(seed))
+	positions := []string{}
+
+	for _, fen := range fens {
+		for game := 0; game < games; game++ {
+			b := NewBoard(fen)
+			for ply := 0; ply < plies; ply++ {
+				moves := NewGenerator(b).GenerateMoves()
+				if len(moves) == 0 {
+					break
+				}
+				b.MakeMove(moves[r.Intn(len(moves))])
+				positions = append(positions, generateFEN(b))
+			}
+		}
+	}
+
+	return positions
+}
+
+// readPositions reads the FEN of every line of an EPD or FEN file
+func readPositions(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fens := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		fens = append(fens, strings.Join(fields[:4], " "))
+	}
+
+	return fens, scanner.Err()
+}
+
+// EvalCheck runs CheckEvaluation on the positions of a file, or on random
+// positions if no file is given, and prints the offending FENs
+func EvalCheck(path string) error {
+	fens := []string{}
+
+	if path != "" {
+		var err error
+		if fens, err = readPositions(path); err != nil {
+			return err
+		}
+	} else {
+		fens = randomPositions([]string{defaultFEN, position2FEN}, 50, 80, 4711)
+	}
+
+	failures := CheckEvaluation(fens)
+	for _, f := range failures {
+		fmt.Printf("%s\n", f)
+	}
+	fmt.Printf("%d positions checked, %d failures\n", len(fens), len(failures))
+
+	return nil
+}
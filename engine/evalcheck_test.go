@@ -0,0 +1,28 @@
+package engine
+
+import "testing"
+
+func TestEvaluationSymmetry(t *testing.T) {
+	games := 20
+	if testing.Short() {
+		games = 2
+	}
+
+	fens := randomPositions([]string{defaultFEN, position2FEN, "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - -"}, games, 80, 4711)
+
+	for _, f := range CheckEvaluation(fens) {
+		t.Errorf("%s\n", f)
+	}
+}
+
+func TestFlipBoardTwiceRestoresPosition(t *testing.T) {
+	for _, fen := range []string{defaultFEN, position2FEN, "8/8/1k6/2b5/2pP4/8/5K2/8 b - d3 0 1"} {
+		b := NewBoard(fen)
+		if actual := generateFEN(flipBoard(flipBoard(b))); actual != generateFEN(b) {
+			t.Errorf("Expected %s but got %s\n", generateFEN(b), actual)
+		}
+		if actual := generateFEN(mirrorBoard(mirrorBoard(b))); b.whiteCastle|b.blackCastle == castleNone && actual != generateFEN(b) {
+			t.Errorf("Expected %s but got %s\n", generateFEN(b), actual)
+		}
+	}
+}
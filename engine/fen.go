@@ -24,6 +24,9 @@ func generateFEN(board *Board) string {
 					count = 0
 				}
 				fen += pieceString(board.data[square(rank, file)])
+				if board.promoted&bit(square(rank, file)) != 0 {
+					fen += "~"
+				}
 			} else {
 				count++
 			}
@@ -37,6 +40,11 @@ func generateFEN(board *Board) string {
 		}
 	}
 
+	// pieces in hand in Crazyhouse
+	if board.variant != nil && board.variant.rules().drops {
+		fen += pocketField(board)
+	}
+
 	fen += " "
 
 	// side to move
@@ -49,26 +57,7 @@ func generateFEN(board *Board) string {
 	fen += " "
 
 	// casteling
-
-	if board.whiteCastle&castleShort != 0 {
-		fen += "K"
-	}
-
-	if board.whiteCastle&castleLong != 0 {
-		fen += "Q"
-	}
-
-	if board.blackCastle&castleShort != 0 {
-		fen += "k"
-	}
-
-	if board.blackCastle&castleLong != 0 {
-		fen += "q"
-	}
-
-	if (board.whiteCastle<<2 | board.blackCastle) == 0 {
-		fen += "-"
-	}
+	fen += castlingField(board)
 
 	fen += " "
 
@@ -82,6 +71,12 @@ func generateFEN(board *Board) string {
 
 	fen += " "
 
+	// remaining checks in Three-check
+
+	if board.variant != nil && board.variant.rules().countChecks {
+		fen += fmt.Sprintf("%d+%d ", threeCheckWin-board.checks[0], threeCheckWin-board.checks[1])
+	}
+
 	// fifty moves count
 
 	fen += fmt.Sprintf("%d", board.halfMoveClock)
@@ -98,6 +93,8 @@ func parseFEN(fen string) (*Board, error) {
 	board := Board{}
 	board.enPassant = Invalid
 	board.fullMoves = 1
+	board.zobristTable = defaultZobristTable
+	board.castling = standardCastling
 
 	for i := boardSize - 1; i >= 0; i-- {
 		board.data[i] = Empty
@@ -109,10 +106,22 @@ func parseFEN(fen string) (*Board, error) {
 		return &board, errors.New("invalid FEN")
 	}
 
-	// parts[0]: piece placement
+	// parts[0]: piece placement, in Crazyhouse followed by the pieces in
+	// hand in brackets or as ninth rank
+	placement, pocket := parts[0], ""
+	if k := strings.IndexByte(placement, '['); k >= 0 && strings.HasSuffix(placement, "]") {
+		placement, pocket = placement[:k], placement[k+1:len(placement)-1]
+	} else if strings.Count(placement, "/") == 8 {
+		k := strings.LastIndexByte(placement, '/')
+		placement, pocket = placement[:k], placement[k+1:]
+	}
+	if err := parsePocket(&board, pocket); err != nil {
+		return &board, err
+	}
+
 	i := 0
-	for j := 0; j < len(parts[0]); j++ {
-		switch parts[0][j] {
+	for j := 0; j < len(placement); j++ {
+		switch placement[j] {
 		case 'p':
 			board.data[board64square[i]] = BlackPawn
 		case 'r':
@@ -139,6 +148,13 @@ func parseFEN(fen string) (*Board, error) {
 		case 'K':
 			board.data[board64square[i]] = WhiteKing
 			board.whiteKingPosition = Square(board64square[i])
+		case '~':
+			// the piece before was promoted
+			if i == 0 || board.data[board64square[i-1]] == Empty {
+				return &board, errors.New("invalid FEN")
+			}
+			board.promoted |= bit(int8(board64square[i-1]))
+			i--
 		case '/':
 			i--
 		case '1':
@@ -164,6 +180,12 @@ func parseFEN(fen string) (*Board, error) {
 		i++
 	}
 
+	if pocket != "" || board.promoted != 0 {
+		if err := checkPocketMaterial(&board); err != nil {
+			return &board, err
+		}
+	}
+
 	// parts[1]: active color
 	if parts[1] == "w" {
 		board.sideToMove = White
@@ -172,20 +194,8 @@ func parseFEN(fen string) (*Board, error) {
 	}
 
 	// parts[2]:casteling availability
-	if strings.Contains(parts[2], "k") {
-		board.blackCastle |= castleShort
-	}
-
-	if strings.Contains(parts[2], "q") {
-		board.blackCastle |= castleLong
-	}
-
-	if strings.Contains(parts[2], "K") {
-		board.whiteCastle |= castleShort
-	}
-
-	if strings.Contains(parts[2], "Q") {
-		board.whiteCastle |= castleLong
+	if err := parseCastling(&board, parts[2]); err != nil {
+		return &board, err
 	}
 
 	// parts[3]: en passant target square
@@ -195,6 +205,11 @@ func parseFEN(fen string) (*Board, error) {
 
 	// optionals:
 
+	parts, err := parseChecks(&board, parts)
+	if err != nil {
+		return &board, err
+	}
+
 	// parts[4]: halfmove clock (fifty move rule)
 	if len(parts) >= 5 {
 		board.halfMoveClock, _ = strconv.Atoi(parts[4])
@@ -206,5 +221,65 @@ func parseFEN(fen string) (*Board, error) {
 		board.fullMoves = fullMoves
 	}
 
+	board.currentHash = board.generateHash()
+
 	return &board, nil
 }
+
+// parseChecks reads the counts of Three-check, either the remaining checks
+// after the en passant square (3+3) or the checks given at the end (+0+0),
+// and returns the other parts
+func parseChecks(board *Board, parts []string) ([]string, error) {
+	rest := append([]string{}, parts[:4]...)
+	for _, part := range parts[4:] {
+		if !strings.Contains(part, "+") {
+			rest = append(rest, part)
+			continue
+		}
+
+		counts := strings.Split(strings.TrimPrefix(part, "+"), "+")
+		if len(counts) != 2 {
+			return rest, errors.New("invalid FEN: invalid check counts")
+		}
+		for i, count := range counts {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 || n > threeCheckWin {
+				return rest, errors.New("invalid FEN: invalid check counts")
+			}
+			if !strings.HasPrefix(part, "+") {
+				n = threeCheckWin - n
+			}
+			board.checks[i] = int8(n)
+		}
+	}
+	return rest, nil
+}
+
+// validatePosition rejects positions which parseFEN reads but which can't
+// occur: each side needs a king, except in Antichess, pawns can't stand on
+// the first or last rank and the side not to move can't be in check
+func validatePosition(b *Board) error {
+	kings := [2]int{}
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			piece := b.data[square(rank, file)]
+			if abs(piece) == Pawn && (rank == 0 || rank == size-1) {
+				return errors.New("invalid FEN: pawn on the first or last rank")
+			}
+			if abs(piece) == King {
+				kings[colorIndex(pieceColor(piece))]++
+			}
+		}
+	}
+
+	if b.variant != nil && b.variant.rules().noCheck {
+		return nil
+	}
+	if kings != [2]int{1, 1} {
+		return errors.New("invalid FEN: each side needs one king")
+	}
+	if b.IsSquareAttacked(b.kingSquare(opponent(b.sideToMove)), b.sideToMove) {
+		return errors.New("invalid FEN: the side not to move is in check")
+	}
+	return nil
+}
@@ -3,19 +3,36 @@ package engine
 import (
 	"bufio"
 	"fmt"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Game represents a gochess game
 type Game struct {
-	board *Board
+	board     *Board
+	session   string // saved after every move
+	timed     bool
+	clocks    [2]time.Duration // by color index
+	base      time.Duration
+	increment time.Duration
+	turnStart time.Time
+	network   string            // file of the network in use
+	params    map[string]string // set during the game
+	db        *Database         // opened with "db"
+	tt        *TranspositionTable
 }
 
+// gameListLimit is the number of games listed by "games"
+const gameListLimit = 20
+
 // NewGame creates a new gochess game and returns a reference
 func NewGame() *Game {
 	g := new(Game)
 	g.board = NewBoard(defaultFEN)
+	g.params = map[string]string{}
 
 	return g
 }
@@ -24,6 +41,12 @@ func NewGame() *Game {
 func (g *Game) Run() {
 
 	scanner := bufio.NewScanner(os.Stdin)
+	if sessions, err := Sessions(); err == nil && len(sessions) > 0 {
+		fmt.Printf("last session: %s (resume to continue, sessions to list all)\n", sessions[0].Name)
+	}
+	if g.session == "" {
+		g.session = defaultSession
+	}
 	fmt.Printf("> ")
 
 	for scanner.Scan() {
@@ -33,6 +56,12 @@ func (g *Game) Run() {
 		if in == "quit" || in == "q" {
 			break
 
+		} else if in == "uci" {
+			u := newUCIServer(os.Stdout)
+			u.command([]string{"uci"})
+			u.run(scanner)
+			return
+
 		} else if in == "moves" || in == "m" {
 			gen := NewGenerator(g.board)
 			printMoves(gen.GenerateMoves())
@@ -43,56 +72,110 @@ func (g *Game) Run() {
 		} else if in == "perft2" {
 			Perft(position2FEN, position2Table)
 
+		} else if strings.HasPrefix(in, "perftsuite ") {
+			g.perftSuite(strings.Fields(in))
+
+		} else if strings.HasPrefix(in, "perft ") || strings.HasPrefix(in, "divide ") {
+			g.perft(strings.Fields(in))
+
 		} else if in == "new" || in == "n" {
-			g.board = NewBoard(defaultFEN)
+			g.setBoard(NewBoard(defaultFEN))
+
+		} else if in == "chess960" || strings.HasPrefix(in, "chess960 ") {
+			g.chess960(strings.Fields(in))
+
+		} else if in == "variant" || strings.HasPrefix(in, "variant ") {
+			g.variant(strings.Fields(in))
 
 		} else if in == "fen" || in == "f" {
 			fmt.Printf("%s\n", generateFEN(g.board))
 
 		} else if in == "undo" || in == "u" {
 			g.board.UndoMove()
+			g.autosave()
 
 		} else if strings.HasPrefix(in, "fen ") {
-			g.board = NewBoard(in[4:])
+			if b, err := NewVariantBoard(g.board.variantName(), in[4:]); err != nil {
+				fmt.Printf("%v\n", err)
+			} else {
+				g.setBoard(b)
+			}
 
 		} else if in == "print" || in == "p" {
 			fmt.Printf("%s\n", formatBoard(g.board))
 
 		} else if in == "search" || in == "s" {
-			Search(g.board)
+			g.search()
 
 		} else if in == "do" || in == "d" {
-			g.board.MakeMove(Search(g.board))
+			g.play(g.search())
 			fmt.Printf("%s\n", formatBoard(g.board))
 
 		} else if in == "eval" || in == "e" {
 			fmt.Printf("Score: %d\n", Evaluate(g.board))
 
-		} else if in == "auto" || in == "a" {
-			for g.board.status == statusNormal {
-				g.board.MakeMove(Search(g.board))
-				fmt.Printf("%s\n", formatBoard(g.board))
+		} else if in == "evalcheck" || strings.HasPrefix(in, "evalcheck ") {
+			if err := EvalCheck(strings.TrimSpace(in[len("evalcheck"):])); err != nil {
+				fmt.Printf("%v\n", err)
 			}
 
-		} else if m, err := createMove(in); err == nil {
-			gen := NewGenerator(g.board)
-			moves := gen.GenerateMoves()
-
-			found := Move{From: Invalid}
+		} else if in == "nnue off" {
+			UseNetwork(nil)
+			g.network = ""
+			g.autosave()
 
-			for _, move := range moves {
-				if move.From == m.From && move.To == m.To {
-					found = move
-					break
-				}
+		} else if strings.HasPrefix(in, "nnue ") {
+			if n, err := LoadNetwork(in[5:]); err != nil {
+				fmt.Printf("%v\n", err)
+			} else {
+				UseNetwork(n)
+				g.network = in[5:]
+				g.autosave()
 			}
 
-			if found.From != Invalid {
-				g.board.MakeMove(found)
+		} else if strings.HasPrefix(in, "set ") {
+			fields := strings.Fields(in)
+			if len(fields) < 3 {
+				fmt.Printf("usage: set <name> <value>\n")
+			} else if err := SetParam(fields[1], strings.Join(fields[2:], " ")); err != nil {
+				fmt.Printf("%v\n", err)
 			} else {
-				fmt.Printf("illegal move\n")
+				g.params[fields[1]] = strings.Join(fields[2:], " ")
+				g.autosave()
+			}
+
+		} else if in == "clock" || strings.HasPrefix(in, "clock ") {
+			g.clock(strings.Fields(in))
+
+		} else if in == "save" || strings.HasPrefix(in, "save ") {
+			if err := g.Save(strings.TrimSpace(in[4:])); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+
+		} else if in == "resume" || strings.HasPrefix(in, "resume ") || in == "load" || strings.HasPrefix(in, "load ") {
+			g.resume(strings.Fields(in))
+
+		} else if in == "sessions" {
+			printSessions()
+
+		} else if strings.HasPrefix(in, "db ") {
+			g.openDatabase(strings.TrimSpace(in[3:]))
+
+		} else if in == "explore" || in == "games" {
+			g.queryDatabase(in)
+
+		} else if in == "auto" || in == "a" {
+			for g.board.updateStatus(); !g.board.gameOver(); {
+				g.play(g.search())
+				fmt.Printf("%s\n", formatBoard(g.board))
 			}
 
+		} else if m, err := parseSAN(g.board, in); err == nil {
+			g.play(m)
+
+		} else if _, err := createMove(in); err == nil {
+			fmt.Printf("illegal move\n")
+
 		} else {
 			fmt.Printf("invalid input\n")
 		}
@@ -100,3 +183,203 @@ func (g *Game) Run() {
 		fmt.Printf("> ")
 	}
 }
+
+// play makes a move, charges its time to the clock of the mover and saves
+// the session
+func (g *Game) play(m Move) {
+	if g.timed {
+		side := colorIndex(g.board.sideToMove)
+		if g.clocks[side] -= time.Since(g.turnStart); g.clocks[side] < 0 {
+			fmt.Printf("%s is out of time\n", colorName(g.board.sideToMove))
+			g.clocks[side] = 0
+		}
+		g.clocks[side] += g.increment
+		g.turnStart = time.Now()
+	}
+
+	g.board.MakeMove(m)
+	g.board.updateStatus()
+	g.autosave()
+}
+
+// search finds the engine's move, with clocks the time is planned like in
+// a match. The transposition table is kept for the next move.
+func (g *Game) search() Move {
+	limits := SearchLimits{Time: searchMaxTime, TT: gameTable(&g.tt)}
+	if g.timed {
+		clock := g.clocks[colorIndex(g.board.sideToMove)] - time.Since(g.turnStart)
+		limits.Time = planTime(clock, g.increment)
+	}
+	return search(g.board, limits, searchVerbose).Move
+}
+
+// setBoard starts a game from the given board, the clocks are reset. The
+// game of a named session is left as it is, the new one is saved to the
+// default session.
+func (g *Game) setBoard(b *Board) {
+	g.board = b
+	if g.session != "" {
+		g.session = defaultSession
+	}
+	if g.tt != nil {
+		g.tt.Clear()
+	}
+	g.clocks = [2]time.Duration{g.base, g.base}
+	g.turnStart = time.Now()
+	g.autosave()
+}
+
+// clock runs "clock [<base>+<increment>|off]", which sets the clocks of
+// both sides or shows the time left
+func (g *Game) clock(fields []string) {
+	if len(fields) < 2 {
+		if !g.timed {
+			fmt.Printf("no clocks\n")
+			return
+		}
+		clocks := g.clocks
+		clocks[colorIndex(g.board.sideToMove)] -= time.Since(g.turnStart)
+		fmt.Printf("white %v black %v\n", clocks[0].Round(time.Second/10), clocks[1].Round(time.Second/10))
+		return
+	}
+
+	if fields[1] == "off" {
+		g.timed, g.base, g.increment = false, 0, 0
+	} else {
+		base, increment, err := parseTimeControl(fields[1])
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		g.timed, g.base, g.increment = true, base, increment
+		g.clocks = [2]time.Duration{base, base}
+		g.turnStart = time.Now()
+	}
+	g.autosave()
+}
+
+// openDatabase runs "db <dir>", which opens the database queried by
+// "explore" and "games"
+func (g *Game) openDatabase(dir string) {
+	db, err := OpenDatabase(dir)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if g.db != nil {
+		g.db.Close()
+	}
+	g.db = db
+	fmt.Printf("%d games\n", db.Count())
+}
+
+// queryDatabase lists the moves played in the current position or the
+// games that reached it
+func (g *Game) queryDatabase(command string) {
+	if g.db == nil {
+		fmt.Printf("no database, open one with \"db <dir>\"\n")
+		return
+	}
+	if command == "explore" {
+		printMoveStats(g.db.Explore(g.board))
+		return
+	}
+
+	games, err := g.db.Find(g.board, gameListLimit)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	printDatabaseGames(games)
+}
+
+// perft runs "perft <depth> [fen]" or "divide <depth> [fen]" on the current
+// board or the given position
+func (g *Game) perft(fields []string) {
+	depth := -1
+	if len(fields) > 1 {
+		if d, err := strconv.Atoi(fields[1]); err == nil {
+			depth = d
+		}
+	}
+	if depth < 0 {
+		fmt.Printf("usage: %s <depth> [fen]\n", fields[0])
+		return
+	}
+
+	board := g.board
+	if len(fields) > 2 {
+		var err error
+		if board, err = parseFEN(strings.Join(fields[2:], " ")); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+	}
+
+	printPerftResult(RunPerft(board, depth, 0), fields[0] == "divide")
+}
+
+// chess960 runs "chess960 [index]" and starts a game from the Chess960
+// start position of the given or a random index
+func (g *Game) chess960(fields []string) {
+	index := rand.Intn(chess960Positions)
+	if len(fields) > 1 {
+		var err error
+		if index, err = strconv.Atoi(fields[1]); err != nil {
+			index = -1
+		}
+	}
+
+	b, err := NewChess960Board(index)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	g.setBoard(b)
+	fmt.Printf("%s\n", generateFEN(b))
+}
+
+// variant runs "variant [name]", which starts a game of a variant or
+// lists them
+func (g *Game) variant(fields []string) {
+	if len(fields) < 2 {
+		fmt.Printf("%s (variants: %s)\n", g.board.variantName(), strings.Join(variantNames(), ", "))
+		return
+	}
+
+	b, err := NewVariantBoard(fields[1], "")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	g.setBoard(b)
+	fmt.Printf("%s\n", generateFEN(b))
+}
+
+// perftSuite runs "perftsuite <file> [depth] [threads]", the depth limits
+// the counts checked per position, the threads count each perft
+func (g *Game) perftSuite(fields []string) {
+	options := PerftSuiteOptions{}
+	if len(fields) > 2 {
+		if d, err := strconv.Atoi(fields[2]); err == nil && d > 0 {
+			options.MaxDepth = d
+		} else {
+			fields = nil
+		}
+	}
+	if len(fields) > 3 {
+		if n, err := strconv.Atoi(fields[3]); err == nil && n > 0 {
+			options.Threads = n
+		} else {
+			fields = nil
+		}
+	}
+	if len(fields) < 2 || len(fields) > 4 {
+		fmt.Printf("usage: perftsuite <file> [depth] [threads]\n")
+		return
+	}
+
+	if err := PerftSuite(fields[1], options); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
@@ -26,41 +26,43 @@ var (
 	whitePawnStartPos int8 = 1 // rank 2
 	blackPawnStartPos int8 = 6 // rank 7
 
-	castleShortDistanceRook int8 = 3
-	castleLongDistanceRook  int8 = 4
-
-	whiteKingStartSquare = E1
-	blackKingStartSquare = E8
-	whiteRookShortSquare = A1
-	whiteRookLongSquare  = H1
-	blackRookShortSquare = A8
-	blackRookLongSquare  = H8
-)
-
-// squares that need to be empty and not under check for castling
-var (
-	shortWhiteSquares = []Square{F1, G1}
-	longWhiteSquares  = []Square{B1, C1, D1}
-	shortBlackSquares = []Square{F8, G8}
-	longBlackSquares  = []Square{B8, C8, D8}
+	promotionPieces     = []int8{Queen, Rook, Bishop, Knight}
+	promotionPiecesKing = []int8{Queen, Rook, Bishop, Knight, King}
 )
 
 const (
 	boardSize int8 = 120
 	size      int8 = 8
+
+	maxMoves = 256 // more moves than possible in any position
 )
 
+// move filters of the generator
+const (
+	generateAll int8 = iota
+	generateCaptures
+	generateQuiets
+)
+
+// MoveBuffer holds the moves of a position, generating into a buffer
+// allocates no memory
+type MoveBuffer [maxMoves]Move
+
 // Generator creates possible moves for a given board position
 type Generator struct {
-	board                  *Board
-	legalEnding            []bool
-	legalDelta             []int8
-	lastMoveSquare         Square
-	moves                  []Move
-	kingSquare             int8
-	kingUnderCheck         bool
-	kingUnderCheckByKnight int8
-	isCheckMate            bool
+	board          *Board
+	lastMoveSquare Square
+	moves          []Move
+	buffer         *MoveBuffer
+	kingSquare     int8
+	kingUnderCheck bool
+	checkers       Bitboard
+	pinned         Bitboard
+	evasions       Bitboard // squares which capture or block a single checker
+	filter         int8
+	only           Square
+	over           bool // the variant's game is over, there are no moves
+	variantRules
 }
 
 // NewGenerator creates a new generator for a given board
@@ -73,28 +75,197 @@ func NewGenerator(board *Board) *Generator {
 
 // GenerateMoves creates a list of possible moves
 func (g *Generator) GenerateMoves() []Move {
+	g.prepare()
+	g.generate(generateAll, Invalid)
+	g.sortMoves()
+	return g.moves
+}
+
+// GenerateMovesInto creates the same list as GenerateMoves in a buffer
+func (g *Generator) GenerateMovesInto(buffer *MoveBuffer) []Move {
+	g.buffer = buffer
+	return g.GenerateMoves()
+}
+
+// GenerateCapturesInto creates the same list as GenerateCaptures in a
+// buffer
+func (g *Generator) GenerateCapturesInto(buffer *MoveBuffer) []Move {
+	g.buffer = buffer
+	return g.GenerateCaptures()
+}
 
-	g.reset()
+// GenerateQuietsInto creates the same list as GenerateQuiets in a buffer
+func (g *Generator) GenerateQuietsInto(buffer *MoveBuffer) []Move {
+	g.buffer = buffer
+	return g.GenerateQuiets()
+}
 
-	// generation
+// GenerateCaptures creates the captures, en passant captures and
+// promotions only
+func (g *Generator) GenerateCaptures() []Move {
+	g.prepare()
+	g.generate(generateCaptures, Invalid)
+	return g.moves
+}
 
-	threats := g.numberOfCheckThreats()
+// GenerateQuiets creates all moves which are not returned by
+// GenerateCaptures
+func (g *Generator) GenerateQuiets() []Move {
+	g.prepare()
+	g.generate(generateQuiets, Invalid)
+	return g.moves
+}
 
-	g.generateKingMoves(g.kingSquare)
+// GenerateQuietChecks creates the quiet moves which give check
+func (g *Generator) GenerateQuietChecks() []Move {
+	g.prepare()
+	g.generate(generateQuiets, Invalid)
+	g.filterChecks()
+	return g.moves
+}
 
-	// only legal move is moving the king ... else we have a mate
-	if threats > 1 {
-		g.sortMoves()
-		return g.moves
+// filterChecks keeps the generated moves giving check
+func (g *Generator) filterChecks() {
+	checks := g.moves[:0]
+	for _, move := range g.moves {
+		if g.givesCheck(move) {
+			checks = append(checks, move)
+		}
+	}
+	g.moves = checks
+}
+
+// IsLegal tells whether a move, e.g. taken from a hash table, is legal in
+// the current position
+func (g *Generator) IsLegal(m Move) bool {
+	g.prepare()
+	return g.isLegal(m)
+}
+
+// isLegal requires the generator to be prepared and overwrites g.moves
+func (g *Generator) isLegal(m Move) bool {
+	if m.Special == moveDrop {
+		if !g.board.legalSquare(int8(m.To)) || m.From != m.To || g.board.data[m.To] != Empty {
+			return false
+		}
+	} else if !g.board.legalSquare(int8(m.From)) || g.board.data[m.From] != m.MovedPiece || m.MovedPiece == Empty {
+		return false
+	}
+
+	g.generate(generateAll, m.From)
+	for _, move := range g.moves {
+		if move == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) givesCheck(m Move) bool {
+	g.board.MakeMove(m)
+	check := g.board.InCheck()
+	g.board.UndoMove()
+	return check
+}
+
+// prepare finds checks and pinned pieces, which is required before
+// generating moves
+func (g *Generator) prepare() {
+	b := g.board
+	g.variantRules, g.over = variantRules{}, false
+	if b.variant != nil {
+		g.variantRules, g.over = b.variant.rules(), b.variant.over(b)
+	}
+
+	g.lastMoveSquare = Invalid
+	if len(b.history) > 0 {
+		g.lastMoveSquare = b.history[len(b.history)-1].move.To
+	}
+
+	// without check the king moves like any other piece
+	if g.noCheck {
+		g.kingSquare = int8(Invalid)
+		g.checkers, g.kingUnderCheck, g.pinned, g.evasions = 0, false, 0, 0
+		return
+	}
+
+	g.kingSquare = int8(b.kingSquare(b.sideToMove))
+	g.checkers = b.Checkers()
+	g.kingUnderCheck = g.checkers != 0
+	g.pinned = b.Pinned(b.sideToMove)
+	g.evasions = 0
+
+	// a single check is evaded by capturing the checker or by blocking its
+	// line
+	if g.checkers.count() == 1 {
+		checker := int8(sq0x88(g.checkers.first()))
+		g.evasions = bit(checker)
+		if slides(b.data[checker], direction(checker, g.kingSquare)) {
+			delta := direction(g.kingSquare, checker)
+			for sq := g.kingSquare + delta; sq != checker; sq += delta {
+				g.evasions |= bit(sq)
+			}
+		}
+	}
+}
+
+// generate creates the moves matching the filter, optionally only the ones
+// starting on a given square
+func (g *Generator) generate(filter int8, only Square) {
+	if g.mustCapture() {
+		// the captures are all moves, there are no quiet ones
+		captures := g.moves[:0]
+		for _, move := range g.moves {
+			if move.Content != Empty && (only == Invalid || move.From == only) && filter != generateQuiets {
+				captures = append(captures, move)
+			}
+		}
+		g.moves = captures
+		return
+	}
+
+	g.generatePieces(filter, only)
+}
+
+// mustCapture tells whether a capture is compulsory, the generated moves
+// include the captures then
+func (g *Generator) mustCapture() bool {
+	if !g.forcedCaptures {
+		return false
+	}
+
+	g.generatePieces(generateCaptures, Invalid)
+	for _, move := range g.moves {
+		if move.Content != Empty {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) generatePieces(filter int8, only Square) {
+	if g.buffer != nil {
+		g.moves = g.buffer[:0]
+	} else {
+		g.moves = make([]Move, 0, 48)
 	}
+	g.filter = filter
+	g.only = only
 
-	if threats == 1 && g.kingUnderCheckByKnight != Empty {
-		g.generateCaptureMovesForOpponentKnight(g.kingUnderCheckByKnight)
-		g.sortMoves()
-		return g.moves
+	if g.over {
+		return
 	}
 
-	if threats == 0 {
+	if !g.noCheck && (only == Invalid || only == Square(g.kingSquare)) {
+		g.generateKingMoves()
+	}
+
+	// only legal move is moving the king ... else we have a mate
+	if g.checkers.count() > 1 {
+		return
+	}
+
+	if !g.noCheck && !g.kingUnderCheck && filter != generateCaptures && (only == Invalid || only == Square(g.kingSquare)) {
 		g.generateCastlingMoves()
 	}
 
@@ -105,6 +276,10 @@ func (g *Generator) GenerateMoves() []Move {
 			square := square(rank, file)
 			piece := g.board.data[square] * g.board.sideToMove
 
+			if only != Invalid && Square(square) != only {
+				continue
+			}
+
 			if piece > 0 {
 				switch piece {
 				case Pawn:
@@ -117,178 +292,144 @@ func (g *Generator) GenerateMoves() []Move {
 					g.generateGenericMoves(square, deltaQueen, false)
 				case Knight:
 					g.generateGenericMoves(square, deltaKnight, true)
+				case King:
+					if g.noCheck {
+						g.generateGenericMoves(square, deltaKing, true)
+					}
 				}
 			}
 
 		}
 	}
 
-	g.sortMoves()
-	return g.moves
+	if g.drops && filter != generateCaptures {
+		g.generateDrops(only)
+	}
 }
 
-// CheckSimple finds possible check attacks
-func (g *Generator) CheckSimple() bool {
-
-	g.reset()
+// generateDrops puts the pieces in hand on the empty squares, pawns not on
+// the first or last rank. A drop starts on its target square.
+func (g *Generator) generateDrops(only Square) {
+	b := g.board
+	pocket := &b.pockets[colorIndex(b.sideToMove)]
 
-	// check for knight attacks first
-	for _, delta := range deltaKnight {
-		to := g.kingSquare + delta
-		if g.board.legalSquare(to) && g.board.data[to]*opponent(g.board.sideToMove) == Knight {
-			return true
+	for piece := Pawn; piece <= Queen; piece++ {
+		if pocket[piece-1] == 0 {
+			continue
 		}
-	}
-
-	// check for all other pieces
-	for _, delta := range deltaAll {
-		depth := 0
-		for to := g.kingSquare + delta; g.board.legalSquare(to); to += delta {
-			depth++
-			found := g.board.data[to] * opponent(g.board.sideToMove)
-
-			// empty square, go ahead
-			if found == Empty {
+		for rank := int8(0); rank < size; rank++ {
+			if piece == Pawn && (rank == 0 || rank == size-1) {
 				continue
 			}
-
-			if found == Pawn || found == King {
-				if depth == 1 {
-					if g.attackPossible(to, opposite(delta)) {
-						return true
-					}
+			for file := int8(0); file < size; file++ {
+				sq := square(rank, file)
+				if b.data[sq] != Empty || (only != Invalid && Square(sq) != only) || !g.legalTarget(sq, sq) {
+					continue
 				}
-				break
-			}
-
-			// stop direction if own piece is found
-			if found < 0 {
-				break
+				g.addMove(Move{From: Square(sq), To: Square(sq), Special: moveDrop, MovedPiece: piece * b.sideToMove})
 			}
-
-			// found opponent
-			if g.attackPossible(to, delta) {
-				return true
-			}
-			break
 		}
 	}
-
-	return false
 }
 
-func (g *Generator) reset() {
-	g.moves = make([]Move, 0, 48)
-
-	g.kingUnderCheck = false
-	g.kingUnderCheckByKnight = Empty
+// CheckSimple tells whether the side to move is in check
+func (g *Generator) CheckSimple() bool {
+	return g.board.InCheck()
+}
 
-	g.kingSquare = int8(g.board.whiteKingPosition)
-	if g.board.sideToMove == Black {
-		g.kingSquare = int8(g.board.blackKingPosition)
+// sortMoves orders the moves in place: captures of the last moved piece,
+// other captures, promotions, castling and all other moves
+func (g *Generator) sortMoves() {
+	for i := 1; i < len(g.moves); i++ {
+		move := g.moves[i]
+		key := g.sortKey(move)
+		j := i
+		for ; j > 0 && g.sortKey(g.moves[j-1]) > key; j-- {
+			g.moves[j] = g.moves[j-1]
+		}
+		g.moves[j] = move
 	}
+}
 
-	g.legalEnding = make([]bool, boardSize)
-	g.legalDelta = make([]int8, boardSize)
-
-	if len(g.board.history) > 0 {
-		g.lastMoveSquare = g.board.history[len(g.board.history)-1].move.To
+func (g *Generator) sortKey(move Move) int {
+	switch {
+	case move.To == g.lastMoveSquare:
+		return 0
+	case move.Content != Empty:
+		return 1
+	case move.Special == movePromotion:
+		return 2
+	case move.Special == moveCastelingShort || move.Special == moveCastelingLong:
+		return 3
 	}
+	return 4
 }
 
-func (g *Generator) sortMoves() {
-	lastCapture := make([]Move, 0, len(g.moves))
-	sorted := make([]Move, 0, len(g.moves))
-	captured := make([]Move, 0, len(g.moves))
-	promotions := make([]Move, 0, len(g.moves))
-	castelings := make([]Move, 0, len(g.moves))
-	ordinary := make([]Move, 0, len(g.moves))
+func (g *Generator) addMove(move Move) {
+	if g.only != Invalid && move.From != g.only {
+		return
+	}
 
-	for _, move := range g.moves {
-		switch {
-		case move.To == g.lastMoveSquare:
-			lastCapture = append(lastCapture, move)
-		case move.Content != Empty:
-			captured = append(captured, move)
-		case move.Special == movePromotion:
-			promotions = append(promotions, move)
-		case move.Special == moveCastelingShort || move.Special == moveCastelingLong:
-			castelings = append(castelings, move)
-		default:
-			ordinary = append(ordinary, move)
+	switch g.filter {
+	case generateCaptures:
+		if isQuietMove(move) {
+			return
+		}
+	case generateQuiets:
+		if !isQuietMove(move) {
+			return
 		}
 	}
 
-	// 1. last moved piece capture
-	sorted = append(sorted, lastCapture...)
-
-	// 2. capture moves
-	sorted = append(sorted, captured...)
-
-	// 3.promotion moves
-	sorted = append(sorted, promotions...)
-
-	// 4.castling moves
-	sorted = append(sorted, castelings...)
-
-	// 5. normal moves
-	sorted = append(sorted, ordinary...)
-
-	g.moves = sorted
-}
-
-func (g *Generator) addMove(move Move) {
 	g.moves = append(g.moves, move)
 }
 
-func (g *Generator) generateKingMoves(square int8) {
-	to := int8(0)
-	for _, delta := range deltaKing {
-		to = square + delta
-		if g.board.legalSquare(to) {
-			move := g.createMove(square, to)
-			if move.MovedPiece == Empty {
-				continue
-			}
-
-			if len(g.findThreats(Square(to), g.board.sideToMove, true)) == 0 {
-				g.addMove(move)
-			}
-		}
+// legalTarget tells whether a piece other than the king may move to a
+// square: pinned pieces stay on the line to their king and checks have to
+// be evaded
+func (g *Generator) legalTarget(from, to int8) bool {
+	if g.kingUnderCheck && g.evasions&bit(to) == 0 {
+		return false
 	}
-
+	if g.pinned&bit(from) != 0 && direction(g.kingSquare, to) != direction(g.kingSquare, from) {
+		return false
+	}
+	return true
 }
 
-func (g *Generator) generateCaptureMovesForOpponentKnight(square int8) {
-	threats := g.findThreats(Square(square), opponent(g.board.sideToMove), false)
+func (g *Generator) generateKingMoves() {
+	b := g.board
+	king := b.data[g.kingSquare]
 
-	if len(threats) >= 0 {
-		for _, threat := range threats {
-			g.addMove(g.createMove(threat, square))
+	// the king must not hide behind itself from a slider
+	b.data[g.kingSquare] = Empty
+	for _, delta := range deltaKing {
+		to := g.kingSquare + delta
+		if b.legalSquare(to) && b.data[to]*king <= 0 && !b.IsSquareAttacked(Square(to), opponent(b.sideToMove)) {
+			b.data[g.kingSquare] = king
+			g.addMove(g.createMove(g.kingSquare, to))
+			b.data[g.kingSquare] = Empty
 		}
 	}
+	b.data[g.kingSquare] = king
 }
 
 func (g *Generator) generateGenericMoves(from int8, delta []int8, singleStep bool) {
 	for _, d := range delta {
 		for to := from + d; g.board.legalSquare(to); to += d {
-			move := g.createMove(from, to)
+			content := g.board.data[to]
 
 			// we are facing the same color; skip
-			if move.MovedPiece == Empty {
+			if content*g.board.sideToMove > 0 {
 				break
 			}
 
-			if g.legalDelta[from] == 0 || (g.legalDelta[from] == d || g.legalDelta[from] == opposite(d)) {
-				if !g.kingUnderCheck || g.legalEnding[to] {
-					g.addMove(move)
-				}
-			} else {
-				break
+			if g.legalTarget(from, to) {
+				g.addMove(g.createMove(from, to))
 			}
 
 			// this move was single step only or we captured a piece; no need to go further then
-			if singleStep || move.Content != Empty {
+			if singleStep || content != Empty {
 				break
 			}
 		}
@@ -296,326 +437,154 @@ func (g *Generator) generateGenericMoves(from int8, delta []int8, singleStep boo
 }
 
 func (g *Generator) createMove(from, to int8) Move {
-	move := Move{From: Square(from), To: Square(to)}
-	move.Promoted = Empty
-	move.Content = g.board.data[to]
-
-	// piece of same color on to square
-	if g.board.data[to]*g.board.data[from] > 0 {
-		move.MovedPiece = Empty
-		return move
-	}
-
-	move.MovedPiece = g.board.data[from]
-	move.From = Square(from)
-	move.To = Square(to)
-
-	switch {
-	case move.MovedPiece == WhiteKing || move.MovedPiece == WhiteRook:
-		move.Promoted = g.board.whiteCastle
-	case move.MovedPiece == BlackKing || move.MovedPiece == BlackRook:
-		move.Promoted = g.board.blackCastle
+	return Move{
+		From:       Square(from),
+		To:         Square(to),
+		MovedPiece: g.board.data[from],
+		Content:    g.board.data[to],
+		Promoted:   Empty,
 	}
-
-	return move
 }
 
 func (g *Generator) generateMovesPawn(from int8) {
+	b := g.board
+	color := b.sideToMove
+	forward := moveUp * color
 
-	startPos := false
-	delta := deltaWhitePawn
-
-	switch g.board.data[from] {
-	case WhitePawn:
-		startPos = rank(from) == whitePawnStartPos
-	case BlackPawn:
-		startPos = rank(from) == blackPawnStartPos
-		delta = deltaBlackPawn
+	startRank := whitePawnStartPos
+	if color == Black {
+		startRank = blackPawnStartPos
 	}
 
-	for _, d := range delta {
-		to := from + d
-
-		if g.board.legalSquare(to) {
-			// first check if it's has the direction to go and then if it is a legal ending
-			if g.legalDelta[from] == 0 || (g.legalDelta[from] == d || g.legalDelta[from] == opposite(d)) {
-				g.generateSingleMovePawn(from, to, startPos)
-			}
+	// moving forward requires empty squares
+	if to := from + forward; b.legalSquare(to) && b.data[to] == Empty {
+		if g.legalTarget(from, to) {
+			g.addPawnMove(g.createMove(from, to))
 		}
-	}
-}
-
-func (g *Generator) generateSingleMovePawn(from int8, to int8, startingPos bool) {
-	move := Move{}
-
-	move.MovedPiece = g.board.data[from]
-	move.Content = g.board.data[to]
-	move.From = Square(from)
-	move.To = Square(to)
-	move.Promoted = Empty
-
-	enPassantRemovesThreat := false
 
-	if g.kingUnderCheck && g.board.enPassant == Square(to) {
-		enPassantRemovesThreat = g.legalEnding[to+(moveDown*g.board.sideToMove)]
+		if to2 := to + forward; rank(from) == startRank && b.data[to2] == Empty && g.legalTarget(from, to2) {
+			g.addMove(g.createMove(from, to2))
+		}
 	}
 
-	if (!g.kingUnderCheck || g.legalEnding[to]) || enPassantRemovesThreat {
-		// move left/right
-		if file(from) != file(to) {
-
-			// en passant?
-			if move.To == g.board.enPassant {
-				move.Special = moveEnPassant
-				move.Content = -move.MovedPiece
-
-			} else if g.board.data[from]*g.board.data[to] >= 0 {
-				// must be opposite pawn
-				return
-			}
-
-		} else if g.board.data[to] != Empty {
-			// moving forward requires an empty field
-			return
+	for _, side := range [2]int8{moveLeft, moveRight} {
+		to := from + forward + side
+		if !b.legalSquare(to) {
+			continue
 		}
 
-		// promotions (queen or rook are only relevant pieces to check)
-		if rank(to)%7 == 0 {
-			move.Promoted = move.MovedPiece * Queen
-			move.Special = movePromotion
-			g.addMove(move)
-
-			move.Promoted = move.MovedPiece * Rook
-			move.Special = movePromotion
-			g.addMove(move)
-
-		} else {
-			g.addMove(move)
+		if b.data[to]*color < 0 && g.legalTarget(from, to) {
+			g.addPawnMove(g.createMove(from, to))
 		}
-	}
 
-	// starting position; do two steps if on same file; do not care about direction
-	if startingPos && file(from) == file(to) && g.board.data[to] == Empty {
-		move.To = Square(to + to - from)
-		if g.board.data[move.To] == Empty && (!g.kingUnderCheck || g.legalEnding[move.To]) {
+		if Square(to) == b.enPassant && g.enPassantLegal(from, to) {
+			move := g.createMove(from, to)
+			move.Special = moveEnPassant
+			move.Content = -move.MovedPiece
 			g.addMove(move)
 		}
 	}
-
 }
 
-func (g *Generator) generateCastlingMoves() {
-	// assume king is not under check
-	switch g.board.sideToMove {
-	case White:
-		if g.canCastle(g.board.sideToMove, castleShort) {
-			g.addMove(Move{From: E1, To: G1, Content: Empty, MovedPiece: WhiteKing, Special: moveCastelingShort})
-		}
-		if g.canCastle(g.board.sideToMove, castleLong) {
-			g.addMove(Move{From: E1, To: C1, Content: Empty, MovedPiece: WhiteKing, Special: moveCastelingLong})
-		}
-	case Black:
-		if g.canCastle(g.board.sideToMove, castleShort) {
-			g.addMove(Move{From: E8, To: G8, Content: Empty, MovedPiece: BlackKing, Special: moveCastelingShort})
-		}
-		if g.canCastle(g.board.sideToMove, castleLong) {
-			g.addMove(Move{From: E8, To: C8, Content: Empty, MovedPiece: BlackKing, Special: moveCastelingLong})
-		}
+// addPawnMove adds all promotions for a pawn reaching the last rank
+func (g *Generator) addPawnMove(move Move) {
+	if rank(int8(move.To))%7 != 0 {
+		g.addMove(move)
+		return
 	}
-}
 
-func (g *Generator) canCastle(color int8, dir int8) bool {
-	switch color {
-	case White:
-		if g.board.whiteCastle&dir == dir {
-			if dir == castleShort {
-				return g.board.isEmpty(F1, G1) && len(g.findThreats(F1, color, false)) == 0 && len(g.findThreats(G1, color, false)) == 0
-			}
-			return g.board.isEmpty(B1, C1, D1) && len(g.findThreats(C1, color, false)) == 0 && len(g.findThreats(D1, color, false)) == 0
-		}
-	case Black:
-		if g.board.blackCastle&dir == dir {
-			if dir == castleShort {
-				return g.board.isEmpty(F8, G8) && len(g.findThreats(F8, color, false)) == 0 && len(g.findThreats(G8, color, false)) == 0
-			}
-			return g.board.isEmpty(B8, C8, D8) && len(g.findThreats(C8, color, false)) == 0 && len(g.findThreats(D8, color, false)) == 0
-		}
+	pieces := promotionPieces
+	if g.kingPromotion {
+		pieces = promotionPiecesKing
 	}
 
-	return false
+	move.Special = movePromotion
+	for _, piece := range pieces {
+		move.Promoted = piece * move.MovedPiece
+		g.addMove(move)
+	}
 }
 
-func (g *Generator) findThreats(square Square, sideToMove int8, skipKing bool) []int8 {
-
-	threats := []int8{}
-
-	// knights need some special treatment
-	for _, delta := range deltaKnight {
-		to := int8(square) + delta
-		if g.board.legalSquare(to) && g.board.data[to]*opponent(sideToMove) == Knight {
-			threats = append(threats, to)
-		}
+// enPassantLegal plays the capture on the board, as it removes two pieces
+// from a line to the king
+func (g *Generator) enPassantLegal(from, to int8) bool {
+	b := g.board
+	if g.noCheck {
+		return true
 	}
+	pawn := b.data[from]
+	captured := to - moveUp*b.sideToMove
 
-	// check all possible directions
-	for _, delta := range deltaAll {
-		depth := 0
-		for to := int8(square) + delta; g.board.legalSquare(to); to += delta {
-			depth++
-			content := g.board.data[to] * sideToMove
-
-			// if there is a pawn/king on next square, check for attack
-			if content == -Pawn || content == -King {
-				if depth == 1 {
-					if g.attackPossible(to, opposite(delta)) {
-						threats = append(threats, to)
-					}
-				}
-				break
-			}
-
-			// skip all empty squares
-			if content == Empty {
-				continue
-			}
-
-			if skipKing && content == King {
-				continue
-			}
-
-			// own piece
-			if content > 0 {
-				break
-			}
-
-			// found opponent piece
-			if g.attackPossible(to, delta) {
-				threats = append(threats, to)
-			}
-
-			// no point in checking further
-			break
-		}
-	}
+	b.data[from], b.data[to], b.data[captured] = Empty, pawn, Empty
+	legal := !b.IsSquareAttacked(Square(g.kingSquare), opponent(b.sideToMove))
+	b.data[from], b.data[to], b.data[captured] = pawn, Empty, -pawn
 
-	return threats
+	return legal
 }
 
-// find the threats for the current color's king possition
-func (g *Generator) numberOfCheckThreats() int {
+func (g *Generator) generateCastlingMoves() {
+	// assume king is not under check
 	color := g.board.sideToMove
-	threats := 0
-	depth := 0
-	squareOfGuardingPiece := Invalid
-
-	// check if there is a threat from an opponents knight (could only be one)
-	for _, delta := range deltaKnight {
-		newSquare := g.kingSquare + delta
-
-		if g.board.legalSquare(newSquare) && g.board.data[newSquare]*opponent(color) == Knight {
-			g.kingUnderCheck = true
-			g.kingUnderCheckByKnight = int8(newSquare)
-			threats++
-			break
-		}
+	if g.canCastle(color, castleShort) {
+		g.addMove(g.board.castling.move(color, castleShort))
 	}
+	if g.canCastle(color, castleLong) {
+		g.addMove(g.board.castling.move(color, castleLong))
+	}
+}
 
-	// checking all possible directions
-	for _, delta := range deltaAll {
-		depth = 0
-		squareOfGuardingPiece = Invalid
-
-		for newSquare := g.kingSquare + delta; g.board.legalSquare(newSquare); newSquare += delta {
-			depth++
-
-			// check found piece
-			// positive: opponent
-			// zero:     empty
-			// negative: same color
-			piece := g.board.data[newSquare] * opponent(color)
-
-			if piece == Empty {
-				continue
-			}
-
-			// pawn on the next square, check if attack possible
-			if piece == Pawn || piece == King {
-				if depth == 1 {
-					if g.attackPossible(newSquare, opposite(delta)) {
-						g.kingUnderCheck = true
-						threats++
-						g.legalEnding[newSquare] = true
-					}
-				}
-				break
-			}
-
-			// own piece -> we stop but might have a protecting piece
-			if piece < 0 {
-				if squareOfGuardingPiece == Invalid {
-					squareOfGuardingPiece = Square(newSquare)
-					continue
-				} else {
-					break
-				}
-			}
+// canCastle requires the king and rook on their start squares, the squares
+// between them and their targets empty and the squares the king passes not
+// attacked. In Chess960 the rook may shield the king's target, so the
+// attacks are tested without it.
+func (g *Generator) canCastle(color int8, dir int8) bool {
+	b := g.board
+	rights := b.whiteCastle
+	if color == Black {
+		rights = b.blackCastle
+	}
 
-			// we found an opponents piece; might be a threat for the current square
-			if g.attackPossible(newSquare, delta) {
-				if squareOfGuardingPiece == Invalid {
-					threats++
-					g.kingUnderCheck = true
-					g.legalEnding[newSquare] = true
+	king, kingTo, rook, rookTo := b.castling.squares(color, dir)
+	if rights&dir != dir || b.data[king] != King*color || b.data[rook] != Rook*color {
+		return false
+	}
 
-					// set legal endings; looks hack-ish: it is!
-					for i := g.kingSquare + delta; i != newSquare; i += delta {
-						g.legalEnding[i] = true
-					}
-				} else {
-					g.legalDelta[uint8(squareOfGuardingPiece)] = delta
-				}
-			}
+	low, high := king, rook
+	if low > high {
+		low, high = high, low
+	}
+	for _, sq := range [2]int8{kingTo, rookTo} {
+		if sq < low {
+			low = sq
+		}
+		if sq > high {
+			high = sq
 		}
 	}
-
-	return threats
-}
-
-// check wether a piece can move towards a specific direction
-// does not work for knight obviously
-func (g *Generator) hasDirection(delta []int8, direction int8) bool {
-	for _, d := range delta {
-		if d == direction {
-			return true
+	for sq := low; sq <= high; sq++ {
+		if sq != king && sq != rook && b.data[sq] != Empty {
+			return false
 		}
 	}
 
-	return false
-}
+	step := nextFile
+	if kingTo < king {
+		step = -nextFile
+	}
 
-// check for attacks from a diven square in a particular direction
-// does not work for knight obviously
-func (g *Generator) attackPossible(from int8, direction int8) bool {
-	absPiece := abs(g.board.data[from])
-
-	switch absPiece {
-	case King:
-		return g.hasDirection(deltaKing, direction)
-	case Queen:
-		return g.hasDirection(deltaQueen, direction)
-	case Rook:
-		return g.hasDirection(deltaRook, direction)
-	case Bishop:
-		return g.hasDirection(deltaBishop, direction)
-	case Pawn:
-		// remove the first move of pawns (move foreward = no attack move!)
-		switch g.board.data[from] {
-		case WhitePawn:
-			return g.hasDirection(deltaWhitePawn[1:], direction)
-		case BlackPawn:
-			return g.hasDirection(deltaBlackPawn[1:], direction)
+	// the king is not in check, unless the rook shielded it
+	them := opponent(color)
+	safe := true
+	b.data[rook] = Empty
+	for sq := king; safe; sq += step {
+		if sq != king || sq == kingTo {
+			safe = !b.IsSquareAttacked(Square(sq), them)
+		}
+		if sq == kingTo {
+			break
 		}
 	}
+	b.data[rook] = Rook * color
 
-	return false
+	return safe
 }
@@ -101,3 +101,193 @@ func contains(moves []Move, move Move) bool {
 
 	return false
 }
+
+func TestGenerateCapturesAndQuietsSplitAllMoves(t *testing.T) {
+	for _, fen := range []string{defaultFEN, position2FEN, "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", "8/7p/1R2k1p1/3pp1P1/7P/7r/8/5K2 b - - 3 39"} {
+		b := NewBoard(fen)
+		all := NewGenerator(b).GenerateMoves()
+		captures := NewGenerator(b).GenerateCaptures()
+		quiets := NewGenerator(b).GenerateQuiets()
+
+		if len(captures)+len(quiets) != len(all) {
+			t.Errorf("Expected %d moves but got %d captures and %d quiet moves for %s\n", len(all), len(captures), len(quiets), fen)
+		}
+
+		for _, m := range captures {
+			if isQuietMove(m) || !containsMove(all, m) {
+				t.Errorf("Expected %s not to be a capture for %s\n", m, fen)
+			}
+		}
+		for _, m := range quiets {
+			if !isQuietMove(m) || !containsMove(all, m) {
+				t.Errorf("Expected %s not to be a quiet move for %s\n", m, fen)
+			}
+		}
+	}
+}
+
+func TestGenerateQuietChecksGiveCheck(t *testing.T) {
+	b := NewBoard("4k3/8/8/8/8/8/3PP3/R3K1N1 w Q - 0 1")
+	checks := NewGenerator(b).GenerateQuietChecks()
+
+	// Ra8, Nf3 does not check, Nh3 neither, O-O-O does not check
+	if len(checks) != 1 || checks[0].From != A1 || checks[0].To != A8 {
+		t.Errorf("Expected only Ra8 to give check but got %v\n", checks)
+	}
+}
+
+func TestIsLegal(t *testing.T) {
+	b := NewBoard(position2FEN)
+	for _, m := range NewGenerator(b).GenerateMoves() {
+		if !NewGenerator(b).IsLegal(m) {
+			t.Errorf("Expected %s to be legal\n", m)
+		}
+	}
+
+	illegal := []Move{
+		Move{},
+		Move{From: E1, To: E2, MovedPiece: WhiteKing, Content: Empty, Promoted: Empty},
+		Move{From: A2, To: A5, MovedPiece: WhitePawn, Content: Empty, Promoted: Empty},
+		Move{From: E5, To: F7, MovedPiece: WhiteKnight, Content: Empty, Promoted: Empty},
+	}
+	for _, m := range illegal {
+		if NewGenerator(b).IsLegal(m) {
+			t.Errorf("Expected %s to be illegal\n", m)
+		}
+	}
+}
+
+func containsMove(moves []Move, m Move) bool {
+	for _, move := range moves {
+		if move == m {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGeneratorPerft(t *testing.T) {
+	doTestGeneratorPerft(position1FEN, position1Table, 4, t)
+	doTestGeneratorPerft(position2FEN, position2Table, 3, t)
+}
+
+func TestGenerateUnderPromotions(t *testing.T) {
+	expected := []Move{
+		Move{From: A7, To: A8, MovedPiece: WhitePawn, Special: movePromotion, Content: Empty, Promoted: WhiteQueen},
+		Move{From: A7, To: A8, MovedPiece: WhitePawn, Special: movePromotion, Content: Empty, Promoted: WhiteRook},
+		Move{From: A7, To: A8, MovedPiece: WhitePawn, Special: movePromotion, Content: Empty, Promoted: WhiteBishop},
+		Move{From: A7, To: A8, MovedPiece: WhitePawn, Special: movePromotion, Content: Empty, Promoted: WhiteKnight},
+		Move{From: H1, To: G1, MovedPiece: WhiteKing, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+		Move{From: H1, To: G2, MovedPiece: WhiteKing, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+		Move{From: H1, To: H2, MovedPiece: WhiteKing, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+	}
+
+	doTestMovesForFEN("4k3/P7/8/8/8/8/8/7K w - - 0 1", expected, t)
+}
+
+func TestGenerateMovesForPinnedPieces(t *testing.T) {
+	// the bishop is pinned and the en passant capture would expose the king
+	expected := []Move{
+		Move{From: C3, To: B4, MovedPiece: WhiteBishop, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+		Move{From: C3, To: D2, MovedPiece: WhiteBishop, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+		Move{From: C3, To: E1, MovedPiece: WhiteBishop, Special: moveOrdinary, Content: BlackBishop, Promoted: Empty},
+		Move{From: B5, To: B6, MovedPiece: WhitePawn, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+		Move{From: A5, To: A4, MovedPiece: WhiteKing, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+		Move{From: A5, To: A6, MovedPiece: WhiteKing, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+		Move{From: A5, To: B6, MovedPiece: WhiteKing, Special: moveOrdinary, Content: Empty, Promoted: Empty},
+	}
+
+	doTestMovesForFEN("7k/8/8/KPp4r/8/2B5/8/4b3 w - c6 0 1", expected, t)
+}
+
+func doTestGeneratorPerft(fen string, expected []PerftData, depth int, t *testing.T) {
+	b := NewBoard(fen)
+
+	for _, e := range expected[:depth+1] {
+		if nodes := perft(e.depth, b).nodes; nodes != e.nodes {
+			t.Errorf("Expected %d nodes at depth %d but got %d for %s\n", e.nodes, e.depth, nodes, fen)
+		}
+	}
+}
+
+func TestRunPerft(t *testing.T) {
+	b := NewBoard(position2FEN)
+
+	for _, threads := range []int{1, 4} {
+		result := RunPerft(b, 3, threads)
+		if result.Nodes != position2Table[3].nodes {
+			t.Errorf("Expected %d nodes with %d threads but got %d\n", position2Table[3].nodes, threads, result.Nodes)
+		}
+
+		// the counts of the root moves match a perft of the move alone
+		for i, move := range result.Moves[:5] {
+			b.MakeMove(move)
+			if nodes := perft(2, b).nodes; nodes != result.Divide[i] {
+				t.Errorf("Expected %d nodes after %s but got %d\n", nodes, move.coordinate(), result.Divide[i])
+			}
+			b.UndoMove()
+		}
+	}
+
+	if fen := generateFEN(b); fen != generateFEN(NewBoard(position2FEN)) {
+		t.Errorf("Expected the board to be unchanged but got %s\n", fen)
+	}
+}
+
+func TestRunPerftWithoutCache(t *testing.T) {
+	size := perftHashSize
+	defer func() { perftHashSize = size }()
+	perftHashSize = 0
+
+	if nodes := RunPerft(NewBoard(position1FEN), 4, 2).Nodes; nodes != position1Table[4].nodes {
+		t.Errorf("Expected %d nodes but got %d\n", position1Table[4].nodes, nodes)
+	}
+}
+
+func TestMoveCoordinate(t *testing.T) {
+	moves := map[string]Move{
+		"e2e4":  Move{From: E2, To: E4, MovedPiece: WhitePawn},
+		"e1g1":  Move{From: E1, To: G1, MovedPiece: WhiteKing, Special: moveCastelingShort},
+		"b2a1n": Move{From: B2, To: A1, MovedPiece: BlackPawn, Content: WhiteRook, Special: movePromotion, Promoted: BlackKnight},
+	}
+	for expected, move := range moves {
+		if s := move.coordinate(); s != expected {
+			t.Errorf("Expected %s but got %s\n", expected, s)
+		}
+	}
+}
+
+func TestPerftDoesntAllocate(t *testing.T) {
+	b := NewBoard(position2FEN)
+	buffers := make([]MoveBuffer, 3)
+
+	allocs := testing.AllocsPerRun(5, func() {
+		perftBuffered(2, b, buffers)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations but got %f\n", allocs)
+	}
+}
+
+func BenchmarkPerft(b *testing.B) {
+	board := NewBoard(position2FEN)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		perft(3, board)
+	}
+}
+
+func TestPackedMove(t *testing.T) {
+	for _, fen := range []string{position2FEN, "r3k2r/1P6/8/3pP3/8/8/6p1/R3K2R w KQkq d6 0 1"} {
+		for _, move := range NewGenerator(NewBoard(fen)).GenerateMoves() {
+			packed := move.Pack()
+			if packed == 0 || packed.Unpack() != move {
+				t.Errorf("Expected %s but got %s\n", move, packed.Unpack())
+			}
+		}
+	}
+
+	if (Move{}).Pack().Unpack() != (Move{}) || PackedMove(0).Unpack() != (Move{}) {
+		t.Errorf("Expected the empty move to survive packing\n")
+	}
+}
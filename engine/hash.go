@@ -8,19 +8,24 @@ const (
 	numCastelings = 4 // none, short, long, short&long
 )
 
+// shared by all boards, the keys only depend on the fixed seed
+var defaultZobristTable = NewZobristTable()
+
 type ZobristTable struct {
 	hashPieces         [numPieces][numColors][boardSize]int64
 	hashEnPassant      [boardSize]int64
 	hashCastelingBlack [numCastelings]int64
 	hashCastelingWhite [numCastelings]int64
-	hashPromotion      [numPieces]int64
 	hashSide           int64
-	hashCurrent        int64
+	hashChecks         [numColors][threeCheckWin + 1]int64           // no checks given hashes to 0
+	hashPockets        [numColors][pocketPieces][pocketMax + 1]int64 // an empty pocket hashes to 0
+	hashPromoted       [64]int64                                     // by bitboard square
+	hashVariants       [maxVariants + 1]int64                        // by variant index, chess hashes to 0
 }
 
 func NewZobristTable() *ZobristTable {
 
-	rand.Seed(4711)
+	r := rand.New(rand.NewSource(4711))
 
 	z := ZobristTable{}
 
@@ -28,31 +33,52 @@ func NewZobristTable() *ZobristTable {
 	for piece := 0; piece < numPieces; piece++ {
 		for color := 0; color < numColors; color++ {
 			for square := int8(0); square < boardSize; square++ {
-				z.hashPieces[piece][color][square] = hashRand()
+				z.hashPieces[piece][color][square] = hashRand(r)
 			}
 		}
 	}
 	// en passant
 	for square := int8(0); square < boardSize; square++ {
-		z.hashEnPassant[square] = hashRand()
+		z.hashEnPassant[square] = hashRand(r)
 	}
 	// castling options
-	for i := int8(0); i <= castleLong; i++ {
-		z.hashCastelingBlack[i] = hashRand()
-		z.hashCastelingWhite[i] = hashRand()
+	for i := 0; i < numCastelings; i++ {
+		z.hashCastelingBlack[i] = hashRand(r)
+		z.hashCastelingWhite[i] = hashRand(r)
 	}
 
-	// promotion pieces
-	for piece := int8(0); piece < numPieces; piece++ {
-		z.hashPromotion[piece] = hashRand()
+	// side
+	z.hashSide = hashRand(r)
+
+	// checks given in Three-check, drawn last to keep the other keys
+	for color := 0; color < numColors; color++ {
+		for checks := 1; checks <= threeCheckWin; checks++ {
+			z.hashChecks[color][checks] = hashRand(r)
+		}
 	}
 
-	// side
-	z.hashSide = hashRand()
+	// pieces in hand in Crazyhouse
+	for color := 0; color < numColors; color++ {
+		for piece := 0; piece < pocketPieces; piece++ {
+			for count := 1; count <= pocketMax; count++ {
+				z.hashPockets[color][piece][count] = hashRand(r)
+			}
+		}
+	}
+
+	// promoted pieces in Crazyhouse, which are pawns again once captured
+	for sq := 0; sq < 64; sq++ {
+		z.hashPromoted[sq] = hashRand(r)
+	}
+
+	// the variant, so tables shared by several variants don't mix them up
+	for i := 1; i <= maxVariants; i++ {
+		z.hashVariants[i] = hashRand(r)
+	}
 
 	return &z
 }
 
-func hashRand() int64 {
-	return rand.Int63()
+func hashRand(r *rand.Rand) int64 {
+	return r.Int63()
 }
@@ -0,0 +1,590 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	matchMovesToGo     = 30               // internal engines plan their time for this many moves
+	matchMoveOverhead  = 5 * time.Second  // external engines may exceed their clock by this before they are stopped
+	matchNodesTimeout  = 60 * time.Second // maximum time of a move with a node limit
+	matchMinSearchTime = 10 * time.Millisecond
+)
+
+// internal engines share the evaluation weights and search margins of the
+// process. Searches with the same parameters run in parallel, engines with
+// other parameters wait until they are done.
+var matchSearch = newParamGate()
+
+// paramGate lets the searches with one set of parameters in at a time
+type paramGate struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	params  []int // of the running searches
+	running int
+	waiting int // for other parameters, no more searches are let in then
+}
+
+func newParamGate() *paramGate {
+	g := &paramGate{}
+	g.changed = sync.NewCond(&g.mutex)
+	return g
+}
+
+// enter waits until the parameters can be set for a search
+func (g *paramGate) enter(params []int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for g.running > 0 && (g.waiting > 0 || !sameParams(g.params, params)) {
+		g.waiting++
+		g.changed.Wait()
+		g.waiting--
+	}
+	if g.running == 0 {
+		restoreParams(params)
+		g.params = params
+	}
+	g.running++
+}
+
+// leave ends a search
+func (g *paramGate) leave() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.running--; g.running == 0 {
+		g.changed.Broadcast()
+	}
+}
+
+func sameParams(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchOptions configures a match between two engines
+type MatchOptions struct {
+	Engines     [2]string // "gochess", "gochess:<parameter file>" or "uci:<command>"
+	Openings    string    // EPD or FEN file, every opening is played with both colors
+	Rounds      int       // pairs of games
+	Concurrency int       // games played in parallel
+	TimeControl string    // "<base>+<increment>" in seconds, e.g. "10+0.1"
+	Nodes       int64     // fixed nodes per move instead of a time control
+	Hash        int       // transposition table size of UCI engines in MB
+	MaxPlies    int       // longer games are drawn, 0 means no limit
+	ResignScore int       // a game is lost after ResignMoves moves of both engines beyond ResignScore against it
+	ResignMoves int       // 0 disables the adjudication
+	DrawScore   int       // a game is drawn after DrawMoves moves of both sides within DrawScore
+	DrawMoves   int       // 0 disables the adjudication
+	DrawAfter   int       // draws are adjudicated from this move number on
+	SPRT        *SPRT     // stops the match once the test has a verdict
+	PGN         string    // the games are written to this file
+}
+
+// matchPlayer is an engine taking part in a match
+type matchPlayer interface {
+	name() string
+	newGame() error
+	// move returns the move in coordinate notation, the score relative to
+	// the side to move and the time used
+	move(g *matchGame) (string, int, time.Duration, error)
+	close()
+}
+
+// matchGame is the state of a game passed to the players
+type matchGame struct {
+	options   *MatchOptions
+	fen       string
+	board     *Board
+	moves     []Move
+	clocks    [2]time.Duration // by color index
+	increment time.Duration
+}
+
+// timeForMove plans the search time of the side to move
+func (g *matchGame) timeForMove() time.Duration {
+	return planTime(g.clocks[colorIndex(g.board.sideToMove)], g.increment)
+}
+
+// planTime divides the time left on a clock among the next moves, with a
+// part of the increment on top
+func planTime(clock, increment time.Duration) time.Duration {
+	t := clock/matchMovesToGo + increment*3/4
+	if t > clock/2 {
+		t = clock / 2
+	}
+	if t < matchMinSearchTime {
+		t = matchMinSearchTime
+	}
+	return t
+}
+
+type internalPlayer struct {
+	label  string
+	params []int
+	tt     *TranspositionTable
+}
+
+func (p *internalPlayer) name() string { return p.label }
+func (p *internalPlayer) close()       {}
+
+func (p *internalPlayer) newGame() error {
+	if p.tt != nil {
+		p.tt.Clear()
+	}
+	return nil
+}
+
+func (p *internalPlayer) move(g *matchGame) (string, int, time.Duration, error) {
+	limits := SearchLimits{Nodes: g.options.Nodes, TT: gameTable(&p.tt)}
+	if limits.Nodes == 0 {
+		limits.Time = g.timeForMove()
+	}
+
+	matchSearch.enter(p.params)
+	defer matchSearch.leave()
+
+	start := time.Now()
+	result := SearchWithLimits(g.board, limits)
+
+	if result.Move.MovedPiece == Empty {
+		return "", 0, time.Since(start), errors.New("no move found")
+	}
+	return result.Move.coordinate(), result.Score, time.Since(start), nil
+}
+
+type uciPlayer struct {
+	command string
+	options map[string]string
+	label   string
+	engine  *uciEngine
+}
+
+func (p *uciPlayer) name() string { return p.label }
+
+// start runs the engine, after an error it is started again
+func (p *uciPlayer) start() error {
+	if p.engine != nil {
+		return nil
+	}
+
+	e, err := startUCIEngine(p.command, p.options)
+	if err != nil {
+		return err
+	}
+	p.engine, p.label = e, e.name
+	return nil
+}
+
+func (p *uciPlayer) newGame() error {
+	if err := p.start(); err != nil {
+		return err
+	}
+	return p.fail(p.engine.newGame())
+}
+
+func (p *uciPlayer) move(g *matchGame) (string, int, time.Duration, error) {
+	goCommand := fmt.Sprintf("go nodes %d", g.options.Nodes)
+	timeout := matchNodesTimeout
+	if g.options.Nodes == 0 {
+		goCommand = fmt.Sprintf("go wtime %d btime %d winc %d binc %d",
+			g.clocks[0].Milliseconds(), g.clocks[1].Milliseconds(), g.increment.Milliseconds(), g.increment.Milliseconds())
+		timeout = g.clocks[colorIndex(g.board.sideToMove)] + matchMoveOverhead
+	}
+
+	start := time.Now()
+	move, score, err := p.engine.search(g.fen, g.moves, goCommand, timeout)
+	return move, score, time.Since(start), p.fail(err)
+}
+
+// fail stops the engine after an error, it is restarted for the next game
+func (p *uciPlayer) fail(err error) error {
+	if err != nil && p.engine != nil {
+		p.engine.close()
+		p.engine = nil
+	}
+	return err
+}
+
+func (p *uciPlayer) close() {
+	if p.engine != nil {
+		p.engine.close()
+		p.engine = nil
+	}
+}
+
+// newMatchPlayer creates a player from an engine specification
+func newMatchPlayer(spec string, hash int) (matchPlayer, error) {
+	switch {
+	case spec == "" || spec == "gochess":
+		params, _ := readParamSet("")
+		return &internalPlayer{label: "gochess", params: params}, nil
+
+	case strings.HasPrefix(spec, "gochess:"):
+		path := spec[len("gochess:"):]
+		params, err := readParamSet(path)
+		if err != nil {
+			return nil, err
+		}
+		label := "gochess " + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		return &internalPlayer{label: label, params: params}, nil
+
+	case strings.HasPrefix(spec, "uci:"):
+		p := &uciPlayer{command: spec[len("uci:"):], options: map[string]string{}}
+		if hash > 0 {
+			p.options["Hash"] = strconv.Itoa(hash)
+		}
+		return p, p.start()
+	}
+
+	return nil, fmt.Errorf("invalid engine %q", spec)
+}
+
+// parseTimeControl reads "<base>+<increment>" or "<base>" in seconds
+func parseTimeControl(tc string) (time.Duration, time.Duration, error) {
+	parts := strings.Split(tc, "+")
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("invalid time control %q", tc)
+	}
+
+	values := []time.Duration{0, 0}
+	for i, part := range parts {
+		seconds, err := strconv.ParseFloat(part, 64)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("invalid time control %q", tc)
+		}
+		values[i] = time.Duration(seconds * float64(time.Second))
+	}
+
+	if values[0] <= 0 {
+		return 0, 0, fmt.Errorf("invalid time control %q", tc)
+	}
+	return values[0], values[1], nil
+}
+
+// playMatchGame plays a game from the given position, the players are
+// indexed by color
+func playMatchGame(options *MatchOptions, fen string, players [2]matchPlayer, base, increment time.Duration) *pgnGame {
+	g := &matchGame{options: options, fen: fen, board: NewBoard(fen), clocks: [2]time.Duration{base, base}, increment: increment}
+	b := g.board
+	game := &pgnGame{result: "*"}
+	termination := "normal"
+
+	// the loser of a game decided by the rules or adjudication
+	lose := func(color int8, t, comment string) {
+		game.result, termination, game.comment = "1-0", t, comment
+		if color == White {
+			game.result = "0-1"
+		}
+	}
+
+	for side, color := range [2]int8{White, Black} {
+		if err := players[side].newGame(); err != nil {
+			lose(color, "abandoned", players[side].name()+": "+err.Error())
+		}
+	}
+
+	// the number of moves in a row both engines agree on the loser or a
+	// draw
+	resign, loser := 0, int8(0)
+	draw := 0
+
+	for game.result == "*" {
+		if b.updateStatus(); b.gameOver() {
+			game.result, game.comment = statusResult(b)
+			break
+		}
+
+		if options.MaxPlies > 0 && len(g.moves) >= options.MaxPlies {
+			game.result, termination, game.comment = "1/2-1/2", "adjudication", "maximum game length"
+			break
+		}
+
+		color := b.sideToMove
+		side := colorIndex(color)
+		player := players[side]
+
+		coordinate, score, elapsed, err := player.move(g)
+		if err != nil {
+			lose(color, "abandoned", player.name()+": "+err.Error())
+			break
+		}
+
+		if options.Nodes == 0 {
+			if g.clocks[side] -= elapsed; g.clocks[side] < 0 {
+				lose(color, "time forfeit", player.name()+" loses on time")
+				break
+			}
+			g.clocks[side] += increment
+		}
+
+		move, err := parseSAN(b, coordinate)
+		if err != nil || move.coordinate() != coordinate {
+			lose(color, "rules infraction", player.name()+" plays the illegal move "+coordinate)
+			break
+		}
+
+		game.moves = append(game.moves, formatSAN(b, move))
+		g.moves = append(g.moves, move)
+		b.MakeMove(move)
+
+		// clearly decided and dead drawn games are adjudicated
+		if options.ResignMoves > 0 {
+			losing := int8(0)
+			if score <= -options.ResignScore {
+				losing = color
+			} else if score >= options.ResignScore {
+				losing = opponent(color)
+			}
+			if losing == 0 {
+				resign, loser = 0, 0
+			} else if losing == loser {
+				resign++
+			} else {
+				resign, loser = 1, losing
+			}
+			if resign >= 2*options.ResignMoves {
+				lose(loser, "adjudication", players[colorIndex(loser)].name()+" loses by score")
+				break
+			}
+		}
+
+		if options.DrawMoves > 0 && b.fullMoves > options.DrawAfter {
+			if score <= options.DrawScore && score >= -options.DrawScore {
+				draw++
+			} else {
+				draw = 0
+			}
+			if draw >= 2*options.DrawMoves {
+				game.result, termination, game.comment = "1/2-1/2", "adjudication", "draw by score"
+			}
+		}
+	}
+
+	tc := "-"
+	if options.Nodes == 0 {
+		tc = options.TimeControl
+	}
+
+	game.tags = []pgnTag{
+		{"Event", "gochess match"},
+		{"Site", "gochess"},
+		{"Date", time.Now().Format("2006.01.02")},
+		{"Round", "?"},
+		{"White", players[0].name()},
+		{"Black", players[1].name()},
+		{"Result", game.result},
+	}
+	if fen != defaultFEN {
+		game.fen = fen
+		game.tags = append(game.tags, pgnTag{"SetUp", "1"}, pgnTag{"FEN", fen})
+	}
+	game.tags = append(game.tags,
+		pgnTag{"TimeControl", tc},
+		pgnTag{"Termination", termination},
+		pgnTag{"PlyCount", strconv.Itoa(len(game.moves))})
+
+	return game
+}
+
+type matchResult struct {
+	index int
+	game  *pgnGame
+	score float64 // of the first engine
+}
+
+// Match plays two engines against each other, every opening twice with
+// reversed colors, and reports the results after each game. The match
+// ends early once the SPRT, if any, has a verdict.
+func Match(options MatchOptions) (MatchScore, error) {
+	score := MatchScore{}
+	if options.Rounds < 1 {
+		options.Rounds = 1
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+
+	base, increment := time.Duration(0), time.Duration(0)
+	if options.Nodes <= 0 {
+		var err error
+		if base, increment, err = parseTimeControl(options.TimeControl); err != nil {
+			return score, err
+		}
+	}
+
+	openings := []string{defaultFEN}
+	if options.Openings != "" {
+		var err error
+		if openings, err = readPositions(options.Openings); err != nil {
+			return score, err
+		}
+		if len(openings) == 0 {
+			return score, errors.New("no openings found in " + options.Openings)
+		}
+	}
+
+	// the parameters of the internal players are restored after the match
+	defer restoreParams(snapshotParams())
+
+	// every worker plays with its own pair of engines
+	players := make([][2]matchPlayer, options.Concurrency)
+	defer func() {
+		for _, pair := range players {
+			for _, p := range pair {
+				if p != nil {
+					p.close()
+				}
+			}
+		}
+	}()
+	for i := range players {
+		for j, spec := range options.Engines {
+			p, err := newMatchPlayer(spec, options.Hash)
+			if err != nil {
+				return score, err
+			}
+			players[i][j] = p
+		}
+	}
+
+	var pgn *os.File
+	if options.PGN != "" {
+		var err error
+		if pgn, err = os.Create(options.PGN); err != nil {
+			return score, err
+		}
+		defer pgn.Close()
+	}
+
+	games := 2 * options.Rounds
+	indexes := make(chan int)
+	results := make(chan matchResult)
+	stop := make(chan bool)
+
+	var wg sync.WaitGroup
+	for _, pair := range players {
+		wg.Add(1)
+		go func(pair [2]matchPlayer) {
+			defer wg.Done()
+			for index := range indexes {
+				// the first engine plays white in even games
+				colors := [2]matchPlayer{pair[0], pair[1]}
+				if index%2 == 1 {
+					colors = [2]matchPlayer{pair[1], pair[0]}
+				}
+
+				opening := openings[(index/2)%len(openings)]
+				game := playMatchGame(&options, opening, colors, base, increment)
+				game.tags[3].value = strconv.Itoa(index + 1)
+
+				r := matchResult{index: index, game: game, score: 0.5}
+				switch {
+				case game.result == "1-0" && index%2 == 0, game.result == "0-1" && index%2 == 1:
+					r.score = 1
+				case game.result == "0-1" && index%2 == 0, game.result == "1-0" && index%2 == 1:
+					r.score = 0
+				}
+				results <- r
+			}
+		}(pair)
+	}
+
+	go func() {
+	schedule:
+		for i := 0; i < games; i++ {
+			select {
+			case indexes <- i:
+			case <-stop:
+				break schedule
+			}
+		}
+		close(indexes)
+		wg.Wait()
+		close(results)
+	}()
+
+	names := players[0][0].name() + " vs " + players[0][1].name()
+	fmt.Printf("%s, %d games\n", names, games)
+
+	// after an error the games still running are waited for, their engines
+	// are closed only when all workers are done
+	verdict, stopped := "", false
+	halt := func() {
+		if !stopped {
+			close(stop)
+			stopped = true
+		}
+	}
+	var err error
+	for r := range results {
+		if err != nil {
+			continue
+		}
+
+		switch r.score {
+		case 1:
+			score.Wins++
+		case 0:
+			score.Losses++
+		default:
+			score.Draws++
+		}
+
+		if pgn != nil {
+			if _, err = pgn.WriteString(r.game.String()); err != nil {
+				halt()
+				continue
+			}
+		}
+
+		line := fmt.Sprintf("game %d/%d: %s - %s %s", score.games(), games, r.game.tag("White"), r.game.tag("Black"), r.game.result)
+		if r.game.comment != "" {
+			line += " (" + r.game.comment + ")"
+		}
+		line += ", " + score.String()
+
+		if options.SPRT != nil {
+			lower, upper := sprtBounds(options.SPRT.Alpha, options.SPRT.Beta)
+			line += fmt.Sprintf(", LLR %.2f (%.2f, %.2f)", score.LLR(options.SPRT.Elo0, options.SPRT.Elo1), lower, upper)
+
+			if v := options.SPRT.Verdict(score); v != "" && verdict == "" {
+				verdict = v
+				halt()
+			}
+		}
+		fmt.Printf("%s\n", line)
+	}
+	if err != nil {
+		return score, err
+	}
+
+	fmt.Printf("%s: %s\n", names, score)
+	if options.SPRT != nil {
+		switch verdict {
+		case "H1":
+			fmt.Printf("%s: H1 accepted, %s is stronger\n", options.SPRT, players[0][0].name())
+		case "H0":
+			fmt.Printf("%s: H0 accepted, %s is not stronger\n", options.SPRT, players[0][0].name())
+		default:
+			fmt.Printf("%s: no verdict yet\n", options.SPRT)
+		}
+	}
+
+	return score, nil
+}
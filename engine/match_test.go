@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchScore(t *testing.T) {
+	s := MatchScore{Wins: 60, Draws: 20, Losses: 20}
+
+	if elo, margin := s.Elo(); math.Abs(elo-147.2) > 0.1 || margin <= 0 {
+		t.Errorf("Expected elo 147.2 with a margin but got %.1f +/- %.1f\n", elo, margin)
+	}
+	if elo, margin := (MatchScore{Draws: 10}).Elo(); elo != 0 || margin != 0 {
+		t.Errorf("Expected elo 0 for draws but got %.1f +/- %.1f\n", elo, margin)
+	}
+
+	lower, upper := sprtBounds(0.05, 0.05)
+	if math.Abs(lower+2.944) > 0.001 || math.Abs(upper-2.944) > 0.001 {
+		t.Errorf("Expected the bounds -2.944 and 2.944 but got %.3f and %.3f\n", lower, upper)
+	}
+
+	test := SPRT{Elo0: 0, Elo1: 5, Alpha: 0.05, Beta: 0.05}
+	if v := test.Verdict(MatchScore{Wins: 600, Draws: 200, Losses: 200}); v != "H1" {
+		t.Errorf("Expected H1 but got %q\n", v)
+	}
+	if v := test.Verdict(MatchScore{Wins: 200, Draws: 200, Losses: 600}); v != "H0" {
+		t.Errorf("Expected H0 but got %q\n", v)
+	}
+	if v := test.Verdict(MatchScore{Wins: 3, Draws: 4, Losses: 3}); v != "" {
+		t.Errorf("Expected no verdict but got %q\n", v)
+	}
+}
+
+func TestParseTimeControl(t *testing.T) {
+	base, increment, err := parseTimeControl("10+0.1")
+	if err != nil || base != 10*time.Second || increment != 100*time.Millisecond {
+		t.Errorf("Expected 10s+100ms but got %v+%v (%v)\n", base, increment, err)
+	}
+
+	for _, tc := range []string{"", "0+1", "x", "1+2+3", "-5"} {
+		if _, _, err := parseTimeControl(tc); err == nil {
+			t.Errorf("Expected an error for %q\n", tc)
+		}
+	}
+}
+
+func TestPGNGame(t *testing.T) {
+	g := &pgnGame{
+		tags:    []pgnTag{{"White", "a"}, {"Black", "b"}, {"Result", "1-0"}},
+		fen:     "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		moves:   []string{"e5", "Nf3", "Nc6"},
+		result:  "1-0",
+		comment: "black loses on time",
+	}
+
+	expected := "[White \"a\"]\n[Black \"b\"]\n[Result \"1-0\"]\n\n1... e5 2. Nf3 Nc6 {black loses on time} 1-0\n\n"
+	if s := g.String(); s != expected {
+		t.Errorf("Expected %q but got %q\n", expected, s)
+	}
+
+	g = &pgnGame{result: "*"}
+	for i := 0; i < 100; i++ {
+		g.moves = append(g.moves, "Nf3", "Nf6", "Ng1", "Ng8")
+	}
+	for _, line := range strings.Split(g.String(), "\n") {
+		if len(line) > pgnLineLength {
+			t.Errorf("Expected lines of at most %d characters but got %q\n", pgnLineLength, line)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	pgn := filepath.Join(t.TempDir(), "games.pgn")
+	score, err := Match(MatchOptions{
+		Rounds:   1,
+		Nodes:    200,
+		MaxPlies: 20,
+		PGN:      pgn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.games() != 2 {
+		t.Errorf("Expected 2 games but got %d\n", score.games())
+	}
+
+	data, err := os.ReadFile(pgn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "[Event "); n != 2 {
+		t.Errorf("Expected 2 games in the PGN file but got %d\n", n)
+	}
+
+	if _, err := Match(MatchOptions{Engines: [2]string{"gochess", "nonsense"}, Nodes: 200}); err == nil {
+		t.Errorf("Expected an error for an invalid engine\n")
+	}
+}
+
+// scoredPlayer plays the moves of an engine but reports its own score
+type scoredPlayer struct {
+	matchPlayer
+	score int
+}
+
+func (p scoredPlayer) move(g *matchGame) (string, int, time.Duration, error) {
+	move, _, elapsed, err := p.matchPlayer.move(g)
+	return move, p.score, elapsed, err
+}
+
+func TestMatchResign(t *testing.T) {
+	options := &MatchOptions{Nodes: 200, MaxPlies: 20, ResignScore: 1000, ResignMoves: 3}
+	white := scoredPlayer{&internalPlayer{label: "white", params: snapshotParams()}, 2000}
+
+	// only one engine sees a won game
+	game := playMatchGame(options, defaultFEN, [2]matchPlayer{white, scoredPlayer{&internalPlayer{label: "black", params: snapshotParams()}, 0}}, 0, 0)
+	if strings.Contains(game.comment, "by score") {
+		t.Errorf("Expected no adjudication without the agreement of black but got %s\n", game.comment)
+	}
+
+	// both engines agree for 3 moves each
+	game = playMatchGame(options, defaultFEN, [2]matchPlayer{white, scoredPlayer{&internalPlayer{label: "black", params: snapshotParams()}, -2000}}, 0, 0)
+	if game.result != "1-0" || game.comment != "black loses by score" || len(game.moves) != 6 {
+		t.Errorf("Expected black to lose by score after 6 plies but got %s %s %d\n", game.result, game.comment, len(game.moves))
+	}
+}
+
+func TestParamGate(t *testing.T) {
+	params := snapshotParams()
+	defer restoreParams(params)
+	other := append([]int{}, params...)
+	other[0]++
+
+	g := newParamGate()
+	g.enter(params)
+	g.enter(params)
+
+	// the other parameters wait for both searches
+	entered := make(chan bool)
+	go func() {
+		g.enter(other)
+		entered <- pawnValue == other[0]
+		g.leave()
+	}()
+
+	g.leave()
+	select {
+	case <-entered:
+		t.Fatalf("Expected the other parameters to wait for the running search\n")
+	case <-time.After(50 * time.Millisecond):
+	}
+	g.leave()
+	if set := <-entered; !set {
+		t.Errorf("Expected the other parameters to be set\n")
+	}
+}
+
+func TestMatchWriteError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("skipping without /dev/full")
+	}
+
+	// the match ends after the first game, once the running ones are over
+	goroutines := runtime.NumGoroutine()
+	score, err := Match(MatchOptions{Rounds: 4, Concurrency: 2, Nodes: 200, MaxPlies: 20, PGN: "/dev/full"})
+	if err == nil || score.games() != 1 {
+		t.Errorf("Expected an error after one game but got %s %v\n", score, err)
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the workers to end but got %d goroutines instead of %d\n", runtime.NumGoroutine(), goroutines)
+		}
+	}
+}
+
+func TestMatchUCIEngine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping a match against a subprocess in short mode")
+	}
+
+	// the test binary starts slowly with the race detector
+	defer func(timeout time.Duration) { uciStartTimeout = timeout }(uciStartTimeout)
+	uciStartTimeout = 2 * time.Minute
+
+	helper := "uci:" + os.Args[0] + " -test.run=^TestHelperUCIEngine$"
+	defer os.Unsetenv("GOCHESS_UCI_HELPER")
+
+	// the helper plays the first legal move
+	os.Setenv("GOCHESS_UCI_HELPER", "first")
+	score, err := Match(MatchOptions{Engines: [2]string{"gochess", helper}, Rounds: 1, Nodes: 1000, MaxPlies: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.games() != 2 || score.Losses != 0 {
+		t.Errorf("Expected 2 games without a loss against the helper engine but got %s\n", score)
+	}
+
+	// illegal moves lose
+	os.Setenv("GOCHESS_UCI_HELPER", "illegal")
+	score, err = Match(MatchOptions{Engines: [2]string{helper, "gochess"}, Rounds: 1, Nodes: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.Losses != 2 {
+		t.Errorf("Expected the helper engine to lose 2 games by illegal moves but got %s\n", score)
+	}
+}
+
+// TestHelperUCIEngine is the UCI engine of TestMatchUCIEngine, it plays the
+// first legal move or an illegal one
+func TestHelperUCIEngine(t *testing.T) {
+	mode := os.Getenv("GOCHESS_UCI_HELPER")
+	if mode == "" {
+		return
+	}
+
+	b := NewBoard(defaultFEN)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			fmt.Println("id name helper")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "position":
+			if len(fields) >= 8 && fields[1] == "fen" {
+				b = NewBoard(strings.Join(fields[2:8], " "))
+			}
+			for i := 9; i < len(fields); i++ {
+				move, err := parseSAN(b, fields[i])
+				if err != nil {
+					os.Exit(1)
+				}
+				b.MakeMove(move)
+			}
+		case "go":
+			moves := NewGenerator(b).GenerateMoves()
+			fmt.Println("info depth 1 score cp 0")
+			if mode == "illegal" {
+				fmt.Println("bestmove a1a1")
+			} else {
+				fmt.Printf("bestmove %s\n", moves[0].coordinate())
+			}
+		case "quit":
+			os.Exit(0)
+		}
+	}
+	os.Exit(0)
+}
@@ -12,6 +12,8 @@ const (
 	moveCastelingLong  int8 = 2
 	movePromotion      int8 = 3
 	moveEnPassant      int8 = 4
+	moveNull           int8 = 5
+	moveDrop           int8 = 6 // a piece in hand is put on the empty square To, From is the same
 
 	castleNone  int8 = 0
 	castleLong  int8 = 1
@@ -28,15 +30,52 @@ type Move struct {
 	Promoted   int8
 }
 
+// PackedMove is a Move encoded in 32 bits: from and to square (6 bits
+// each), special (3 bits) and moved, captured and promoted piece (4 bits
+// each, offset by 6)
+type PackedMove uint32
+
+// Pack encodes a move
+func (m Move) Pack() PackedMove {
+	return PackedMove(sq64(m.From)) |
+		PackedMove(sq64(m.To))<<6 |
+		PackedMove(m.Special)<<12 |
+		PackedMove(m.MovedPiece+6)<<15 |
+		PackedMove(m.Content+6)<<19 |
+		PackedMove(m.Promoted+6)<<23
+}
+
+// Unpack decodes a move, the zero value decodes to an empty move
+func (p PackedMove) Unpack() Move {
+	if p == 0 {
+		return Move{}
+	}
+	return Move{
+		From:       sq0x88(int(p & 63)),
+		To:         sq0x88(int(p >> 6 & 63)),
+		Special:    int8(p >> 12 & 7),
+		MovedPiece: int8(p>>15&15) - 6,
+		Content:    int8(p>>19&15) - 6,
+		Promoted:   int8(p>>23&15) - 6,
+	}
+}
+
 func (m Move) String() string {
 
-	if m.Special == moveCastelingLong {
+	if m.Special == moveNull {
+		return "0000"
+
+	} else if m.Special == moveCastelingLong {
 		return "O-O-O"
 
 	} else if m.Special == moveCastelingShort {
 		return "O-O"
 	}
 
+	if m.Special == moveDrop {
+		return m.coordinate()
+	}
+
 	str := SquareMap[m.From]
 
 	if m.Content != Empty {
@@ -48,6 +87,32 @@ func (m Move) String() string {
 	return str
 }
 
+// coordinate returns the move in coordinate notation as used by other
+// engines, e.g. e2e4, e1g1 for castling, e7e8q or P@e4 for a drop
+func (m Move) coordinate() string {
+	if m.Special == moveDrop {
+		return symbols[abs(m.MovedPiece)] + "@" + SquareMap[m.To]
+	}
+	str := SquareMap[m.From] + SquareMap[m.To]
+	if m.Special == movePromotion {
+		str += symbols[abs(m.Promoted)+6]
+	}
+	return str
+}
+
+// castlingDir returns castleShort or castleLong for a castling move
+func castlingDir(m Move) int8 {
+	if m.Special == moveCastelingShort {
+		return castleShort
+	}
+	return castleLong
+}
+
+// isQuietMove is true for all moves but captures and promotions
+func isQuietMove(m Move) bool {
+	return m.Content == Empty && m.Special != movePromotion && m.Special != moveEnPassant
+}
+
 func createMove(str string) (Move, error) {
 
 	// TODO castling/promotion
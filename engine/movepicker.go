@@ -0,0 +1,180 @@
+package engine
+
+// stages of the move picker
+const (
+	pickHash int8 = iota
+	pickCapturesInit
+	pickGoodCaptures
+	pickKillers
+	pickQuietsInit
+	pickQuiets
+	pickBadCaptures
+	pickDone
+)
+
+// movePicker hands out the moves of a position in stages and only
+// generates the moves of a stage when it is reached: the hash move first,
+// winning and equal captures by MVV-LVA, killers and the counter move, the
+// remaining quiet moves by their history scores and losing captures last.
+// Once skipQuiets is set no more quiet moves are returned.
+type movePicker struct {
+	pv           *pvSearch
+	frame        *searchFrame
+	generator    Generator
+	stage        int8
+	hashMove     Move
+	refutations  [3]Move
+	nRefutations int
+	moves        []orderedMove
+	index        int
+	badCaptures  []Move
+	skipQuiets   bool
+}
+
+// newMovePicker prepares the generator, the hash move is only played if it
+// is legal in the current position. The picker and its moves live in the
+// frame of the node.
+func newMovePicker(pv *pvSearch, frame *searchFrame, hashMove Move) *movePicker {
+	mp := &frame.picker
+	*mp = movePicker{pv: pv, frame: frame, generator: Generator{board: pv.board, buffer: &frame.moves},
+		moves: frame.ordered[:0], badCaptures: frame.bad[:0]}
+	mp.generator.prepare()
+
+	if hashMove.MovedPiece != Empty && mp.generator.isLegal(hashMove) {
+		mp.hashMove = hashMove
+	}
+
+	return mp
+}
+
+func (mp *movePicker) inCheck() bool {
+	return mp.generator.kingUnderCheck
+}
+
+// next returns the next move to search, false if there are no moves left
+func (mp *movePicker) next() (Move, bool) {
+	for {
+		switch mp.stage {
+		case pickHash:
+			mp.stage++
+			if mp.hashMove.MovedPiece != Empty {
+				return mp.hashMove, true
+			}
+
+		case pickCapturesInit:
+			mp.generator.generate(generateCaptures, Invalid)
+			mp.score(func(m Move) int { return mvvLva(m) })
+			mp.stage++
+
+		case pickGoodCaptures:
+			move, ok := mp.pick()
+			if !ok {
+				mp.initRefutations()
+				mp.stage++
+				continue
+			}
+			if mp.pv.board.SEE(move) < 0 {
+				mp.badCaptures = append(mp.badCaptures, move)
+				continue
+			}
+			return move, true
+
+		case pickKillers:
+			if mp.skipQuiets {
+				mp.index = 0
+				mp.stage = pickBadCaptures
+				continue
+			}
+			if mp.index < mp.nRefutations {
+				mp.index++
+				return mp.refutations[mp.index-1], true
+			}
+			mp.stage++
+
+		case pickQuietsInit:
+			mp.generator.generate(generateQuiets, Invalid)
+			mp.score(mp.pv.quietScore)
+			mp.stage++
+
+		case pickQuiets:
+			if move, ok := mp.pick(); ok && !mp.skipQuiets {
+				if !mp.isRefutation(move) {
+					return move, true
+				}
+				continue
+			}
+			mp.index = 0
+			mp.stage++
+
+		case pickBadCaptures:
+			if mp.index < len(mp.badCaptures) {
+				mp.index++
+				return mp.badCaptures[mp.index-1], true
+			}
+			mp.stage++
+
+		default:
+			return Move{}, false
+		}
+	}
+}
+
+// score takes the generated moves without the hash move
+func (mp *movePicker) score(f func(m Move) int) {
+	mp.moves = mp.moves[:0]
+	mp.index = 0
+	for _, move := range mp.generator.moves {
+		if move != mp.hashMove {
+			mp.moves = append(mp.moves, orderedMove{move, f(move)})
+		}
+	}
+}
+
+// pick selects the best remaining move, the moves are only sorted as far as
+// they are searched
+func (mp *movePicker) pick() (Move, bool) {
+	if mp.index >= len(mp.moves) {
+		return Move{}, false
+	}
+
+	best := mp.index
+	for i := mp.index + 1; i < len(mp.moves); i++ {
+		if mp.moves[i].score > mp.moves[best].score {
+			best = i
+		}
+	}
+	mp.moves[mp.index], mp.moves[best] = mp.moves[best], mp.moves[mp.index]
+	mp.index++
+
+	return mp.moves[mp.index-1].move, true
+}
+
+// initRefutations collects the legal killers and the counter move
+func (mp *movePicker) initRefutations() {
+	pv := mp.pv
+	killers := pv.history.killers[pv.board.ply]
+	candidates := [3]Move{killers[0], killers[1]}
+	if prev, ok := pv.previousMove(1); ok {
+		candidates[2] = pv.history.counterMoves[prev.MovedPiece+6][sq64(prev.To)]
+	}
+
+	mp.index = 0
+	for _, move := range candidates {
+		if move.MovedPiece == Empty || move == mp.hashMove || !isQuietMove(move) || mp.isRefutation(move) {
+			continue
+		}
+		if mp.generator.isLegal(move) {
+			mp.refutations[mp.nRefutations] = move
+			mp.nRefutations++
+		}
+	}
+}
+
+func (mp *movePicker) isRefutation(m Move) bool {
+	for _, move := range mp.refutations[:mp.nRefutations] {
+		if move == m {
+			return true
+		}
+	}
+	return false
+}
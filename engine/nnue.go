@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The network has 768 inputs (2 colors x 6 pieces x 64 squares) per
+// perspective, one hidden layer with clipped ReLU activation and a single
+// output. The hidden layer (accumulator) is updated incrementally while
+// moves are made on the board.
+const (
+	nnueInputs  = 2 * numPieces * 64
+	nnueVersion = 1
+	nnueMagic   = "GCNN"
+
+	nnueQA    = 255 // activation clipping, scale of the feature weights
+	nnueQB    = 64  // scale of the output weights
+	nnueScale = 400 // output to centipawns
+)
+
+// Network holds the quantised weights of an evaluation network
+//
+// File format (little endian):
+//
+//	magic           [4]byte   "GCNN"
+//	version         uint32    1
+//	hidden          uint32    size of the hidden layer
+//	featureWeights  [768][hidden]int16
+//	featureBias     [hidden]int16
+//	outputWeights   [2*hidden]int16   side to move first, then opponent
+//	outputBias      int32
+type Network struct {
+	hidden         int
+	featureWeights []int16
+	featureBias    []int16
+	outputWeights  []int16
+	outputBias     int32
+}
+
+// activeNetwork replaces the handcrafted evaluation if not nil
+var activeNetwork *Network
+
+// UseNetwork switches Evaluate to the given network, nil switches back to
+// the handcrafted evaluation
+func UseNetwork(n *Network) {
+	activeNetwork = n
+}
+
+// LoadNetwork reads a network from a file
+func LoadNetwork(path string) (*Network, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readNetwork(bufio.NewReader(f))
+}
+
+func readNetwork(r io.Reader) (*Network, error) {
+	header := struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}{}
+
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if string(header.Magic[:]) != nnueMagic {
+		return nil, errors.New("not a network file")
+	}
+
+	if header.Version != nnueVersion {
+		return nil, fmt.Errorf("unsupported network version %d", header.Version)
+	}
+
+	if header.Hidden == 0 || header.Hidden > 4096 {
+		return nil, fmt.Errorf("invalid hidden layer size %d", header.Hidden)
+	}
+
+	n := &Network{hidden: int(header.Hidden)}
+	n.featureWeights = make([]int16, nnueInputs*n.hidden)
+	n.featureBias = make([]int16, n.hidden)
+	n.outputWeights = make([]int16, 2*n.hidden)
+
+	for _, data := range []interface{}{n.featureWeights, n.featureBias, n.outputWeights, &n.outputBias} {
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, fmt.Errorf("truncated network: %v", err)
+		}
+	}
+
+	return n, nil
+}
+
+// nnueFeature returns the input index of a piece on a square as seen from
+// the given perspective
+func nnueFeature(perspective int8, piece int8, sq int8) int {
+	sq64 := int(rank(sq))*8 + int(file(sq))
+	color := 0
+
+	if perspective == Black {
+		sq64 ^= 56
+	}
+	if piece*perspective < 0 {
+		color = 1
+	}
+
+	return (color*numPieces+int(abs(piece))-1)*64 + sq64
+}
+
+// accumulator holds the hidden layer for both perspectives
+type accumulator [2][]int16
+
+// nnueState keeps one accumulator for every move made on a board
+type nnueState struct {
+	net   *Network
+	stack []accumulator
+	top   int
+}
+
+func newNNUEState(n *Network, b *Board) *nnueState {
+	s := &nnueState{net: n}
+	s.stack = []accumulator{s.newAccumulator()}
+	s.refresh(b)
+	return s
+}
+
+func (s *nnueState) newAccumulator() accumulator {
+	return accumulator{make([]int16, s.net.hidden), make([]int16, s.net.hidden)}
+}
+
+// refresh computes the current accumulator from scratch
+func (s *nnueState) refresh(b *Board) {
+	acc := s.stack[s.top]
+	copy(acc[0], s.net.featureBias)
+	copy(acc[1], s.net.featureBias)
+
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			sq := square(rank, file)
+			if b.data[sq] != Empty {
+				s.update(sq, Empty, b.data[sq])
+			}
+		}
+	}
+}
+
+func (s *nnueState) push() {
+	s.top++
+	if s.top == len(s.stack) {
+		s.stack = append(s.stack, s.newAccumulator())
+	}
+	copy(s.stack[s.top][0], s.stack[s.top-1][0])
+	copy(s.stack[s.top][1], s.stack[s.top-1][1])
+}
+
+// pop restores the previous accumulator, moves made before the state was
+// created require a refresh of the board after undoing the move
+func (s *nnueState) pop(b *Board) {
+	if s.top == 0 {
+		s.refresh(b)
+		return
+	}
+	s.top--
+}
+
+// update replaces the piece on a square in the current accumulator
+func (s *nnueState) update(sq int8, old, piece int8) {
+	acc := s.stack[s.top]
+	for p, perspective := range []int8{White, Black} {
+		if old != Empty {
+			w := s.net.featureWeights[nnueFeature(perspective, old, sq)*s.net.hidden:]
+			for i := range acc[p] {
+				acc[p][i] -= w[i]
+			}
+		}
+		if piece != Empty {
+			w := s.net.featureWeights[nnueFeature(perspective, piece, sq)*s.net.hidden:]
+			for i := range acc[p] {
+				acc[p][i] += w[i]
+			}
+		}
+	}
+}
+
+// evaluate returns the network output relative to the side to move
+func (s *nnueState) evaluate(sideToMove int8) int {
+	us, them := s.stack[s.top][0], s.stack[s.top][1]
+	if sideToMove == Black {
+		us, them = them, us
+	}
+
+	n := s.net
+	sum := int64(0)
+	for i := 0; i < n.hidden; i++ {
+		sum += int64(clippedReLU(us[i])) * int64(n.outputWeights[i])
+		sum += int64(clippedReLU(them[i])) * int64(n.outputWeights[n.hidden+i])
+	}
+
+	return int((sum + int64(n.outputBias)) * nnueScale / (nnueQA * nnueQB))
+}
+
+func clippedReLU(v int16) int16 {
+	if v < 0 {
+		return 0
+	}
+	if v > nnueQA {
+		return nnueQA
+	}
+	return v
+}
+
+// evaluateNetwork scores a board with the active network, the accumulators
+// are created on first use and follow all further moves on the board
+func evaluateNetwork(b *Board) int {
+	if b.nnue == nil || b.nnue.net != activeNetwork {
+		b.nnue = newNNUEState(activeNetwork, b)
+	}
+	return b.nnue.evaluate(b.sideToMove)
+}
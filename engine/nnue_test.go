@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// writeNetwork documents the network file format: a header of magic,
+// version and hidden layer size followed by all weights as little endian
+// int16 and the output bias as int32
+func writeNetwork(n *Network) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(nnueMagic)
+	binary.Write(buf, binary.LittleEndian, uint32(nnueVersion))
+	binary.Write(buf, binary.LittleEndian, uint32(n.hidden))
+	binary.Write(buf, binary.LittleEndian, n.featureWeights) // [768][hidden]
+	binary.Write(buf, binary.LittleEndian, n.featureBias)    // [hidden]
+	binary.Write(buf, binary.LittleEndian, n.outputWeights)  // [2*hidden], side to move first
+	binary.Write(buf, binary.LittleEndian, n.outputBias)
+	return buf.Bytes()
+}
+
+func randomNetwork(hidden int, seed int64) *Network {
+	r := rand.New(rand.NewSource(seed))
+	n := &Network{hidden: hidden, outputBias: int32(r.Intn(200) - 100)}
+
+	n.featureWeights = make([]int16, nnueInputs*hidden)
+	for i := range n.featureWeights {
+		n.featureWeights[i] = int16(r.Intn(41) - 20)
+	}
+	n.featureBias = make([]int16, hidden)
+	for i := range n.featureBias {
+		n.featureBias[i] = int16(r.Intn(101))
+	}
+	n.outputWeights = make([]int16, 2*hidden)
+	for i := range n.outputWeights {
+		n.outputWeights[i] = int16(r.Intn(129) - 64)
+	}
+
+	return n
+}
+
+func TestReadNetwork(t *testing.T) {
+	expected := randomNetwork(16, 1)
+	data := writeNetwork(expected)
+
+	n, err := readNetwork(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.hidden != 16 || n.outputBias != expected.outputBias ||
+		n.featureWeights[nnueInputs*16-1] != expected.featureWeights[nnueInputs*16-1] ||
+		n.outputWeights[31] != expected.outputWeights[31] {
+		t.Errorf("Expected the network to be read back unchanged\n")
+	}
+
+	if _, err := readNetwork(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Errorf("Expected an error for a truncated network\n")
+	}
+}
+
+func TestNetworkAccumulatorFollowsMoves(t *testing.T) {
+	UseNetwork(randomNetwork(32, 2))
+	defer UseNetwork(nil)
+
+	r := rand.New(rand.NewSource(3))
+
+	for _, fen := range []string{defaultFEN, position2FEN} {
+		b := NewBoard(fen)
+		scores := []int{Evaluate(b)}
+
+		for ply := 0; ply < 60; ply++ {
+			moves := NewGenerator(b).GenerateMoves()
+			if len(moves) == 0 {
+				break
+			}
+			b.MakeMove(moves[r.Intn(len(moves))])
+
+			actual := Evaluate(b)
+			if expected := newNNUEState(activeNetwork, b).evaluate(b.sideToMove); actual != expected {
+				t.Fatalf("Expected %d but got %d after %s\n%s\n", expected, actual, generateFEN(b), formatBoard(b))
+			}
+			scores = append(scores, actual)
+		}
+
+		for i := len(scores) - 2; i >= 0; i-- {
+			b.UndoMove()
+			if actual := Evaluate(b); actual != scores[i] {
+				t.Fatalf("Expected %d but got %d after undo to %s\n", scores[i], actual, generateFEN(b))
+			}
+		}
+	}
+}
+
+func TestNetworkFeatureIsColorSymmetric(t *testing.T) {
+	if nnueFeature(White, WhiteKnight, int8(B1)) != nnueFeature(Black, BlackKnight, int8(B8)) {
+		t.Errorf("Expected own knights on b1/b8 to share a feature\n")
+	}
+	if nnueFeature(White, BlackPawn, int8(E7)) != nnueFeature(Black, WhitePawn, int8(E2)) {
+		t.Errorf("Expected opponent pawns on e7/e2 to share a feature\n")
+	}
+}
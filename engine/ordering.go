@@ -0,0 +1,149 @@
+package engine
+
+import "math"
+
+const (
+	historyMax = 16384 // history scores are kept within +/- historyMax
+
+	lmrMinDepth     = 3    // no reductions close to the horizon
+	lmrMinMoves     = 3    // the first moves are never reduced
+	lmrHistoryScore = 8192 // history score per ply of less/more reduction
+)
+
+var lmrTable [searchMaxDepth + 2][64]int
+
+func init() {
+	for depth := 1; depth < len(lmrTable); depth++ {
+		for moves := 1; moves < len(lmrTable[depth]); moves++ {
+			lmrTable[depth][moves] = int(0.75 + math.Log(float64(depth))*math.Log(float64(moves))/2.25)
+		}
+	}
+}
+
+// moveHistory collects the statistics for ordering quiet moves
+type moveHistory struct {
+	killers      [searchMaxPly][2]Move
+	butterfly    [2][64][64]int32
+	counterMoves [13][64]Move
+	continuation [13][64][13][64]int16
+}
+
+type orderedMove struct {
+	move  Move
+	score int
+}
+
+func sq64(s Square) int {
+	return int(rank(int8(s)))*8 + int(file(int8(s)))
+}
+
+func colorIndex(color int8) int {
+	if color == White {
+		return 0
+	}
+	return 1
+}
+
+// previousMove returns the move made the given number of plies ago, null
+// moves and moves before the start position don't count
+func (pv *pvSearch) previousMove(plies int) (Move, bool) {
+	history := pv.board.history
+	if len(history) < plies {
+		return Move{}, false
+	}
+	m := history[len(history)-plies].move
+	return m, m.Special != moveNull
+}
+
+func (pv *pvSearch) isKiller(m Move) bool {
+	killers := pv.history.killers[pv.board.ply]
+	return m == killers[0] || m == killers[1]
+}
+
+// quietScore combines the butterfly and continuation histories
+func (pv *pvSearch) quietScore(m Move) int {
+	h := pv.history
+	score := int(h.butterfly[colorIndex(pv.board.sideToMove)][sq64(m.From)][sq64(m.To)])
+
+	for plies := 1; plies <= 2; plies++ {
+		if prev, ok := pv.previousMove(plies); ok {
+			score += int(h.continuation[prev.MovedPiece+6][sq64(prev.To)][m.MovedPiece+6][sq64(m.To)])
+		}
+	}
+
+	return score
+}
+
+// updateHistory rewards a quiet move which caused a beta cutoff and
+// penalizes the quiet moves searched before it
+func (pv *pvSearch) updateHistory(best Move, quiets []Move, depth int) {
+	h := pv.history
+	ply := pv.board.ply
+
+	if h.killers[ply][0] != best {
+		h.killers[ply][1] = h.killers[ply][0]
+		h.killers[ply][0] = best
+	}
+
+	if prev, ok := pv.previousMove(1); ok {
+		h.counterMoves[prev.MovedPiece+6][sq64(prev.To)] = best
+	}
+
+	bonus := 32 * depth * depth
+	if bonus > historyMax {
+		bonus = historyMax
+	}
+
+	pv.addHistory(best, bonus)
+	for _, m := range quiets {
+		pv.addHistory(m, -bonus)
+	}
+}
+
+func (pv *pvSearch) addHistory(m Move, bonus int) {
+	h := pv.history
+
+	b := &h.butterfly[colorIndex(pv.board.sideToMove)][sq64(m.From)][sq64(m.To)]
+	*b = int32(gravity(int(*b), bonus))
+
+	for plies := 1; plies <= 2; plies++ {
+		if prev, ok := pv.previousMove(plies); ok {
+			c := &h.continuation[prev.MovedPiece+6][sq64(prev.To)][m.MovedPiece+6][sq64(m.To)]
+			*c = int16(gravity(int(*c), bonus))
+		}
+	}
+}
+
+// gravity applies a bonus while keeping the value within +/- historyMax
+func gravity(value, bonus int) int {
+	abs := bonus
+	if abs < 0 {
+		abs = -abs
+	}
+	return value + bonus - value*abs/historyMax
+}
+
+// reduction returns the late move reduction for a quiet move
+func (pv *pvSearch) reduction(depth, moveNumber int, move Move) int {
+	if depth < lmrMinDepth || moveNumber < lmrMinMoves {
+		return 0
+	}
+
+	d, n := depth, moveNumber
+	if d >= len(lmrTable) {
+		d = len(lmrTable) - 1
+	}
+	if n >= len(lmrTable[d]) {
+		n = len(lmrTable[d]) - 1
+	}
+
+	r := lmrTable[d][n] - pv.quietScore(move)/lmrHistoryScore
+
+	if r < 0 {
+		return 0
+	}
+	if r > depth-2 {
+		return depth - 2
+	}
+	return r
+}
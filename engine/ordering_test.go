@@ -0,0 +1,91 @@
+package engine
+
+import "testing"
+
+func TestHistoryGravityStaysInBounds(t *testing.T) {
+	value := 0
+	for i := 0; i < 1000; i++ {
+		value = gravity(value, historyMax)
+	}
+	if value > historyMax {
+		t.Errorf("Expected at most %d but got %d\n", historyMax, value)
+	}
+
+	for i := 0; i < 1000; i++ {
+		value = gravity(value, -historyMax)
+	}
+	if value < -historyMax {
+		t.Errorf("Expected at least %d but got %d\n", -historyMax, value)
+	}
+}
+
+func TestMovePickerPutsKillersBeforeQuietMoves(t *testing.T) {
+	pv := pvSearch{board: NewBoard(position2FEN), history: new(moveHistory)}
+
+	killer := Move{}
+	for _, m := range NewGenerator(pv.board).GenerateMoves() {
+		if m.From == A2 && m.To == A4 {
+			killer = m
+		}
+	}
+	pv.history.killers[0][0] = killer
+
+	moves := []Move{}
+	picker := newMovePicker(&pv, new(searchFrame), Move{})
+	for move, ok := picker.next(); ok; move, ok = picker.next() {
+		moves = append(moves, move)
+	}
+
+	for i, m := range moves {
+		if m == killer {
+			break
+		}
+		if isQuietMove(m) {
+			t.Fatalf("Expected killer %s before quiet move %s at %d\n", killer, m, i)
+		}
+	}
+
+	for i := 1; i < len(moves); i++ {
+		if !isQuietMove(moves[i]) && pv.board.SEE(moves[i]) >= 0 && isQuietMove(moves[i-1]) {
+			t.Errorf("Expected winning captures before quiet moves but found %s after %s\n", moves[i], moves[i-1])
+		}
+		if isQuietMove(moves[i]) && !isQuietMove(moves[i-1]) && pv.board.SEE(moves[i-1]) < 0 {
+			t.Errorf("Expected losing captures after quiet moves but found %s before %s\n", moves[i-1], moves[i])
+		}
+	}
+}
+
+func TestMovePickerReturnsAllMoves(t *testing.T) {
+	for _, fen := range []string{defaultFEN, position2FEN, "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1"} {
+		pv := pvSearch{board: NewBoard(fen), history: new(moveHistory)}
+		moves := NewGenerator(pv.board).GenerateMoves()
+
+		// the hash move must not be returned twice
+		picked := map[Move]int{}
+		picker := newMovePicker(&pv, new(searchFrame), moves[len(moves)-1])
+		for move, ok := picker.next(); ok; move, ok = picker.next() {
+			picked[move]++
+		}
+
+		if len(picked) != len(moves) {
+			t.Errorf("Expected %d moves but got %d for %s\n", len(moves), len(picked), fen)
+		}
+		for _, m := range moves {
+			if picked[m] != 1 {
+				t.Errorf("Expected %s once but got it %d times for %s\n", m, picked[m], fen)
+			}
+		}
+	}
+}
+
+func TestMovePickerSkipsQuietMoves(t *testing.T) {
+	pv := pvSearch{board: NewBoard(position2FEN), history: new(moveHistory)}
+	picker := newMovePicker(&pv, new(searchFrame), Move{})
+	picker.skipQuiets = true
+
+	for move, ok := picker.next(); ok; move, ok = picker.next() {
+		if isQuietMove(move) {
+			t.Errorf("Expected no quiet moves but got %s\n", move)
+		}
+	}
+}
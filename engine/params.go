@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// evalParam is a named group of tunable evaluation weights or search
+// margins
+type evalParam struct {
+	name   string
+	values []*int
+}
+
+var evalParams = []evalParam{
+	scalarParam("pawnValue", &pawnValue),
+	scalarParam("knightValue", &knightValue),
+	scalarParam("bishopValue", &bishopValue),
+	scalarParam("rookValue", &rookValue),
+	scalarParam("queenValue", &queenValue),
+	scalarParam("evalPenaltyDoublePawn", &evalPenaltyDoublePawn),
+	scalarParam("evalBonusCheck", &evalBonusCheck),
+	tableParam("pawnTable", pawnTable),
+	tableParam("knightTable", knightTable),
+	tableParam("bishopTable", bishopTable),
+	tableParam("rookTable", rookTable),
+	tableParam("queenTable", queenTable),
+	tableParam("kingTableMiddle", kingTableMiddle),
+	tableParam("kingTableEnd", kingTableEnd),
+}
+
+// defaultParams are the built-in values of all parameters, as snapshot
+var defaultParams = snapshotParams()
+
+// searchParams can be set like the evaluation weights, e.g. to compare
+// margins in engine matches, but are not changed by the tuner
+var searchParams = []evalParam{
+	scalarParam("reverseFutilityMargin", &reverseFutilityMargin),
+	scalarParam("razorMargin", &razorMargin),
+	scalarParam("futilityMargin", &futilityMargin),
+	scalarParam("lateMoveCount", &lateMoveCount),
+	scalarParam("deltaMargin", &deltaMargin),
+}
+
+func scalarParam(name string, value *int) evalParam {
+	return evalParam{name: name, values: []*int{value}}
+}
+
+// tableParam only exposes the 64 squares of a 0x88 piece square table
+func tableParam(name string, table []int) evalParam {
+	p := evalParam{name: name}
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			p.values = append(p.values, &table[square(rank, file)])
+		}
+	}
+	return p
+}
+
+// paramVector returns a copy of all tunable weights
+func paramVector() []int {
+	v := []int{}
+	for _, p := range evalParams {
+		for _, value := range p.values {
+			v = append(v, *value)
+		}
+	}
+	return v
+}
+
+// setParamVector writes a vector as returned by paramVector back
+func setParamVector(v []int) {
+	i := 0
+	for _, p := range evalParams {
+		for _, value := range p.values {
+			*value = v[i]
+			i++
+		}
+	}
+}
+
+// LoadParams reads evaluation weights and search margins from a parameter
+// file
+//
+// Each line holds a parameter name followed by its values; piece square
+// tables list their 64 values from a1 to h8. Unknown names are an error,
+// missing ones keep their current value.
+func LoadParams(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if err := setParam(fields[0], fields[1:]); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// SetParam sets a single evaluation weight or search margin, tables expect
+// all of their values separated by spaces
+func SetParam(name, values string) error {
+	return setParam(name, strings.Fields(values))
+}
+
+func setParam(name string, fields []string) error {
+	p := findParam(name)
+	if p == nil {
+		return fmt.Errorf("unknown parameter %q", name)
+	}
+
+	if len(fields) != len(p.values) {
+		return fmt.Errorf("%s expects %d values", p.name, len(p.values))
+	}
+
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+
+	for i, value := range values {
+		*p.values[i] = value
+	}
+	return nil
+}
+
+// SaveParams writes the current evaluation weights to a parameter file
+func SaveParams(path string) error {
+	// write to a temporary file first, so an interrupted run never leaves a
+	// broken parameter file behind
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, p := range evalParams {
+		fmt.Fprintf(w, "%s", p.name)
+		for i, value := range p.values {
+			if len(p.values) > 1 && i%8 == 0 {
+				fmt.Fprintf(w, " ")
+			}
+			fmt.Fprintf(w, " %d", *value)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func findParam(name string) *evalParam {
+	for _, params := range [][]evalParam{evalParams, searchParams} {
+		for i := range params {
+			if params[i].name == name {
+				return &params[i]
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotParams returns a copy of all evaluation weights and search
+// margins
+func snapshotParams() []int {
+	v := []int{}
+	for _, params := range [][]evalParam{evalParams, searchParams} {
+		for _, p := range params {
+			for _, value := range p.values {
+				v = append(v, *value)
+			}
+		}
+	}
+	return v
+}
+
+// restoreParams writes a snapshot as returned by snapshotParams back
+func restoreParams(v []int) {
+	i := 0
+	for _, params := range [][]evalParam{evalParams, searchParams} {
+		for _, p := range params {
+			for _, value := range p.values {
+				*value = v[i]
+				i++
+			}
+		}
+	}
+}
+
+// readParamSet returns the snapshot of the current parameters changed by
+// a parameter file, the current parameters stay untouched
+func readParamSet(path string) ([]int, error) {
+	saved := snapshotParams()
+	defer restoreParams(saved)
+
+	if path == "" {
+		return saved, nil
+	}
+	if err := LoadParams(path); err != nil {
+		return nil, err
+	}
+	return snapshotParams(), nil
+}
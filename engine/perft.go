@@ -1,6 +1,14 @@
 package engine
 
-import "time"
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var perftHashSize = 16 // size of the perft cache in MB, 0 disables it
 
 var (
 	position1FEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
@@ -46,9 +54,15 @@ func Perft(fen string, expected []PerftData) {
 }
 
 func perft(depth int, board *Board) PerftData {
+	return perftBuffered(depth, board, make([]MoveBuffer, depth+1))
+}
+
+// perftBuffered generates the moves of each depth into its own buffer, so
+// counting the nodes doesn't allocate memory
+func perftBuffered(depth int, board *Board, buffers []MoveBuffer) PerftData {
 
 	data := PerftData{depth: depth}
-	generator := NewGenerator(board)
+	generator := Generator{board: board}
 
 	start := time.Now()
 
@@ -58,7 +72,7 @@ func perft(depth int, board *Board) PerftData {
 		return data
 	}
 
-	moves := generator.GenerateMoves()
+	moves := generator.GenerateMovesInto(&buffers[depth])
 
 	if len(moves) == 0 {
 		data.mates++
@@ -71,7 +85,7 @@ func perft(depth int, board *Board) PerftData {
 	for _, move := range moves {
 		board.MakeMove(move)
 
-		res := perft(depth-1, board)
+		res := perftBuffered(depth-1, board, buffers)
 		data.nodes += res.nodes
 		data.captures += res.captures
 		data.enPassants += res.enPassants
@@ -111,3 +125,156 @@ func perft(depth int, board *Board) PerftData {
 
 	return data
 }
+
+// PerftResult holds the leaf nodes of a perft run, also divided by the
+// root moves
+type PerftResult struct {
+	Depth   int
+	Nodes   int64
+	Moves   []Move
+	Divide  []int64 // the nodes below each of the moves
+	Elapsed time.Duration
+}
+
+// NPS returns the nodes counted per second
+func (r PerftResult) NPS() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Nodes) / r.Elapsed.Seconds()
+}
+
+// RunPerft counts the leaf nodes of the given depth. The root moves are
+// split among the threads, defaulting to the number of cores, which share a
+// cache of the subtree counts.
+func RunPerft(board *Board, depth, threads int) PerftResult {
+	if threads < 1 {
+		threads = runtime.NumCPU()
+	}
+
+	start := time.Now()
+	result := PerftResult{Depth: depth, Nodes: 1}
+	if depth < 1 {
+		return result
+	}
+
+	result.Moves = NewGenerator(board).GenerateMoves()
+	result.Divide = make([]int64, len(result.Moves))
+	cache := newPerftCache(perftHashSize)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := board.Clone()
+			buffers := make([]MoveBuffer, depth)
+			for index := range indexes {
+				b.MakeMove(result.Moves[index])
+				result.Divide[index] = perftNodes(depth-1, b, buffers, cache)
+				b.UndoMove()
+			}
+		}()
+	}
+
+	for i := range result.Moves {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	result.Nodes = 0
+	for _, nodes := range result.Divide {
+		result.Nodes += nodes
+	}
+	result.Elapsed = time.Since(start)
+
+	return result
+}
+
+// perftNodes only counts the leaf nodes, the moves of the last ply are
+// counted without making them
+func perftNodes(depth int, board *Board, buffers []MoveBuffer, cache *perftCache) int64 {
+	if depth == 0 {
+		return 1
+	}
+
+	if nodes, ok := cache.probe(board.currentHash, depth); ok {
+		return nodes
+	}
+
+	generator := Generator{board: board, buffer: &buffers[depth]}
+	generator.prepare()
+	generator.generate(generateAll, Invalid)
+
+	if depth == 1 {
+		return int64(len(generator.moves))
+	}
+
+	nodes := int64(0)
+	for _, move := range generator.moves {
+		board.MakeMove(move)
+		nodes += perftNodes(depth-1, board, buffers, cache)
+		board.UndoMove()
+	}
+
+	cache.store(board.currentHash, depth, nodes)
+
+	return nodes
+}
+
+// perftEntry is written and read without locks, the check is the key
+// xor the nodes, so an entry torn by concurrent writes doesn't match
+type perftEntry struct {
+	check uint64
+	nodes uint64
+}
+
+// perftCache stores the leaf nodes of subtrees by position hash and depth
+type perftCache struct {
+	entries []perftEntry
+	mask    uint64
+}
+
+// newPerftCache creates a cache of at most the given size in MB, or none
+func newPerftCache(mb int) *perftCache {
+	if mb <= 0 {
+		return nil
+	}
+
+	n := uint64(1)
+	for (n*2)*uint64(unsafe.Sizeof(perftEntry{})) <= uint64(mb)<<20 {
+		n *= 2
+	}
+	return &perftCache{entries: make([]perftEntry, n), mask: n - 1}
+}
+
+func perftKey(hash int64, depth int) uint64 {
+	return uint64(hash) ^ uint64(depth)*0x9e3779b97f4a7c15
+}
+
+func (c *perftCache) probe(hash int64, depth int) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+
+	key := perftKey(hash, depth)
+	e := &c.entries[key&c.mask]
+	check, nodes := atomic.LoadUint64(&e.check), atomic.LoadUint64(&e.nodes)
+	if check^nodes != key {
+		return 0, false
+	}
+	return int64(nodes), true
+}
+
+func (c *perftCache) store(hash int64, depth int, nodes int64) {
+	if c == nil {
+		return
+	}
+
+	key := perftKey(hash, depth)
+	e := &c.entries[key&c.mask]
+	atomic.StoreUint64(&e.nodes, uint64(nodes))
+	atomic.StoreUint64(&e.check, key^uint64(nodes))
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PerftSuiteOptions restricts a run of a perft suite
+type PerftSuiteOptions struct {
+	MaxDepth int   // deeper counts are skipped, 0 means no limit
+	MaxNodes int64 // counts expecting more nodes are skipped, 0 means no limit
+	Threads  int   // threads per perft, defaults to the number of cores
+}
+
+// PerftFailure describes the first depth of a position with a wrong node
+// count, the counts of the root moves help finding the wrong move
+type PerftFailure struct {
+	FEN      string
+	Expected int64
+	Result   PerftResult
+}
+
+func (f PerftFailure) String() string {
+	s := fmt.Sprintf("%s: expected %d nodes at depth %d but got %d\n",
+		f.FEN, f.Expected, f.Result.Depth, f.Result.Nodes)
+	for i, move := range f.Result.Moves {
+		s += fmt.Sprintf("  %s: %d\n", move.coordinate(), f.Result.Divide[i])
+	}
+	return s
+}
+
+// perftCase is a position of a suite with the expected counts
+type perftCase struct {
+	fen     string
+	variant string
+	depths  []perftDepth
+}
+
+type perftDepth struct {
+	depth int
+	nodes int64
+}
+
+// readPerftSuite reads an EPD file with lines like
+// "<fen> ;D1 20 ;D2 400", optionally with the rules as in
+// "<fen> ;variant antichess ;D1 20". Empty lines and lines starting with #
+// are skipped.
+func readPerftSuite(path string) ([]perftCase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cases := []perftCase{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		c, err := parsePerftCase(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		cases = append(cases, c)
+	}
+
+	return cases, scanner.Err()
+}
+
+func parsePerftCase(text string) (perftCase, error) {
+	fields := strings.Split(text, ";")
+	c := perftCase{fen: strings.TrimSpace(fields[0])}
+
+	for _, field := range fields[1:] {
+		op := strings.Fields(field)
+		if len(op) == 2 && op[0] == "variant" {
+			c.variant = op[1]
+			continue
+		}
+		if len(op) != 2 || !strings.HasPrefix(op[0], "D") {
+			return c, fmt.Errorf("invalid depth %q", strings.TrimSpace(field))
+		}
+
+		depth, err := strconv.Atoi(op[0][1:])
+		if err != nil || depth < 1 {
+			return c, fmt.Errorf("invalid depth %q", op[0])
+		}
+		nodes, err := strconv.ParseInt(op[1], 10, 64)
+		if err != nil {
+			return c, fmt.Errorf("invalid node count %q", op[1])
+		}
+
+		c.depths = append(c.depths, perftDepth{depth, nodes})
+	}
+
+	if _, err := NewVariantBoard(c.variant, c.fen); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// run counts the nodes of all depths within the limits, it stops at the
+// first wrong count
+func (c perftCase) run(options PerftSuiteOptions) (nodes int64, failure *PerftFailure) {
+	b, _ := NewVariantBoard(c.variant, c.fen)
+
+	for _, d := range c.depths {
+		if (options.MaxDepth > 0 && d.depth > options.MaxDepth) ||
+			(options.MaxNodes > 0 && d.nodes > options.MaxNodes) {
+			continue
+		}
+
+		result := RunPerft(b, d.depth, options.Threads)
+		nodes += result.Nodes
+
+		if result.Nodes != d.nodes {
+			return nodes, &PerftFailure{FEN: c.fen, Expected: d.nodes, Result: result}
+		}
+	}
+
+	return nodes, nil
+}
+
+// checkPerftSuite runs all positions and returns the failing ones
+func checkPerftSuite(cases []perftCase, options PerftSuiteOptions) []PerftFailure {
+	failures := []PerftFailure{}
+	for _, c := range cases {
+		if _, failure := c.run(options); failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+	return failures
+}
+
+// PerftSuite runs the positions of an EPD perft suite and prints the
+// results, failing positions together with the divided counts of the first
+// wrong depth
+func PerftSuite(path string, options PerftSuiteOptions) error {
+	cases, err := readPerftSuite(path)
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, c := range cases {
+		nodes, failure := c.run(options)
+		if failure != nil {
+			failures++
+			fmt.Printf("%s", failure)
+			continue
+		}
+		if nodes == 0 {
+			fmt.Printf("%s: skipped\n", c.fen)
+			continue
+		}
+		fmt.Printf("%s: %s nodes ok\n", c.fen, formatNodesCount(nodes))
+	}
+	fmt.Printf("%d positions checked, %d failures\n", len(cases), failures)
+
+	return nil
+}
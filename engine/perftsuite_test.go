@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPerftSuite(t *testing.T) {
+	// the depth 6 counts of the Chess960 suite take minutes
+	for path, maxNodes := range map[string]int64{"testdata/perftsuite.epd": 0, "testdata/chess960.epd": 40000000,
+		"testdata/variants.epd": 5000000} {
+		cases, err := readPerftSuite(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		options := PerftSuiteOptions{MaxNodes: maxNodes}
+		if testing.Short() {
+			options.MaxNodes = 1000000
+		}
+
+		for _, f := range checkPerftSuite(cases, options) {
+			t.Errorf("%s", f)
+		}
+	}
+}
+
+func TestPerftSuiteReportsFirstFailingDepth(t *testing.T) {
+	c, err := parsePerftCase(position1FEN + " ;D1 20 ;D2 401 ;D3 8902")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, failure := c.run(PerftSuiteOptions{})
+	if failure == nil || failure.Result.Depth != 2 || failure.Expected != 401 || failure.Result.Nodes != 400 {
+		t.Fatalf("Expected a failure at depth 2 but got %v\n", failure)
+	}
+	if s := failure.String(); !strings.Contains(s, "e2e4: 20\n") {
+		t.Errorf("Expected the divided counts but got %s\n", s)
+	}
+}
+
+func TestParsePerftCase(t *testing.T) {
+	for _, text := range []string{position1FEN + " ;D1", position1FEN + " ;X1 20", position1FEN + " ;D0 1", position1FEN + " ;D1 x"} {
+		if _, err := parsePerftCase(text); err == nil {
+			t.Errorf("Expected an error for %q\n", text)
+		}
+	}
+}
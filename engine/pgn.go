@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const pgnLineLength = 80
+
+var pgnMoveNumber = regexp.MustCompile(`^[0-9]+\.+`)
+
+// pgnTag is a tag pair like [White "gochess"]
+type pgnTag struct {
+	name  string
+	value string
+}
+
+// pgnGame is a game in portable game notation
+type pgnGame struct {
+	tags    []pgnTag
+	fen     string   // start position, empty for the initial position
+	moves   []string // in SAN
+	result  string
+	comment string // written after the last move
+}
+
+// statusResult returns the result of a finished game and how it ended
+func statusResult(b *Board) (string, string) {
+	switch b.status {
+	case statusWhiteMates:
+		return "1-0", "black is mated"
+	case statusBlackMates:
+		return "0-1", "white is mated"
+	case statusWhiteWins:
+		return "1-0", "white wins"
+	case statusBlackWins:
+		return "0-1", "black wins"
+	case statusStaleMate:
+		return "1/2-1/2", "stalemate"
+	case statusDraw:
+		if b.halfMoveClock >= 100 {
+			return "1/2-1/2", "fifty move rule"
+		} else if b.repetitions() >= 2 {
+			return "1/2-1/2", "draw by repetition"
+		}
+		return "1/2-1/2", "insufficient material"
+	}
+	return "*", ""
+}
+
+func (g *pgnGame) tag(name string) string {
+	for _, t := range g.tags {
+		if t.name == name {
+			return t.value
+		}
+	}
+	return ""
+}
+
+// String writes the game in export format, move text lines are wrapped
+func (g *pgnGame) String() string {
+	s := ""
+	for _, t := range g.tags {
+		s += fmt.Sprintf("[%s \"%s\"]\n", t.name, strings.Replace(t.value, "\"", "'", -1))
+	}
+	s += "\n"
+
+	// move numbers continue from the start position
+	number, black := 1, false
+	if g.fen != "" {
+		if b, err := parseFEN(g.fen); err == nil {
+			number, black = b.fullMoves, b.sideToMove == Black
+		}
+	}
+
+	tokens := []string{}
+	for i, move := range g.moves {
+		switch {
+		case !black:
+			tokens = append(tokens, fmt.Sprintf("%d.", number))
+		case i == 0:
+			tokens = append(tokens, fmt.Sprintf("%d...", number))
+		}
+		tokens = append(tokens, move)
+
+		if black {
+			number++
+		}
+		black = !black
+	}
+	if g.comment != "" {
+		tokens = append(tokens, "{"+g.comment+"}")
+	}
+	tokens = append(tokens, g.result)
+
+	line := ""
+	for _, token := range tokens {
+		if line != "" && len(line)+1+len(token) > pgnLineLength {
+			s += line + "\n"
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += token
+	}
+	return s + line + "\n\n"
+}
+
+// readPGN calls f with each game of a PGN file and its text, games start
+// with their tags or, without tags, with the move text
+func readPGN(r io.Reader, f func(g *pgnGame, text string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	text, moveText := "", false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && moveText {
+			if err := f(parsePGN(text), text); err != nil {
+				return err
+			}
+			text, moveText = "", false
+		}
+
+		if trimmed != "" && !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(line, "%") {
+			moveText = true
+		}
+		if trimmed != "" || text != "" {
+			text += line + "\n"
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(text) != "" {
+		return f(parsePGN(text), text)
+	}
+	return nil
+}
+
+// parsePGN reads the tags and the main line of a game, comments,
+// variations and annotations are skipped
+func parsePGN(text string) *pgnGame {
+	g := &pgnGame{result: "*"}
+
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '[' && (len(g.moves) == 0):
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			if tag, ok := parsePGNTag(text[i : i+end]); ok {
+				g.tags = append(g.tags, tag)
+			}
+			i += end
+
+		case c == '{':
+			i = skipPGN(text, i, '}')
+
+		case c == ';' || c == '%' && (i == 0 || text[i-1] == '\n'):
+			// the escape % only counts in the first column
+			i = skipPGN(text, i, '\n')
+
+		case c == '(':
+			// variations may be nested
+			for depth := 0; i < len(text); i++ {
+				if text[i] == '(' {
+					depth++
+				} else if text[i] == ')' {
+					if depth--; depth == 0 {
+						i++
+						break
+					}
+				} else if text[i] == '{' {
+					i = skipPGN(text, i, '}') - 1
+				}
+			}
+
+		case strings.IndexByte(" \t\r\n)}", c) >= 0:
+			i++
+
+		default:
+			end := i
+			for end < len(text) && strings.IndexByte(" \t\r\n{}();", text[end]) < 0 {
+				end++
+			}
+			token := text[i:end]
+			i = end
+
+			switch {
+			case token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*":
+				g.result = token
+			case token[0] == '$' || token == "e.p.":
+			default:
+				// move numbers may be glued to the move, castling may be
+				// written with zeros
+				token = pgnMoveNumber.ReplaceAllString(token, "")
+				token = strings.TrimRight(token, "!?")
+				if strings.HasPrefix(token, "0-0") {
+					token = strings.Replace(token, "0", "O", -1)
+				}
+				if token != "" {
+					g.moves = append(g.moves, token)
+				}
+			}
+		}
+	}
+
+	if fen := g.tag("FEN"); fen != "" {
+		g.fen = fen
+	}
+	if g.result == "*" {
+		if result := g.tag("Result"); result != "" {
+			g.result = result
+		}
+	}
+	return g
+}
+
+// parsePGNTag reads a tag pair like [White "gochess"]
+func parsePGNTag(line string) (pgnTag, bool) {
+	line = strings.TrimSpace(line)
+	open := strings.IndexByte(line, '"')
+	if !strings.HasSuffix(line, "\"]") || open < 0 || open == len(line)-2 {
+		return pgnTag{}, false
+	}
+
+	value := line[open+1 : len(line)-2]
+	value = strings.Replace(strings.Replace(value, "\\\"", "\"", -1), "\\\\", "\\", -1)
+	return pgnTag{name: strings.TrimSpace(line[1:open]), value: value}, true
+}
+
+// skipPGN returns the position after the next end character
+func skipPGN(text string, i int, end byte) int {
+	if k := strings.IndexByte(text[i:], end); k >= 0 {
+		return i + k + 1
+	}
+	return len(text)
+}
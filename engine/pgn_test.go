@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPGN(t *testing.T) {
+	pgn := `[Event "Test \"one\""]
+[White "A"]
+[Result "1-0"]
+
+1. e4 {best by test} e5 (1... c5 2. Nf3 (2. c3) d6) 2. Nf3 $1 Nc6 3.Bb5 a6!?
+; a comment to the end of the line
+4. Ba4 1-0
+
+[Event "Two"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/8/4K2R w K - 0 1"]
+
+1. O-O+ Kd7 *
+`
+	games, texts := []*pgnGame{}, []string{}
+	err := readPGN(strings.NewReader(pgn), func(g *pgnGame, text string) error {
+		games, texts = append(games, g), append(texts, text)
+		return nil
+	})
+	if err != nil || len(games) != 2 {
+		t.Fatalf("Expected 2 games but got %d %v\n", len(games), err)
+	}
+
+	g := games[0]
+	if expected := "e4 e5 Nf3 Nc6 Bb5 a6 Ba4"; strings.Join(g.moves, " ") != expected {
+		t.Errorf("Expected %s but got %v\n", expected, g.moves)
+	}
+	if g.tag("Event") != `Test "one"` || g.tag("White") != "A" || g.result != "1-0" {
+		t.Errorf("Expected the tags but got %v %s\n", g.tags, g.result)
+	}
+	if !strings.HasPrefix(texts[0], `[Event "Test \"one\""]`) || !strings.Contains(texts[0], "4. Ba4 1-0") {
+		t.Errorf("Expected the text of the game but got %s\n", texts[0])
+	}
+
+	g = games[1]
+	if g.fen != "4k3/8/8/8/8/8/8/4K2R w K - 0 1" || len(g.moves) != 2 || g.moves[0] != "O-O+" || g.result != "*" {
+		t.Errorf("Expected a game from a FEN but got %s %v %s\n", g.fen, g.moves, g.result)
+	}
+}
+
+func TestParsePGNMoves(t *testing.T) {
+	text := `[Event "castling with zeros"]
+%escaped line 1. d4
+1.e4 e5 2. Nf3 Nc6 3.Bc4 Bc5 4. 0-0 Nf6 5. d3 d6 6. Bg5 Bg4 7. Nc3 Qd7
+8. Qd2 0-0-0 9. a3 h6 %not escaped 10. Bh4 *
+`
+	g := parsePGN(text)
+	expected := "e4 e5 Nf3 Nc6 Bc4 Bc5 O-O Nf6 d3 d6 Bg5 Bg4 Nc3 Qd7 Qd2 O-O-O a3 h6 %not escaped Bh4"
+	if strings.Join(g.moves, " ") != expected {
+		t.Errorf("Expected %s but got %v\n", expected, g.moves)
+	}
+
+	// both castlings are legal moves
+	playMovesOn(t, NewBoard(defaultFEN), g.moves[:18]...)
+}
+
+func TestPGNRoundTrip(t *testing.T) {
+	game := &pgnGame{tags: []pgnTag{{"Event", "round trip"}}, moves: []string{"d4", "Nf6", "c4", "e6"}, result: "1/2-1/2", comment: "agreed"}
+
+	g := parsePGN(game.String())
+	if g.tag("Event") != "round trip" || strings.Join(g.moves, " ") != "d4 Nf6 c4 e6" || g.result != "1/2-1/2" {
+		t.Errorf("Expected the game written but got %v %v %s\n", g.tags, g.moves, g.result)
+	}
+}
@@ -62,6 +62,13 @@ func opposite(piece int8) int8 {
 	return ^piece + 1
 }
 
+func pieceColor(piece int8) int8 {
+	if piece > 0 {
+		return White
+	}
+	return Black
+}
+
 func opponent(color int8) int8 {
 	return (-1 * color)
 }
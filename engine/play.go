@@ -0,0 +1,677 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	playMaxGames    = 100
+	playMoveTime    = time.Second      // engine time per move in games without clocks
+	playPollTimeout = 30 * time.Second // a long poll returns the unchanged state after this
+	playIdleTimeout = 30 * time.Minute // games without requests or clients are dropped after this
+)
+
+var (
+	errPlayForbidden = errors.New("not the player of this game")
+	errPlayNotFound  = errors.New("no such game")
+)
+
+// PlayOptions configures the play server
+type PlayOptions struct {
+	Addr        string        // address to listen on, e.g. ":8080"
+	MaxGames    int           // games kept in memory, finished ones are dropped first
+	Workers     int           // concurrent engine searches, defaults to the number of cores
+	IdleTimeout time.Duration // games nobody requested for this long are dropped
+}
+
+// playServer lets humans play against the engine, every game runs on its
+// own and is watched by any number of spectators
+type playServer struct {
+	options PlayOptions
+	pool    *searchPool // shared by the engine's searches of all games
+	games   map[string]*playGame
+	order   []string // the ids by creation
+	next    int
+	mutex   sync.Mutex
+}
+
+// playRequest creates a game or plays a move or resigns in one, also as a
+// WebSocket message with type move or resign
+type playRequest struct {
+	FEN       string `json:"fen"`
+	Variant   string `json:"variant"`
+	Chess960  bool   `json:"chess960"`
+	Color     string `json:"color"`     // of the human: white (default), black or random
+	Time      int64  `json:"time"`      // on each clock in milliseconds, no clocks without
+	Increment int64  `json:"increment"` // in milliseconds
+	Depth     int    `json:"depth"`     // limits the engine's search
+	Nodes     int64  `json:"nodes"`
+
+	Token string `json:"token"` // identifies the human, returned on creation
+	Type  string `json:"type"`
+	Move  string `json:"move"`
+}
+
+// playState is sent to players and spectators on every change
+type playState struct {
+	ID       string   `json:"id"`
+	Token    string   `json:"token,omitempty"` // only for the creator
+	Seq      int      `json:"seq"`             // counts the changes
+	Variant  string   `json:"variant"`
+	FEN      string   `json:"fen"`
+	Human    string   `json:"human"`
+	Turn     string   `json:"turn"`
+	Moves    []string `json:"moves"` // in SAN
+	LastMove string   `json:"lastmove,omitempty"`
+	Clocks   []int64  `json:"clocks,omitempty"` // of white and black in milliseconds
+	Thinking bool     `json:"thinking"`
+	Status   string   `json:"status"`
+	Result   string   `json:"result"`
+	Comment  string   `json:"comment,omitempty"`
+	PGN      string   `json:"pgn,omitempty"` // once the game is over
+}
+
+// playGame is a game of a human against the engine
+type playGame struct {
+	*Game
+	pool      *searchPool
+	id, token string
+	human     int8
+	start     string // FEN of the start position
+	moves     []string
+	lastMove  string
+	clocks    [2]time.Duration // by color index
+	base      time.Duration
+	increment time.Duration
+	timed     bool
+	created   time.Time
+	turnStart time.Time
+	depth     int
+	nodes     int64
+	thinking  bool
+	queued    bool          // the engine waits for a worker, its clock doesn't run yet
+	stop      chan struct{} // closed at the end of the game, ends the engine's search
+	flag      *time.Timer   // ends the game when the human runs out of time
+	result    string
+	comment   string
+	seq       int
+	changed   chan struct{} // closed and replaced on every change
+	active    time.Time     // of the last change or request
+	clients   int           // connected WebSockets
+	mutex     sync.Mutex
+}
+
+func colorName(color int8) string {
+	if color == White {
+		return "white"
+	}
+	return "black"
+}
+
+// NewPlayServer returns the handler of the play server: games are created
+// by a POST to /games and followed at /games/{id}, moves are sent to
+// /games/{id}/move, and /games/{id}/ws streams the changes over a WebSocket
+func NewPlayServer(options PlayOptions) http.Handler {
+	return newPlayServer(options).handler()
+}
+
+// Play serves games against the engine until the listener fails
+func Play(options PlayOptions) error {
+	fmt.Printf("listening on %s\n", options.Addr)
+	return http.ListenAndServe(options.Addr, NewPlayServer(options))
+}
+
+func newPlayServer(options PlayOptions) *playServer {
+	if options.MaxGames < 1 {
+		options.MaxGames = playMaxGames
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = playIdleTimeout
+	}
+	return &playServer{options: options, pool: newSearchPool(options.Workers), games: map[string]*playGame{}}
+}
+
+func (s *playServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/games", s.handleGames)
+	mux.HandleFunc("/games/", s.handleGame)
+	return mux
+}
+
+// handleGames lists the games or creates one
+func (s *playServer) handleGames(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mutex.Lock()
+		states := []playState{}
+		for _, id := range s.order {
+			states = append(states, s.games[id].state())
+		}
+		s.mutex.Unlock()
+		writeJSON(w, http.StatusOK, states)
+	case http.MethodPost:
+		req := &playRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writePlayError(w, fmt.Errorf("invalid request: %v", err))
+			return
+		}
+		g, err := s.create(req)
+		if err != nil {
+			writePlayError(w, err)
+			return
+		}
+		state := g.state()
+		state.Token = g.token
+		writeJSON(w, http.StatusCreated, state)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "only GET and POST are allowed"})
+	}
+}
+
+// handleGame answers /games/{id} with the state, optionally waiting for a
+// change after ?since=seq, and the actions move, resign, pgn and ws
+func (s *playServer) handleGame(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/games/"), "/")
+	s.mutex.Lock()
+	g := s.games[parts[0]]
+	s.mutex.Unlock()
+	if g == nil || len(parts) > 2 {
+		writePlayError(w, errPlayNotFound)
+		return
+	}
+	g.touch()
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		since, err := strconv.Atoi(r.URL.Query().Get("since"))
+		if err != nil {
+			writeJSON(w, http.StatusOK, g.state())
+			return
+		}
+		writeJSON(w, http.StatusOK, g.wait(since, playPollTimeout, r.Context().Done()))
+	case (action == "move" || action == "resign") && r.Method == http.MethodPost:
+		req := &playRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writePlayError(w, fmt.Errorf("invalid request: %v", err))
+			return
+		}
+		req.Type = action
+		if err := g.request(req); err != nil {
+			writePlayError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, g.state())
+	case action == "pgn" && r.Method == http.MethodGet:
+		pgn := g.pgn()
+		if pgn == "" {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "the game is not over"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-chess-pgn")
+		fmt.Fprint(w, pgn)
+	case action == "ws":
+		s.webSocket(w, r, g)
+	default:
+		writePlayError(w, errPlayNotFound)
+	}
+}
+
+func writePlayError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch err {
+	case errPlayForbidden:
+		status = http.StatusForbidden
+	case errPlayNotFound:
+		status = http.StatusNotFound
+	case errServerBusy:
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// webSocket sends the state on every change, the human may send moves
+// with the token given in the URL, e.g. /games/1/ws?token=...
+func (s *playServer) webSocket(w http.ResponseWriter, r *http.Request, g *playGame) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writePlayError(w, err)
+		return
+	}
+	defer conn.close()
+
+	g.connect(1)
+	defer g.connect(-1)
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for seq := -1; ; {
+			state := g.wait(seq, 0, quit)
+			select {
+			case <-quit:
+				return
+			default:
+			}
+			message, _ := json.Marshal(state)
+			if conn.writeMessage(message) != nil {
+				return
+			}
+			seq = state.Seq
+		}
+	}()
+
+	token := r.URL.Query().Get("token")
+	for {
+		message, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+
+		req := &playRequest{Token: token}
+		if err = json.Unmarshal(message, req); err != nil {
+			err = fmt.Errorf("invalid request: %v", err)
+		} else {
+			err = g.request(req)
+		}
+		if err != nil {
+			message, _ := json.Marshal(map[string]string{"error": err.Error()})
+			conn.writeMessage(message)
+		}
+	}
+}
+
+// create starts a game. Idle games are dropped first, then the oldest
+// finished game makes room if there are too many.
+func (s *playServer) create(req *playRequest) (*playGame, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, id := range append([]string{}, s.order...) {
+		if s.games[id].idle(s.options.IdleTimeout) {
+			s.remove(id)
+		}
+	}
+
+	if len(s.order) >= s.options.MaxGames {
+		removed := false
+		for _, id := range s.order {
+			if s.games[id].state().Result != "*" {
+				s.remove(id)
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			return nil, errServerBusy
+		}
+	}
+
+	s.next++
+	g, err := newPlayGame(strconv.Itoa(s.next), req, s.pool)
+	if err != nil {
+		return nil, err
+	}
+	s.games[g.id] = g
+	s.order = append(s.order, g.id)
+	return g, nil
+}
+
+// remove drops a game, a running one is abandoned
+func (s *playServer) remove(id string) {
+	s.games[id].abandon()
+	delete(s.games, id)
+	for i := range s.order {
+		if s.order[i] == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func newPlayGame(id string, req *playRequest, pool *searchPool) (*playGame, error) {
+	b, err := NewVariantBoard(req.Variant, req.FEN)
+	if err != nil {
+		return nil, err
+	}
+	if req.Chess960 {
+		b.setChess960()
+	}
+	if err := validatePosition(b); err != nil {
+		return nil, err
+	}
+	if req.Time < 0 || req.Increment < 0 || req.Depth < 0 || req.Nodes < 0 {
+		return nil, errors.New("invalid limits")
+	}
+
+	g := &playGame{Game: &Game{board: b}, pool: pool, id: id, human: White, start: generateFEN(b), created: time.Now(),
+		active: time.Now(), depth: req.Depth, nodes: req.Nodes, stop: make(chan struct{}), result: "*", changed: make(chan struct{})}
+	switch req.Color {
+	case "", "white":
+	case "black":
+		g.human = Black
+	case "random":
+		if n, _ := rand.Int(rand.Reader, big.NewInt(2)); n.Int64() == 1 {
+			g.human = Black
+		}
+	default:
+		return nil, fmt.Errorf("invalid color %q", req.Color)
+	}
+
+	if req.Time > 0 {
+		g.timed = true
+		g.base = time.Duration(req.Time) * time.Millisecond
+		g.clocks = [2]time.Duration{g.base, g.base}
+		g.increment = time.Duration(req.Increment) * time.Millisecond
+	}
+
+	token := make([]byte, 16)
+	rand.Read(token)
+	g.token = hex.EncodeToString(token)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if b.updateStatus(); b.gameOver() {
+		g.finish(statusResult(b))
+	} else {
+		g.startTurn()
+	}
+	return g, nil
+}
+
+// state returns a copy of the game's state, the clock of the side to move
+// is running
+func (g *playGame) state() playState {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	b := g.board
+	state := playState{ID: g.id, Seq: g.seq, Variant: b.variantName(), FEN: generateFEN(b),
+		Human: colorName(g.human), Turn: colorName(b.sideToMove), Moves: append([]string{}, g.moves...),
+		LastMove: g.lastMove, Thinking: g.thinking, Status: statusNames[b.status], Result: g.result, Comment: g.comment}
+
+	if g.timed {
+		clocks := g.clocks
+		if g.result == "*" && !g.queued {
+			side := colorIndex(b.sideToMove)
+			if clocks[side] -= time.Since(g.turnStart); clocks[side] < 0 {
+				clocks[side] = 0
+			}
+		}
+		state.Clocks = []int64{clocks[0].Milliseconds(), clocks[1].Milliseconds()}
+	}
+	if g.result != "*" {
+		state.PGN = g.pgnLocked()
+	}
+	return state
+}
+
+// wait returns the state once it changed after seq, after the timeout or
+// once done is closed, a timeout of 0 waits without limit
+func (g *playGame) wait(seq int, timeout time.Duration, done <-chan struct{}) playState {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	g.mutex.Lock()
+	for g.seq <= seq {
+		changed := g.changed
+		g.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-expired:
+			return g.state()
+		case <-done:
+			return g.state()
+		}
+		g.mutex.Lock()
+	}
+	g.mutex.Unlock()
+	return g.state()
+}
+
+// update tells the waiting clients about a change
+func (g *playGame) update() {
+	g.active = time.Now()
+	g.seq++
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// touch keeps the game from being dropped as idle
+func (g *playGame) touch() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.active = time.Now()
+}
+
+// connect counts the WebSockets connected to the game
+func (g *playGame) connect(delta int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.clients += delta
+	g.active = time.Now()
+}
+
+// idle is true if no client is connected and nothing happened for the
+// timeout
+func (g *playGame) idle(timeout time.Duration) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.clients == 0 && time.Since(g.active) > timeout
+}
+
+// abandon ends a running game, the engine stops thinking
+func (g *playGame) abandon() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.result == "*" {
+		g.finish("*", "abandoned")
+		g.update()
+	}
+}
+
+// request plays a move of the human or resigns
+func (g *playGame) request(req *playRequest) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if req.Token != g.token {
+		return errPlayForbidden
+	}
+	if g.result != "*" {
+		return errors.New("the game is over")
+	}
+
+	switch req.Type {
+	case "move":
+		if g.board.sideToMove != g.human {
+			return errors.New("not your turn")
+		}
+		m, err := parseSAN(g.board, req.Move)
+		if err != nil {
+			return err
+		}
+		if g.spend() {
+			g.play(m)
+		}
+	case "resign":
+		g.lose(g.human, colorName(g.human)+" resigns")
+	default:
+		return fmt.Errorf("unknown request %q", req.Type)
+	}
+
+	g.update()
+	return nil
+}
+
+// spend takes the time since the start of the turn from the clock of the
+// side to move, which loses if it ran out
+func (g *playGame) spend() bool {
+	if !g.timed {
+		return true
+	}
+	side := colorIndex(g.board.sideToMove)
+	if g.clocks[side] -= time.Since(g.turnStart); g.clocks[side] < 0 {
+		g.clocks[side] = 0
+		g.lose(g.board.sideToMove, colorName(g.board.sideToMove)+" loses on time")
+		return false
+	}
+	g.clocks[side] += g.increment
+	return true
+}
+
+// play makes a move and hands the turn over unless the game is over
+func (g *playGame) play(m Move) {
+	g.moves = append(g.moves, formatSAN(g.board, m))
+	g.lastMove = m.coordinate()
+	g.board.MakeMove(m)
+
+	if g.board.updateStatus(); g.board.gameOver() {
+		g.finish(statusResult(g.board))
+		return
+	}
+	g.startTurn()
+}
+
+// startTurn runs the clock of the side to move, the engine starts to think
+func (g *playGame) startTurn() {
+	g.turnStart = time.Now()
+
+	if g.board.sideToMove != g.human {
+		g.thinking, g.queued = true, true
+		go g.engineMove()
+		return
+	}
+
+	if g.timed {
+		if g.flag != nil {
+			g.flag.Stop()
+		}
+		plies := len(g.moves)
+		g.flag = time.AfterFunc(g.clocks[colorIndex(g.human)], func() {
+			g.mutex.Lock()
+			defer g.mutex.Unlock()
+			if g.result == "*" && len(g.moves) == plies {
+				g.clocks[colorIndex(g.human)] = 0
+				g.lose(g.human, colorName(g.human)+" loses on time")
+				g.update()
+			}
+		})
+	}
+}
+
+// engineMove waits for a worker of the pool and searches the engine's
+// move, it is played unless the game ended in the meantime. The engine's
+// clock starts once it has a worker, the table is cleared if another game
+// used it last.
+func (g *playGame) engineMove() {
+	tt, err := g.pool.acquire(0, g.stop, g.id)
+	if err != nil {
+		return
+	}
+	defer g.pool.release(tt, g.id)
+
+	g.mutex.Lock()
+	g.queued, g.turnStart = false, time.Now()
+	board := g.board.Clone()
+	limits := SearchLimits{Depth: g.depth, Nodes: g.nodes, Stop: g.stop, TT: tt}
+	if g.timed {
+		clock := g.clocks[colorIndex(board.sideToMove)] - time.Since(g.turnStart)
+		limits.Time = planTime(clock, g.increment)
+	} else if g.depth == 0 && g.nodes == 0 {
+		limits.Time = playMoveTime
+	}
+	g.mutex.Unlock()
+
+	result := SearchWithLimits(board, limits)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.result != "*" {
+		return
+	}
+
+	g.thinking = false
+	if result.Move.MovedPiece == Empty {
+		g.finish("*", "the engine found no move")
+	} else if g.spend() {
+		g.play(result.Move)
+	}
+	g.update()
+}
+
+func (g *playGame) lose(color int8, comment string) {
+	result := "1-0"
+	if color == White {
+		result = "0-1"
+	}
+	g.finish(result, comment)
+}
+
+// finish ends the game, the engine stops thinking
+func (g *playGame) finish(result, comment string) {
+	g.result, g.comment, g.thinking = result, comment, false
+	if g.flag != nil {
+		g.flag.Stop()
+	}
+	close(g.stop)
+}
+
+// pgn returns the game in PGN once it is over
+func (g *playGame) pgn() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.result == "*" {
+		return ""
+	}
+	return g.pgnLocked()
+}
+
+func (g *playGame) pgnLocked() string {
+	players := [2]string{"Human", "gochess"}
+	if g.human == Black {
+		players[0], players[1] = players[1], players[0]
+	}
+	tc := "-"
+	if g.timed {
+		tc = fmt.Sprintf("%g+%g", g.base.Seconds(), g.increment.Seconds())
+	}
+
+	game := &pgnGame{moves: g.moves, result: g.result, comment: g.comment}
+	game.tags = []pgnTag{
+		{"Event", "gochess game " + g.id},
+		{"Site", "gochess"},
+		{"Date", g.created.Format("2006.01.02")},
+		{"Round", "-"},
+		{"White", players[0]},
+		{"Black", players[1]},
+		{"Result", g.result},
+	}
+	if v := g.board.variantName(); v != "chess" {
+		game.tags = append(game.tags, pgnTag{"Variant", v})
+	}
+	if g.start != defaultFEN {
+		game.fen = g.start
+		game.tags = append(game.tags, pgnTag{"SetUp", "1"}, pgnTag{"FEN", g.start})
+	}
+	game.tags = append(game.tags, pgnTag{"TimeControl", tc}, pgnTag{"PlyCount", strconv.Itoa(len(g.moves))})
+	return game.String()
+}
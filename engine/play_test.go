@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWebSocket connects to a WebSocket server as a client
+func dialWebSocket(url string) (*wsConn, error) {
+	host, path := strings.TrimPrefix(url, "ws://"), "/"
+	if i := strings.IndexByte(host, '/'); i >= 0 {
+		host, path = host[:i], host[i:]
+	}
+
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, host, key)
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	response, err := http.ReadResponse(rw.Reader, nil)
+	if err == nil && (response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != wsAccept(key)) {
+		err = fmt.Errorf("websocket handshake failed: %s", response.Status)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, rw: rw, client: true}, nil
+}
+
+// playCall sends a request to the play server and decodes the JSON answer
+func playCall(t *testing.T, method, url, body string, response interface{}) int {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if response != nil {
+		if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+			t.Fatalf("Expected JSON from %s but got %v\n", url, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// waitPlies long-polls the state of a game until it has the given number
+// of moves or is over
+func waitPlies(t *testing.T, url string, state playState, plies int) playState {
+	for deadline := time.Now().Add(10 * time.Second); len(state.Moves) < plies && state.Result == "*"; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d moves but got %v\n", plies, state.Moves)
+		}
+		playCall(t, http.MethodGet, fmt.Sprintf("%s?since=%d", url, state.Seq), "", &state)
+	}
+	return state
+}
+
+func TestPlayGame(t *testing.T) {
+	ts := httptest.NewServer(NewPlayServer(PlayOptions{}))
+	defer ts.Close()
+
+	game := playState{}
+	if code := playCall(t, http.MethodPost, ts.URL+"/games", `{"depth": 1}`, &game); code != http.StatusCreated || game.Token == "" {
+		t.Fatalf("Expected a new game but got %d %v\n", code, game)
+	}
+	url := ts.URL + "/games/" + game.ID
+
+	errorResponse := map[string]string{}
+	if code := playCall(t, http.MethodPost, url+"/move", `{"token": "x", "move": "e4"}`, &errorResponse); code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a wrong token but got %d\n", http.StatusForbidden, code)
+	}
+	if code := playCall(t, http.MethodPost, url+"/move", `{"token": "`+game.Token+`", "move": "e5"}`, &errorResponse); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an illegal move but got %d\n", http.StatusBadRequest, code)
+	}
+	if code := playCall(t, http.MethodGet, ts.URL+"/games/99", "", &errorResponse); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown game but got %d\n", http.StatusNotFound, code)
+	}
+
+	state := playState{}
+	playCall(t, http.MethodPost, url+"/move", `{"token": "`+game.Token+`", "move": "e4"}`, &state)
+	state = waitPlies(t, url, state, 2)
+	if len(state.Moves) != 2 || state.Moves[0] != "e4" || state.Turn != "white" || state.Thinking {
+		t.Errorf("Expected the engine's reply but got %v\n", state)
+	}
+
+	if code := playCall(t, http.MethodGet, url+"/pgn", "", &errorResponse); code != http.StatusConflict {
+		t.Errorf("Expected status %d for the PGN of a running game but got %d\n", http.StatusConflict, code)
+	}
+
+	playCall(t, http.MethodPost, url+"/resign", `{"token": "`+game.Token+`"}`, &state)
+	if state.Result != "0-1" || state.Comment != "white resigns" {
+		t.Errorf("Expected white to resign but got %s %s\n", state.Result, state.Comment)
+	}
+
+	res, err := http.Get(url + "/pgn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pgn, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(pgn), `[Result "0-1"]`) || !strings.Contains(string(pgn), "1. e4 ") || string(pgn) != state.PGN {
+		t.Errorf("Expected the PGN of the game but got %s\n", pgn)
+	}
+
+	games := []playState{}
+	if playCall(t, http.MethodGet, ts.URL+"/games", "", &games); len(games) != 1 || games[0].ID != game.ID {
+		t.Errorf("Expected the game in the list but got %v\n", games)
+	}
+}
+
+func TestPlayEngineFirst(t *testing.T) {
+	ts := httptest.NewServer(NewPlayServer(PlayOptions{}))
+	defer ts.Close()
+
+	// the engine plays white and mates at once
+	state := playState{}
+	playCall(t, http.MethodPost, ts.URL+"/games", `{"fen": "4k3/8/4K3/8/8/8/8/7R w - - 0 1", "color": "black", "depth": 2}`, &state)
+	state = waitPlies(t, ts.URL+"/games/"+state.ID, state, 1)
+
+	if state.Result != "1-0" || state.Moves[0] != "Rh8#" || !strings.Contains(state.PGN, `[FEN "4k3/8/4K3/8/8/8/8/7R w - - 0 1"]`) {
+		t.Errorf("Expected the engine to mate but got %v\n", state)
+	}
+}
+
+func TestPlayQueuedClock(t *testing.T) {
+	s := newPlayServer(PlayOptions{Workers: 1})
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	// the engine's clock doesn't run while it waits for a worker
+	s.pool.workers <- struct{}{}
+	state := playState{}
+	playCall(t, http.MethodPost, ts.URL+"/games", `{"fen": "4k3/8/4K3/8/8/8/8/7R w - - 0 1", "color": "black", "time": 60000, "depth": 2}`, &state)
+	time.Sleep(300 * time.Millisecond)
+	playCall(t, http.MethodGet, ts.URL+"/games/"+state.ID, "", &state)
+	if len(state.Moves) != 0 || state.Clocks[0] != 60000 {
+		t.Errorf("Expected the engine to wait with a full clock but got %v\n", state)
+	}
+
+	<-s.pool.workers
+	state = waitPlies(t, ts.URL+"/games/"+state.ID, state, 1)
+	if state.Result != "1-0" || state.Clocks[0] < 60000-250 {
+		t.Errorf("Expected the engine to mate without the waiting time on its clock but got %v\n", state)
+	}
+}
+
+func TestPlayClock(t *testing.T) {
+	ts := httptest.NewServer(NewPlayServer(PlayOptions{}))
+	defer ts.Close()
+
+	state := playState{}
+	playCall(t, http.MethodPost, ts.URL+"/games", `{"time": 50}`, &state)
+	if len(state.Clocks) != 2 || state.Clocks[0] > 50 {
+		t.Errorf("Expected the clocks but got %v\n", state.Clocks)
+	}
+
+	state = waitPlies(t, ts.URL+"/games/"+state.ID, state, 1)
+	if state.Result != "0-1" || state.Comment != "white loses on time" || state.Clocks[0] != 0 {
+		t.Errorf("Expected white to lose on time but got %v\n", state)
+	}
+}
+
+func TestPlayMaxGames(t *testing.T) {
+	ts := httptest.NewServer(NewPlayServer(PlayOptions{MaxGames: 1}))
+	defer ts.Close()
+
+	first := playState{}
+	playCall(t, http.MethodPost, ts.URL+"/games", `{}`, &first)
+	if code := playCall(t, http.MethodPost, ts.URL+"/games", `{}`, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d but got %d\n", http.StatusServiceUnavailable, code)
+	}
+
+	// a finished game makes room
+	playCall(t, http.MethodPost, ts.URL+"/games/"+first.ID+"/resign", `{"token": "`+first.Token+`"}`, nil)
+	second := playState{}
+	if code := playCall(t, http.MethodPost, ts.URL+"/games", `{}`, &second); code != http.StatusCreated || second.ID == first.ID {
+		t.Errorf("Expected a new game but got %d %v\n", code, second)
+	}
+	if code := playCall(t, http.MethodGet, ts.URL+"/games/"+first.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected the finished game to be dropped but got %d\n", code)
+	}
+}
+
+func TestPlayIdleGames(t *testing.T) {
+	ts := httptest.NewServer(NewPlayServer(PlayOptions{MaxGames: 2, IdleTimeout: 100 * time.Millisecond}))
+	defer ts.Close()
+
+	abandoned, watched := playState{}, playState{}
+	playCall(t, http.MethodPost, ts.URL+"/games", `{}`, &abandoned)
+	playCall(t, http.MethodPost, ts.URL+"/games", `{}`, &watched)
+	conn, err := dialWebSocket("ws" + strings.TrimPrefix(ts.URL, "http") + "/games/" + watched.ID + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close()
+	conn.readMessage()
+	time.Sleep(200 * time.Millisecond)
+
+	// the abandoned game makes room, the watched one is kept
+	game := playState{}
+	if code := playCall(t, http.MethodPost, ts.URL+"/games", `{}`, &game); code != http.StatusCreated {
+		t.Errorf("Expected a new game but got %d\n", code)
+	}
+	if code := playCall(t, http.MethodGet, ts.URL+"/games/"+abandoned.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected the abandoned game to be dropped but got %d\n", code)
+	}
+	if code := playCall(t, http.MethodGet, ts.URL+"/games/"+watched.ID, "", nil); code != http.StatusOK {
+		t.Errorf("Expected the watched game to be kept but got %d\n", code)
+	}
+}
+
+func TestPlayWebSocket(t *testing.T) {
+	ts := httptest.NewServer(NewPlayServer(PlayOptions{}))
+	defer ts.Close()
+
+	game := playState{}
+	playCall(t, http.MethodPost, ts.URL+"/games", `{"depth": 1}`, &game)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/games/" + game.ID + "/ws"
+
+	player, err := dialWebSocket(url + "?token=" + game.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.close()
+	spectator, err := dialWebSocket(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spectator.close()
+
+	read := func(c *wsConn, v interface{}) {
+		c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		message, err := c.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(message, v)
+	}
+
+	// both get the current state first
+	state := playState{}
+	read(player, &state)
+	read(spectator, &state)
+
+	// a spectator can't move
+	spectator.writeMessage([]byte(`{"type": "move", "move": "e4"}`))
+	errorResponse := map[string]string{}
+	read(spectator, &errorResponse)
+	if errorResponse["error"] != errPlayForbidden.Error() {
+		t.Errorf("Expected an error for the spectator's move but got %v\n", errorResponse)
+	}
+
+	player.writeMessage([]byte(`{"type": "move", "move": "d2d4"}`))
+	for state.Result == "*" && len(state.Moves) < 2 {
+		read(spectator, &state)
+	}
+	if len(state.Moves) != 2 || state.Moves[0] != "d4" || state.LastMove == "" {
+		t.Errorf("Expected the spectator to see both moves but got %v\n", state)
+	}
+}
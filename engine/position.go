@@ -0,0 +1,424 @@
+package engine
+
+// Position is a bitboard representation of a chess position, it shares the
+// FEN format and the Move type with Board
+type Position struct {
+	pieces        [King + 1]Bitboard // by piece type, both colors
+	colors        [2]Bitboard        // by color index
+	squares       [64]int8
+	sideToMove    int8
+	whiteCastle   int8
+	blackCastle   int8
+	enPassant     Square
+	halfMoveClock int
+	fullMoves     int
+	castling      *castlingSetup
+	history       []positionState
+}
+
+// positionState holds what can't be restored from a move
+type positionState struct {
+	move          Move
+	whiteCastle   int8
+	blackCastle   int8
+	enPassant     Square
+	halfMoveClock int
+}
+
+// NewPosition creates a bitboard position from a FEN
+func NewPosition(fen string) (*Position, error) {
+	b, err := parseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	return newPosition(b), nil
+}
+
+func newPosition(b *Board) *Position {
+	p := &Position{
+		sideToMove:    b.sideToMove,
+		whiteCastle:   b.whiteCastle,
+		blackCastle:   b.blackCastle,
+		enPassant:     b.enPassant,
+		halfMoveClock: b.halfMoveClock,
+		fullMoves:     b.fullMoves,
+		castling:      b.castling,
+	}
+
+	for sq := 0; sq < 64; sq++ {
+		if piece := b.data[sq0x88(sq)]; piece != Empty {
+			p.put(sq, piece)
+		}
+	}
+
+	return p
+}
+
+// Board converts the position back to the 0x88 representation
+func (p *Position) Board() *Board {
+	b := &Board{
+		sideToMove:    p.sideToMove,
+		whiteCastle:   p.whiteCastle,
+		blackCastle:   p.blackCastle,
+		enPassant:     p.enPassant,
+		halfMoveClock: p.halfMoveClock,
+		fullMoves:     p.fullMoves,
+		castling:      p.castling,
+		zobristTable:  defaultZobristTable,
+	}
+
+	for sq, piece := range p.squares {
+		b.data[sq0x88(sq)] = piece
+	}
+	b.whiteKingPosition = sq0x88(p.kingSquare(White))
+	b.blackKingPosition = sq0x88(p.kingSquare(Black))
+	b.currentHash = b.generateHash()
+
+	return b
+}
+
+// FEN returns the Forsyth Edwards Notation of the position
+func (p *Position) FEN() string {
+	return generateFEN(p.Board())
+}
+
+func (p *Position) put(sq int, piece int8) {
+	bit := squareBit(sq)
+	p.pieces[abs(piece)] |= bit
+	p.colors[pieceColorIndex(piece)] |= bit
+	p.squares[sq] = piece
+}
+
+func (p *Position) remove(sq int) {
+	piece := p.squares[sq]
+	bit := squareBit(sq)
+	p.pieces[abs(piece)] &^= bit
+	p.colors[pieceColorIndex(piece)] &^= bit
+	p.squares[sq] = Empty
+}
+
+func pieceColorIndex(piece int8) int {
+	if piece > 0 {
+		return 0
+	}
+	return 1
+}
+
+func (p *Position) occupied() Bitboard {
+	return p.colors[0] | p.colors[1]
+}
+
+func (p *Position) pieceSet(color int8, piece int8) Bitboard {
+	return p.pieces[piece] & p.colors[colorIndex(color)]
+}
+
+func (p *Position) kingSquare(color int8) int {
+	return p.pieceSet(color, King).first()
+}
+
+// attackers returns the pieces of both colors attacking a square
+func (p *Position) attackers(sq int, occupied Bitboard) Bitboard {
+	rooks := p.pieces[Rook] | p.pieces[Queen]
+	bishops := p.pieces[Bishop] | p.pieces[Queen]
+
+	return pawnAttacks[1][sq]&p.pieceSet(White, Pawn) |
+		pawnAttacks[0][sq]&p.pieceSet(Black, Pawn) |
+		knightAttacks[sq]&p.pieces[Knight] |
+		kingAttacks[sq]&p.pieces[King] |
+		rookAttacks(sq, occupied)&rooks |
+		bishopAttacks(sq, occupied)&bishops
+}
+
+// attacked tells whether a square is attacked by the given color
+func (p *Position) attacked(sq int, color int8) bool {
+	return p.attackers(sq, p.occupied())&p.colors[colorIndex(color)] != 0
+}
+
+// InCheck tells whether the side to move is in check
+func (p *Position) InCheck() bool {
+	return p.attacked(p.kingSquare(p.sideToMove), opponent(p.sideToMove))
+}
+
+// MakeMove does a move on the position
+func (p *Position) MakeMove(m Move) {
+	p.history = append(p.history, positionState{
+		move:          m,
+		whiteCastle:   p.whiteCastle,
+		blackCastle:   p.blackCastle,
+		enPassant:     p.enPassant,
+		halfMoveClock: p.halfMoveClock,
+	})
+
+	from, to := sq64(m.From), sq64(m.To)
+
+	p.halfMoveClock++
+	p.enPassant = Invalid
+	if p.sideToMove == Black {
+		p.fullMoves++
+	}
+	if m.Content != Empty || abs(m.MovedPiece) == Pawn {
+		p.halfMoveClock = 0
+	}
+
+	switch m.Special {
+	case moveOrdinary:
+		if m.Content != Empty {
+			p.remove(to)
+		}
+		p.remove(from)
+		p.put(to, m.MovedPiece)
+
+		if abs(m.MovedPiece) == Pawn && (to-from == 16 || from-to == 16) {
+			p.enPassant = sq0x88((from + to) / 2)
+		}
+	case movePromotion:
+		if m.Content != Empty {
+			p.remove(to)
+		}
+		p.remove(from)
+		p.put(to, m.Promoted)
+	case moveEnPassant:
+		p.remove(from)
+		p.remove(to - 8*int(m.MovedPiece))
+		p.put(to, m.MovedPiece)
+	case moveCastelingShort, moveCastelingLong:
+		king, kingTo, rook, rookTo := p.castlingSquares(m)
+		p.remove(king)
+		p.remove(rook)
+		p.put(kingTo, m.MovedPiece)
+		p.put(rookTo, Rook*pieceColor(m.MovedPiece))
+	}
+
+	mask := &p.castling.mask
+	p.whiteCastle &= mask[from][0] & mask[to][0]
+	p.blackCastle &= mask[from][1] & mask[to][1]
+
+	p.sideToMove = opponent(p.sideToMove)
+}
+
+// UndoMove undoes the last move
+func (p *Position) UndoMove() {
+	state := p.history[len(p.history)-1]
+	p.history = p.history[:len(p.history)-1]
+
+	m := state.move
+	from, to := sq64(m.From), sq64(m.To)
+
+	p.sideToMove = opponent(p.sideToMove)
+	p.whiteCastle = state.whiteCastle
+	p.blackCastle = state.blackCastle
+	p.enPassant = state.enPassant
+	p.halfMoveClock = state.halfMoveClock
+	if p.sideToMove == Black {
+		p.fullMoves--
+	}
+
+	switch m.Special {
+	case moveOrdinary, movePromotion:
+		p.remove(to)
+		p.put(from, m.MovedPiece)
+		if m.Content != Empty {
+			p.put(to, m.Content)
+		}
+	case moveEnPassant:
+		p.remove(to)
+		p.put(from, m.MovedPiece)
+		p.put(to-8*int(m.MovedPiece), m.Content)
+	case moveCastelingShort, moveCastelingLong:
+		king, kingTo, rook, rookTo := p.castlingSquares(m)
+		p.remove(kingTo)
+		p.remove(rookTo)
+		p.put(rook, Rook*pieceColor(m.MovedPiece))
+		p.put(king, m.MovedPiece)
+	}
+}
+
+// castlingSquares returns the squares of king and rook before and after a
+// castling move
+func (p *Position) castlingSquares(m Move) (int, int, int, int) {
+	king, kingTo, rook, rookTo := p.castling.squares(pieceColor(m.MovedPiece), castlingDir(m))
+	return sq64(Square(king)), sq64(Square(kingTo)), sq64(Square(rook)), sq64(Square(rookTo))
+}
+
+// GenerateMoves appends all legal moves to the given slice
+func (p *Position) GenerateMoves(moves []Move) []Move {
+	start := len(moves)
+	moves = p.generatePseudoLegal(moves)
+
+	// drop the moves leaving the own king in check
+	legal := moves[:start]
+	for _, m := range moves[start:] {
+		p.MakeMove(m)
+		if !p.attacked(p.kingSquare(opponent(p.sideToMove)), p.sideToMove) {
+			legal = append(legal, m)
+		}
+		p.UndoMove()
+	}
+
+	return legal
+}
+
+func (p *Position) generatePseudoLegal(moves []Move) []Move {
+	color := p.sideToMove
+	own := p.colors[colorIndex(color)]
+	enemies := p.colors[colorIndex(opponent(color))]
+	occupied := own | enemies
+
+	moves = p.generatePawnMoves(moves, enemies, occupied)
+
+	for _, piece := range []int8{Knight, Bishop, Rook, Queen, King} {
+		for set := p.pieceSet(color, piece); set != 0; {
+			from := set.pop()
+
+			targets := Bitboard(0)
+			switch piece {
+			case Knight:
+				targets = knightAttacks[from]
+			case Bishop:
+				targets = bishopAttacks(from, occupied)
+			case Rook:
+				targets = rookAttacks(from, occupied)
+			case Queen:
+				targets = queenAttacks(from, occupied)
+			case King:
+				targets = kingAttacks[from]
+			}
+
+			for targets &= ^own; targets != 0; {
+				to := targets.pop()
+				moves = append(moves, Move{From: sq0x88(from), To: sq0x88(to), MovedPiece: piece * color, Content: p.squares[to]})
+			}
+		}
+	}
+
+	return p.generateCastlingMoves(moves, occupied)
+}
+
+func (p *Position) generatePawnMoves(moves []Move, enemies, occupied Bitboard) []Move {
+	color := p.sideToMove
+	pawn := Pawn * color
+	forward := 8 * int(color)
+
+	startRank, lastRank := rank1<<8, rank8
+	if color == Black {
+		startRank, lastRank = rank8>>8, rank1
+	}
+
+	for set := p.pieceSet(color, Pawn); set != 0; {
+		from := set.pop()
+		bit := squareBit(from)
+
+		targets := pawnAttacks[colorIndex(color)][from] & enemies
+		if to := from + forward; squareBit(to)&occupied == 0 {
+			targets |= squareBit(to)
+			if bit&startRank != 0 && squareBit(to+forward)&occupied == 0 {
+				targets |= squareBit(to + forward)
+			}
+		}
+
+		for targets != 0 {
+			to := targets.pop()
+			m := Move{From: sq0x88(from), To: sq0x88(to), MovedPiece: pawn, Content: p.squares[to]}
+
+			if squareBit(to)&lastRank != 0 {
+				m.Special = movePromotion
+				for _, piece := range []int8{Queen, Rook, Bishop, Knight} {
+					m.Promoted = piece * color
+					moves = append(moves, m)
+				}
+				continue
+			}
+			moves = append(moves, m)
+		}
+
+		if p.enPassant != Invalid && pawnAttacks[colorIndex(color)][from]&squareBit(sq64(p.enPassant)) != 0 {
+			moves = append(moves, Move{From: sq0x88(from), To: p.enPassant, MovedPiece: pawn, Content: -pawn, Special: moveEnPassant})
+		}
+	}
+
+	return moves
+}
+
+func (p *Position) generateCastlingMoves(moves []Move, occupied Bitboard) []Move {
+	color := p.sideToMove
+	rights := p.whiteCastle
+	if color == Black {
+		rights = p.blackCastle
+	}
+	if rights == castleNone {
+		return moves
+	}
+
+	them := opponent(color)
+	for _, dir := range []int8{castleShort, castleLong} {
+		if rights&dir == 0 {
+			continue
+		}
+
+		m := p.castling.move(color, dir)
+		king, kingTo, rook, rookTo := p.castlingSquares(m)
+		if p.squares[king] != King*color || p.squares[rook] != Rook*color || p.attacked(king, them) {
+			continue
+		}
+
+		// the squares between king, rook and their targets must be empty,
+		// the king must not pass an attacked square, whether its target is
+		// attacked after the rook moved is tested with the other moves
+		low, high := king, king
+		for _, sq := range []int{kingTo, rook, rookTo} {
+			if sq < low {
+				low = sq
+			}
+			if sq > high {
+				high = sq
+			}
+		}
+		between := Bitboard(0)
+		for sq := low; sq <= high; sq++ {
+			between |= squareBit(sq)
+		}
+		if occupied&between&^(squareBit(king)|squareBit(rook)) != 0 {
+			continue
+		}
+
+		step := 1
+		if kingTo < king {
+			step = -1
+		}
+		safe := true
+		for sq := king; sq != kingTo && safe; {
+			sq += step
+			safe = !p.attacked(sq, them)
+		}
+		if safe {
+			moves = append(moves, m)
+		}
+	}
+
+	return moves
+}
+
+// Perft counts the leaf nodes of the legal move tree of the given depth
+func (p *Position) Perft(depth int) int64 {
+	return p.perft(depth, make([]MoveBuffer, depth+1))
+}
+
+// perft generates the moves of each depth into its own buffer
+func (p *Position) perft(depth int, buffers []MoveBuffer) int64 {
+	if depth == 0 {
+		return 1
+	}
+
+	moves := p.GenerateMoves(buffers[depth][:0])
+	if depth == 1 {
+		return int64(len(moves))
+	}
+
+	nodes := int64(0)
+	for _, m := range moves {
+		p.MakeMove(m)
+		nodes += p.perft(depth-1, buffers)
+		p.UndoMove()
+	}
+	return nodes
+}
@@ -0,0 +1,94 @@
+package engine
+
+import "testing"
+
+func TestPositionPerft(t *testing.T) {
+	doTestPositionPerft(position1FEN, position1Table, 4, t)
+	doTestPositionPerft(position2FEN, position2Table, 3, t)
+}
+
+func TestPositionPerftDeep(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping deep perft in short mode")
+	}
+	doTestPositionPerft(position1FEN, position1Table, 5, t)
+	doTestPositionPerft(position2FEN, position2Table, 4, t)
+}
+
+func TestPositionFEN(t *testing.T) {
+	for _, fen := range []string{defaultFEN, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "8/8/8/3pP3/8/8/8/k6K w - d6 0 3"} {
+		p, err := NewPosition(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.FEN() != fen {
+			t.Errorf("Expected %s but got %s\n", fen, p.FEN())
+		}
+	}
+}
+
+func TestPositionUndoMove(t *testing.T) {
+	p, _ := NewPosition(position2FEN)
+	fen := p.FEN()
+	pieces, colors := p.pieces, p.colors
+
+	for _, m := range p.GenerateMoves(nil) {
+		p.MakeMove(m)
+		for _, reply := range p.GenerateMoves(nil) {
+			p.MakeMove(reply)
+			p.UndoMove()
+		}
+		p.UndoMove()
+
+		if p.FEN() != fen || p.pieces != pieces || p.colors != colors {
+			t.Errorf("Expected %s after undoing %s but got %s\n", fen, m, p.FEN())
+		}
+	}
+}
+
+func TestPositionPromotions(t *testing.T) {
+	p, _ := NewPosition("8/P6k/8/8/8/8/8/K7 w - - 0 1")
+
+	promotions := 0
+	for _, m := range p.GenerateMoves(nil) {
+		if m.Special == movePromotion {
+			promotions++
+		}
+	}
+	if promotions != 4 {
+		t.Errorf("Expected 4 promotions but got %d\n", promotions)
+	}
+}
+
+func doTestPositionPerft(fen string, expected []PerftData, depth int, t *testing.T) {
+	p, err := NewPosition(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range expected[:depth+1] {
+		if nodes := p.Perft(e.depth); nodes != e.nodes {
+			t.Errorf("Expected %d nodes at depth %d but got %d for %s\n", e.nodes, e.depth, nodes, fen)
+		}
+	}
+}
+
+func TestPositionPerftDoesntAllocate(t *testing.T) {
+	p, _ := NewPosition(position2FEN)
+	buffers := make([]MoveBuffer, 3)
+
+	allocs := testing.AllocsPerRun(5, func() {
+		p.perft(2, buffers)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations but got %f\n", allocs)
+	}
+}
+
+func BenchmarkPositionPerft(b *testing.B) {
+	p, _ := NewPosition(position2FEN)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Perft(3)
+	}
+}
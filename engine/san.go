@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sanPieces are the piece letters of the standard algebraic notation
+var sanPieces = map[byte]int8{'N': Knight, 'B': Bishop, 'R': Rook, 'Q': Queen, 'K': King}
+
+// parseSAN finds the legal move written in standard algebraic notation,
+// e.g. Nbd7, exd6, e8=Q+ or O-O, in Antichess also e8=K and in Crazyhouse
+// drops like N@f7 or @e4 for a pawn. Moves in coordinate notation like e7e8q
+// are accepted too, castling also as the king taking the rook (e1h1).
+func parseSAN(b *Board, san string) (Move, error) {
+	s := strings.TrimRight(san, "+#!?")
+	moves := NewGenerator(b).GenerateMoves()
+
+	// castling, also written with zeros
+	switch strings.Replace(s, "0", "O", -1) {
+	case "O-O":
+		return findMove(moves, san, func(m Move) bool { return m.Special == moveCastelingShort })
+	case "O-O-O":
+		return findMove(moves, san, func(m Move) bool { return m.Special == moveCastelingLong })
+	}
+
+	if k := strings.IndexByte(s, '@'); k >= 0 && k <= 1 && isSquare(s[k+1:]) {
+		piece, ok := Pawn, true
+		if k == 1 && strings.ToUpper(s[:1]) != "P" {
+			piece, ok = sanPieces[strings.ToUpper(s[:1])[0]]
+		}
+		if !ok {
+			return Move{}, fmt.Errorf("invalid move %q", san)
+		}
+		to := SquareLookup[s[k+1:]]
+		return findMove(moves, san, func(m Move) bool {
+			return m.Special == moveDrop && abs(m.MovedPiece) == piece && m.To == to
+		})
+	}
+
+	if len(s) >= 4 && len(s) <= 5 && isSquare(s[:2]) && isSquare(s[2:4]) {
+		coordinate := strings.ToLower(s)
+		return findMove(moves, san, func(m Move) bool {
+			return m.coordinate() == coordinate || kingTakesRook(b, m) == coordinate
+		})
+	}
+
+	piece := Pawn
+	if len(s) > 0 {
+		if p, ok := sanPieces[s[0]]; ok {
+			piece = p
+			s = s[1:]
+		}
+	}
+
+	// promotion, with or without "="
+	promoted := Empty
+	if len(s) > 2 {
+		if p, ok := sanPieces[s[len(s)-1]]; ok {
+			promoted = p
+			s = strings.TrimSuffix(s[:len(s)-1], "=")
+		}
+	}
+
+	if len(s) < 2 || !isSquare(s[len(s)-2:]) {
+		return Move{}, fmt.Errorf("invalid move %q", san)
+	}
+	to := SquareLookup[s[len(s)-2:]]
+
+	// what remains is the disambiguation of the origin square
+	from := strings.Replace(s[:len(s)-2], "x", "", 1)
+	if len(from) > 2 {
+		return Move{}, fmt.Errorf("invalid move %q", san)
+	}
+
+	return findMove(moves, san, func(m Move) bool {
+		if abs(m.MovedPiece) != piece || m.To != to || abs(m.Promoted) != promoted ||
+			m.Special == moveCastelingShort || m.Special == moveCastelingLong {
+			return false
+		}
+		origin := SquareMap[m.From]
+		for i := 0; i < len(from); i++ {
+			if !strings.ContainsRune(origin, rune(from[i])) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// findMove returns the only move matching, otherwise the move is illegal
+// or ambiguous
+func findMove(moves []Move, san string, match func(m Move) bool) (Move, error) {
+	found := []Move{}
+	for _, move := range moves {
+		if match(move) {
+			found = append(found, move)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return Move{}, fmt.Errorf("illegal move %q", san)
+	case 1:
+		return found[0], nil
+	}
+	return Move{}, fmt.Errorf("ambiguous move %q", san)
+}
+
+// kingTakesRook writes a castling move as the king taking the rook, as in
+// Chess960, and returns an empty string for other moves
+func kingTakesRook(b *Board, m Move) string {
+	if m.Special != moveCastelingShort && m.Special != moveCastelingLong {
+		return ""
+	}
+	_, _, rook, _ := b.castling.squares(pieceColor(m.MovedPiece), castlingDir(m))
+	return SquareMap[m.From] + SquareMap[Square(rook)]
+}
+
+func isSquare(s string) bool {
+	return len(s) == 2 && s[0] >= 'a' && s[0] <= 'h' && s[1] >= '1' && s[1] <= '8'
+}
+
+// formatSAN writes a legal move in standard algebraic notation
+func formatSAN(b *Board, m Move) string {
+	san := ""
+
+	switch m.Special {
+	case moveCastelingShort:
+		san = "O-O"
+	case moveCastelingLong:
+		san = "O-O-O"
+	case moveDrop:
+		san = m.coordinate()
+	default:
+		piece := abs(m.MovedPiece)
+		if piece != Pawn {
+			san = symbols[piece] + sanDisambiguation(b, m)
+		}
+		if m.Content != Empty {
+			if piece == Pawn {
+				san = SquareMap[m.From][:1]
+			}
+			san += "x"
+		}
+		san += SquareMap[m.To]
+		if m.Special == movePromotion {
+			san += "=" + symbols[abs(m.Promoted)]
+		}
+	}
+
+	b.MakeMove(m)
+	if b.InCheck() {
+		if len(NewGenerator(b).GenerateMoves()) == 0 {
+			san += "#"
+		} else {
+			san += "+"
+		}
+	}
+	b.UndoMove()
+
+	return san
+}
+
+// sanDisambiguation returns the file, the rank or both of the origin if
+// another piece of the same kind can move to the same square
+func sanDisambiguation(b *Board, m Move) string {
+	origin := SquareMap[m.From]
+	sameFile, sameRank, others := false, false, false
+
+	for _, move := range NewGenerator(b).GenerateMoves() {
+		if move.MovedPiece != m.MovedPiece || move.To != m.To || move.From == m.From {
+			continue
+		}
+		others = true
+		other := SquareMap[move.From]
+		sameFile = sameFile || other[0] == origin[0]
+		sameRank = sameRank || other[1] == origin[1]
+	}
+
+	switch {
+	case !others:
+		return ""
+	case !sameFile:
+		return origin[:1]
+	case !sameRank:
+		return origin[1:]
+	}
+	return origin
+}
@@ -0,0 +1,50 @@
+package engine
+
+import "testing"
+
+func TestParseSAN(t *testing.T) {
+	b := NewBoard("r3k2r/1P6/8/3pP3/1N3N2/8/8/R3K2R w KQkq d6 0 1")
+
+	expected := map[string]Move{
+		"exd6":   Move{From: E5, To: D6, MovedPiece: WhitePawn, Content: BlackPawn, Special: moveEnPassant},
+		"Nfd3":   Move{From: F4, To: D3, MovedPiece: WhiteKnight},
+		"Nf4d3":  Move{From: F4, To: D3, MovedPiece: WhiteKnight},
+		"Nbxd5":  Move{From: B4, To: D5, MovedPiece: WhiteKnight, Content: BlackPawn},
+		"bxa8=N": Move{From: B7, To: A8, MovedPiece: WhitePawn, Content: BlackRook, Special: movePromotion, Promoted: WhiteKnight},
+		"b8Q+":   Move{From: B7, To: B8, MovedPiece: WhitePawn, Special: movePromotion, Promoted: WhiteQueen},
+		"O-O":    Move{From: E1, To: G1, MovedPiece: WhiteKing, Special: moveCastelingShort},
+		"0-0-0":  Move{From: E1, To: C1, MovedPiece: WhiteKing, Special: moveCastelingLong},
+		"e1d2":   Move{From: E1, To: D2, MovedPiece: WhiteKing},
+	}
+
+	for san, e := range expected {
+		if m, err := parseSAN(b, san); err != nil || m != e {
+			t.Errorf("Expected %s for %s but got %s (%v)\n", e, san, m, err)
+		}
+	}
+
+	for _, san := range []string{"Nd3", "Nxd5", "e7", "b8", "Kc2", "Zd4", "x"} {
+		if m, err := parseSAN(b, san); err == nil {
+			t.Errorf("Expected an error for %s but got %s\n", san, m)
+		}
+	}
+}
+
+func TestFormatSAN(t *testing.T) {
+	b := NewBoard("r3k2r/1P6/8/3pP3/1N3N2/8/8/R3K2R w KQkq d6 0 1")
+
+	for _, san := range []string{"exd6", "Nfd3", "Nbxd5", "bxa8=N", "b8=Q+", "O-O", "O-O-O", "Kd2", "Rxa8+"} {
+		m, err := parseSAN(b, san)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := formatSAN(b, m); s != san {
+			t.Errorf("Expected %s but got %s\n", san, s)
+		}
+	}
+
+	b = NewBoard("k7/P7/1Q6/8/8/8/8/K7 w - - 1 0")
+	if s := formatSAN(b, Move{From: B6, To: B8, MovedPiece: WhiteQueen}); s != "Qb8#" {
+		t.Errorf("Expected Qb8# but got %s\n", s)
+	}
+}
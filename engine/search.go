@@ -7,142 +7,421 @@ var (
 	searchMaxTime = 16 * time.Second
 )
 
+// tunable search margins, see params.go
+var (
+	reverseFutilityMargin = 80  // per ply of depth
+	razorMargin           = 250 // per ply of depth
+	futilityMargin        = 100 // per ply of depth
+	lateMoveCount         = 3   // quiet moves searched at depth 0, plus depth squared
+	deltaMargin           = 200 // in addition to the captured piece
+)
+
 const (
 	searchMaxDepth  = 20
 	searchMaxPly    = 128
 	searchEvalStart = 50000
+
+	nullMoveMinDepth      = 3   // no null moves close to the horizon
+	nullMoveReduction     = 2   // base depth reduction of the null move search
+	nullMoveDepthDivisor  = 6   // reduce by one more ply every n plies of depth
+	nullMoveEvalDivisor   = 200 // reduce by one more ply every n centipawns above beta
+	nullMoveEvalReduction = 2   // maximum reduction due to the eval margin
+	nullMoveVerifyDepth   = 6   // fail highs from this depth on are verified
+
+	aspirationMinDepth = 4   // earlier iterations use the full window
+	aspirationWindow   = 25  // initial distance of the window to the last score
+	aspirationMaxWidth = 500 // wider windows are replaced by the full window
+
+	extensionPlyFactor = 2 // no extensions beyond this multiple of the iteration depth
+	singularMinDepth   = 8 // singular extensions are tried from this depth on
+	singularTTDepth    = 3 // the hash entry may be up to n plies shallower
+	singularMargin     = 2 // margin below the hash score per ply of depth
+
+	reverseFutilityMaxDepth = 6 // shallow pruning is limited to these depths
+	razorMaxDepth           = 2
+	futilityMaxDepth        = 6
+	lateMoveMaxDepth        = 4
 )
 
 type pvSearch struct {
-	board         *Board
-	checkedNodes  int64
-	path          [searchMaxPly][searchMaxPly]Move
-	pathLength    [searchMaxPly]int
-	bestMoves     [searchMaxDepth]Move
-	bestMovesPlys [searchMaxDepth]int
-	bestScores    [searchMaxDepth]int
-	stopByTime    bool
-	stopTime      time.Time
-	followPv      bool
-	ply           int
+	board        *Board
+	checkedNodes int64
+	maxNodes     int64
+	path         [searchMaxPly][searchMaxPly]Move
+	pathLength   [searchMaxPly]int
+	stopped      bool
+	stopTime     time.Time
+	stopSignal   <-chan struct{}
+	followPv     bool
+	verbose      bool
+	noNullMove   bool
+	history      *moveHistory
+	tt           *TranspositionTable
+	rootDepth    int
+	excluded     [searchMaxPly]Move
+	ply          int
+	frames       []*searchFrame
+	sp           int
+}
+
+// searchFrame holds the move lists of a node. Frames are stacked by call
+// depth rather than by ply, since some searches re-enter the same ply, and
+// are reused throughout the search, so the nodes don't allocate memory.
+type searchFrame struct {
+	picker  movePicker
+	moves   MoveBuffer
+	checks  MoveBuffer
+	quiets  MoveBuffer
+	bad     MoveBuffer
+	ordered [maxMoves]orderedMove
+}
+
+// push returns the frame of a new node
+func (pv *pvSearch) push() *searchFrame {
+	if pv.sp == len(pv.frames) {
+		pv.frames = append(pv.frames, new(searchFrame))
+	}
+	pv.sp++
+	return pv.frames[pv.sp-1]
+}
+
+func (pv *pvSearch) pop() {
+	pv.sp--
+}
+
+// SearchLimits restricts a search, zero values mean no limit
+type SearchLimits struct {
+	Depth int             // maximum iteration depth
+	Nodes int64           // maximum number of nodes
+	Time  time.Duration   // maximum search time
+	Stop  <-chan struct{} // closing it ends the search
+
+	// TT is kept between the searches of a game, without one a new table
+	// of the hash size is used
+	TT *TranspositionTable
+
+	// Progress is called with the result of every completed iteration
+	Progress func(SearchResult)
+}
+
+// SearchResult is the outcome of a search
+type SearchResult struct {
+	Move  Move
+	PV    []Move // the expected moves of both sides, starting with Move
+	Score int    // relative to the side to move
+	Depth int    // last completed iteration
+	Nodes int64
+	Time  time.Duration
 }
 
 // Search finds the best available move
 func Search(board *Board) Move {
+	return search(board, SearchLimits{Time: searchMaxTime}, searchVerbose).Move
+}
+
+// SearchWithLimits finds the best available move within the given limits
+// without printing any output
+func SearchWithLimits(board *Board, limits SearchLimits) SearchResult {
+	return search(board, limits, false)
+}
+
+func search(board *Board, limits SearchLimits, verbose bool) SearchResult {
 
 	// TODO book
 
 	startTime := time.Now()
 
-	pv := pvSearch{}
-	pv.stopTime = startTime.Add(searchMaxTime)
-	pv.board = &Board{}
-	*pv.board = *board
+	pv := pvSearch{verbose: verbose, maxNodes: limits.Nodes, stopSignal: limits.Stop, history: new(moveHistory),
+		tt: limits.TT}
+	if pv.tt == nil {
+		pv.tt = NewTranspositionTable(searchHashSize)
+	}
+	if limits.Time > 0 {
+		pv.stopTime = startTime.Add(limits.Time)
+	}
+	pv.board = board.Clone()
 	pv.board.ply = 0
 
-	printSearchHead()
+	// the search board needs its own accumulators
+	if activeNetwork != nil {
+		pv.board.nnue = newNNUEState(activeNetwork, pv.board)
+	}
+
+	maxDepth := searchMaxDepth - 1
+	if limits.Depth > 0 && limits.Depth < maxDepth {
+		maxDepth = limits.Depth
+	}
 
-	foundMate := false
-	depth := 1
+	pv.printSearchHead()
 
-	for ; depth < searchMaxDepth && !pv.stopByTime; depth++ {
-		pv.followPv = true
-		score := pv.alphaBeta(depth, -searchEvalStart, searchEvalStart)
+	result := SearchResult{}
+
+	for depth := 1; depth <= maxDepth; depth++ {
+		score := pv.aspiration(depth, result.Score)
+
+		if pv.stopped {
+			break
+		}
+
+		result.Move = pv.path[0][0]
+		result.PV = append([]Move{}, pv.path[0][:pv.pathLength[0]]...)
+		result.Score = score
+		result.Depth = depth
 
-		pv.bestMoves[depth] = pv.path[0][0]
-		pv.bestMovesPlys[depth] = pv.pathLength[0]
-		pv.bestScores[depth] = score
+		if limits.Progress != nil {
+			result.Nodes = pv.checkedNodes
+			result.Time = time.Since(startTime)
+			limits.Progress(result)
+		}
 
-		printSearchLevel(&pv, depth, score, startTime)
+		pv.printSearchLevel(depth, score, startTime)
 
 		if score >= scoreMate || score <= -scoreMate {
-			foundMate = true
 			break
 		}
+	}
 
+	// not even the first iteration was completed, any legal move is better
+	// than none
+	if result.Depth == 0 {
+		if moves := NewGenerator(pv.board).GenerateMoves(); len(moves) > 0 {
+			result.Move = moves[0]
+		}
 	}
 
-	best := Move{}
+	result.Nodes = pv.checkedNodes
+	result.Time = time.Since(startTime)
+
+	pv.printSearchResult(startTime)
 
-	if pv.stopByTime {
-		best = pv.bestMoves[depth-2]
+	return result
+}
 
-	} else if foundMate {
-		best = pv.bestMoves[depth]
+// aspiration searches an iteration with a window around the score of the
+// previous one, the window is widened on the failing side until the score
+// is within
+func (pv *pvSearch) aspiration(depth, last int) int {
+	pv.rootDepth = depth
 
-	} else {
-		best = pv.bestMoves[depth-1]
+	delta := aspirationWindow
+	alpha, beta := -searchEvalStart, searchEvalStart
+	if depth >= aspirationMinDepth {
+		alpha, beta = last-delta, last+delta
 	}
 
-	printSearchResult(&pv, startTime)
+	for {
+		pv.followPv = true
+		score := pv.alphaBeta(depth, alpha, beta)
+
+		if pv.stopped {
+			return 0
+		}
+
+		delta *= 2
+		switch {
+		case score <= alpha && alpha > -searchEvalStart:
+			alpha = score - delta
+		case score >= beta && beta < searchEvalStart:
+			beta = score + delta
+		default:
+			return score
+		}
 
-	return best
+		if delta > aspirationMaxWidth {
+			alpha, beta = -searchEvalStart, searchEvalStart
+		}
+	}
 }
 
-func (pv *pvSearch) alphaBeta(depth, alpha, beta int) int {
-	if depth == 0 {
-		return pv.quiescence(alpha, beta)
+// stop tells whether the search has to be aborted due to its limits
+func (pv *pvSearch) stop() bool {
+	if pv.maxNodes > 0 && pv.checkedNodes >= pv.maxNodes {
+		pv.stopped = true
 	}
-	pv.checkedNodes++
 
-	// check time all 4096 nodes
+	// check time and stop signal all 4096 nodes
 	if pv.checkedNodes%4095 == 0 {
-		if time.Now().After(pv.stopTime) {
-			pv.stopByTime = true
-			return 0
+		if !pv.stopTime.IsZero() && time.Now().After(pv.stopTime) {
+			pv.stopped = true
+		}
+		if pv.stopSignal != nil {
+			select {
+			case <-pv.stopSignal:
+				pv.stopped = true
+			default:
+			}
 		}
 	}
 
+	return pv.stopped
+}
+
+func (pv *pvSearch) alphaBeta(depth, alpha, beta int) int {
+	if depth <= 0 {
+		return pv.quiescence(alpha, beta, true)
+	}
+	pv.checkedNodes++
+
+	if pv.stop() {
+		return 0
+	}
+
 	// TODO: index out of range
 	if len(pv.pathLength) <= pv.board.ply {
 		return 0
 	}
 	pv.pathLength[pv.board.ply] = pv.board.ply
 
-	generator := Generator{board: pv.board}
-	moves := generator.GenerateMoves()
-
-	if generator.kingUnderCheck {
-		depth++
-	}
-
 	// repetition
 	if pv.board.ply > 0 && pv.board.repetitions() >= 3 {
 		return scoreDraw
 	}
 
+	// e.g. a king on the hill ends the game before any mate
+	if v := pv.board.variant; v != nil && v.over(pv.board) {
+		return statusScore(pv.board, v.result(pv.board, false))
+	}
+
+	pvNode := beta-alpha > 1
+	excluded := pv.excluded[pv.board.ply]
+	hashMove := Move{}
+	entry, hashHit := pv.tt.probe(pv.board.currentHash)
+	if hashHit {
+		hashMove = entry.move.Unpack()
+		if score, ok := ttCutoff(entry, depth, alpha, beta, pv.board.ply); ok && !pvNode && pv.board.ply > 0 && excluded.MovedPiece == Empty {
+			return score
+		}
+	}
+
+	// the principal variation of the previous iteration is searched first
+	// as long as it is followed
 	if pv.followPv {
-		moves = pv.sortPv(moves)
+		if move := pv.path[0][pv.board.ply]; move.MovedPiece != Empty {
+			hashMove = move
+		} else {
+			pv.followPv = false
+		}
 	}
 
+	// the frame is taken past the early returns, each later return pops it
+	frame := pv.push()
+	picker := newMovePicker(pv, frame, hashMove)
+	if pv.followPv && picker.hashMove != hashMove {
+		pv.followPv = false
+	}
+	inCheck := picker.inCheck()
+
+	if inCheck && pv.canExtend() {
+		depth++
+	}
+
+	if excluded.MovedPiece == Empty && pv.nullMoveAllowed(depth, alpha, beta, inCheck) && pv.nullMove(depth, beta) {
+		pv.pop()
+		return beta
+	}
+
+	// prune shallow non PV nodes by the static evaluation
+	prune := !pvNode && !inCheck && pv.board.ply > 0 && excluded.MovedPiece == Empty &&
+		alpha > -scoreMate && beta < scoreMate
+	eval := 0
+	if prune {
+		eval = Evaluate(pv.board)
+
+		if depth <= reverseFutilityMaxDepth && eval-reverseFutilityMargin*depth >= beta {
+			pv.pop()
+			return eval
+		}
+
+		if depth <= razorMaxDepth && eval+razorMargin*depth < alpha {
+			if score := pv.quiescence(alpha, beta, true); score <= alpha {
+				pv.pop()
+				return score
+			}
+		}
+	}
+	futile := prune && depth <= futilityMaxDepth && eval+futilityMargin*depth <= alpha
+
+	singular := hashHit && entry.move.Unpack() == picker.hashMove && pv.singular(entry, depth)
+
 	playedMove := false
 	score := 0
-	pvSearch := true
+	bestMove := Move{}
+	flag := ttUpper
+	quiets := frame.quiets[:0]
+
+	for i := 0; ; i++ {
+		move, ok := picker.next()
+		if !ok {
+			break
+		}
+		if move == excluded {
+			i--
+			continue
+		}
+
+		// late quiet moves at shallow depths are skipped altogether
+		if prune && depth <= lateMoveMaxDepth && len(quiets) >= lateMoveCount+depth*depth {
+			picker.skipQuiets = true
+		}
+
+		ext := pv.extension(move, pvNode, singular && move == picker.hashMove)
+
+		// late quiet moves are searched with reduced depth first, unless
+		// they are killers, extended or give check
+		r := 0
+		if i > 0 && ext == 0 && isQuietMove(move) && !inCheck && !pv.isKiller(move) {
+			r = pv.reduction(depth, i, move)
+		}
+
+		// quiet moves can't raise a futile node above alpha, unless they
+		// give check
+		pruneQuiet := futile && playedMove && isQuietMove(move)
 
-	for _, move := range moves {
 		pv.board.MakeMove(move)
+
+		if r > 0 || pruneQuiet {
+			if pv.board.InCheck() {
+				r = 0
+			} else if pruneQuiet {
+				pv.board.UndoMove()
+				continue
+			}
+		}
 		playedMove = true
 
-		if pvSearch {
-			score = -pv.alphaBeta(depth-1, -beta, -alpha)
+		newDepth := depth - 1 + ext
+		if i == 0 {
+			score = -pv.alphaBeta(newDepth, -beta, -alpha)
 		} else {
-			score = -pv.alphaBeta(depth-1, -alpha-1, -alpha)
+			score = -pv.alphaBeta(newDepth-r, -alpha-1, -alpha)
+			if score > alpha && r > 0 {
+				score = -pv.alphaBeta(newDepth, -alpha-1, -alpha)
+			}
 			if score > alpha && score < beta {
-				score = -pv.alphaBeta(depth-1, -beta, -alpha)
+				score = -pv.alphaBeta(newDepth, -beta, -alpha)
 			}
 		}
 		pv.board.UndoMove()
 
-		if pv.stopByTime {
+		if pv.stopped {
+			pv.pop()
 			return 0
 		}
 
 		if score > alpha {
 			if score >= beta {
+				if isQuietMove(move) {
+					pv.updateHistory(move, quiets, depth)
+				}
+				if excluded.MovedPiece == Empty {
+					pv.tt.store(pv.board.currentHash, depth, score, ttLower, move, pv.board.ply)
+				}
+				pv.pop()
 				return score
 			}
 			alpha = score
-			pvSearch = false
+			bestMove = move
+			flag = ttExact
 
 			pv.path[pv.board.ply][pv.board.ply] = move
 			for j := pv.board.ply + 1; j < pv.pathLength[pv.board.ply+1]; j++ {
@@ -151,10 +430,20 @@ func (pv *pvSearch) alphaBeta(depth, alpha, beta int) int {
 			pv.pathLength[pv.board.ply] = pv.pathLength[pv.board.ply+1]
 		}
 
+		if isQuietMove(move) {
+			quiets = append(quiets, move)
+		}
 	}
+	pv.pop()
 
 	if !playedMove {
-		if generator.kingUnderCheck {
+		if excluded.MovedPiece != Empty {
+			return alpha
+		}
+		if v := pv.board.variant; v != nil {
+			return statusScore(pv.board, v.result(pv.board, inCheck))
+		}
+		if inCheck {
 			return -(scoreMate + pv.board.ply)
 		}
 		return scoreDraw
@@ -165,48 +454,221 @@ func (pv *pvSearch) alphaBeta(depth, alpha, beta int) int {
 		return scoreDraw
 	}
 
+	if excluded.MovedPiece == Empty {
+		pv.tt.store(pv.board.currentHash, depth, alpha, flag, bestMove, pv.board.ply)
+	}
+
 	return alpha
 }
 
-func (pv *pvSearch) quiescence(alpha, beta int) int {
+// canExtend limits extensions to a multiple of the iteration depth, so
+// the search tree can't explode
+func (pv *pvSearch) canExtend() bool {
+	return pv.board.ply < extensionPlyFactor*pv.rootDepth
+}
 
-	pv.checkedNodes++
+// singular tells whether the hash move is the only good move: all other
+// moves fail low against a bound below the hash score in a reduced search
+func (pv *pvSearch) singular(entry ttEntry, depth int) bool {
+	ply := pv.board.ply
+	score := scoreFromTT(int(entry.score), ply)
 
-	// check time all 4096 nodes
-	if pv.checkedNodes%4095 == 0 {
-		if time.Now().After(pv.stopTime) {
-			pv.stopByTime = true
-			return 0
+	if depth < singularMinDepth || ply == 0 || pv.excluded[ply].MovedPiece != Empty || !pv.canExtend() ||
+		entry.flag == ttUpper || int(entry.depth) < depth-singularTTDepth ||
+		score >= scoreMate || score <= -scoreMate {
+		return false
+	}
+
+	followPv := pv.followPv
+	pv.followPv = false
+	pv.excluded[ply] = entry.move.Unpack()
+
+	singularBeta := score - singularMargin*depth
+	score = pv.alphaBeta((depth-1)/2, singularBeta-1, singularBeta)
+
+	pv.excluded[ply] = Move{}
+	pv.followPv = followPv
+	pv.pathLength[ply] = ply
+
+	return !pv.stopped && score < singularBeta
+}
+
+// extension returns the plies a move is searched deeper: singular moves,
+// recaptures in PV nodes and passed pawns advancing to the 7th rank
+func (pv *pvSearch) extension(move Move, pvNode, singular bool) int {
+	if !pv.canExtend() {
+		return 0
+	}
+
+	if singular {
+		return 1
+	}
+
+	if prev, ok := pv.previousMove(1); ok && pvNode && prev.Content != Empty && move.Content != Empty && move.To == prev.To {
+		return 1
+	}
+
+	if abs(move.MovedPiece) == Pawn && pv.board.passedPawn(int8(move.To), move.MovedPiece) {
+		if (move.MovedPiece == WhitePawn && rank(int8(move.To)) == 6) || (move.MovedPiece == BlackPawn && rank(int8(move.To)) == 1) {
+			return 1
 		}
 	}
 
-	pv.pathLength[pv.board.ply] = pv.board.ply
+	return 0
+}
+
+// ttCutoff returns the score of a hash table entry if it is deep enough
+// and its bound proves the score outside of the window
+func ttCutoff(entry ttEntry, depth, alpha, beta, ply int) (int, bool) {
+	if int(entry.depth) < depth {
+		return 0, false
+	}
+
+	score := scoreFromTT(int(entry.score), ply)
+	switch {
+	case entry.flag == ttExact,
+		entry.flag == ttLower && score >= beta,
+		entry.flag == ttUpper && score <= alpha:
+		return score, true
+	}
+	return 0, false
+}
+
+// nullMoveAllowed is false in check, in PV nodes, in pawn endgames and with
+// compulsory captures (due to zugzwang) and right after another null move
+func (pv *pvSearch) nullMoveAllowed(depth, alpha, beta int, check bool) bool {
+	if pv.noNullMove || check || depth < nullMoveMinDepth || beta-alpha > 1 || pv.board.ply == 0 {
+		return false
+	}
+
+	if v := pv.board.variant; v != nil && v.rules().forcedCaptures {
+		return false
+	}
+
+	history := pv.board.history
+	if len(history) > 0 && history[len(history)-1].move.Special == moveNull {
+		return false
+	}
+
+	return !pv.board.onlyPawns(pv.board.sideToMove)
+}
 
+// nullMove lets the side to move pass, if the reduced search still fails
+// high the position is good enough to be pruned
+func (pv *pvSearch) nullMove(depth, beta int) bool {
 	eval := Evaluate(pv.board)
+	if eval < beta {
+		return false
+	}
 
-	if eval >= beta {
-		return beta
+	r := nullMoveReduction + depth/nullMoveDepthDivisor
+	if margin := (eval - beta) / nullMoveEvalDivisor; margin < nullMoveEvalReduction {
+		r += margin
+	} else {
+		r += nullMoveEvalReduction
+	}
+
+	pv.board.MakeNullMove()
+	score := -pv.alphaBeta(depth-1-r, -beta, -beta+1)
+	pv.board.UndoNullMove()
+
+	if pv.stopped || score < beta {
+		return false
+	}
+
+	// at high depths zugzwang errors are expensive, verify the fail high
+	// with a reduced search of the current position without null moves
+	if depth >= nullMoveVerifyDepth {
+		pv.noNullMove = true
+		score = pv.alphaBeta(depth-1-r, beta-1, beta)
+		pv.noNullMove = false
+
+		if pv.stopped || score < beta {
+			return false
+		}
+	}
+
+	return true
+}
+
+// quiescence searches captures until the position is quiet, with checks
+// enabled quiet checking moves are searched too and check evasions are
+// searched in the following ply, so shallow mates are found
+func (pv *pvSearch) quiescence(alpha, beta int, checks bool) int {
+
+	pv.checkedNodes++
+
+	if pv.stop() {
+		return 0
 	}
 
-	if eval > alpha {
-		alpha = eval
+	pv.pathLength[pv.board.ply] = pv.board.ply
+
+	if v := pv.board.variant; v != nil && v.over(pv.board) {
+		return statusScore(pv.board, v.result(pv.board, false))
 	}
 
-	generator := Generator{board: pv.board}
+	frame := pv.push()
+
+	generator := Generator{board: pv.board, buffer: &frame.moves}
+	generator.prepare()
+	checks = checks && !generator.noCheck
 
-	for _, move := range generator.GenerateMoves() {
+	// there is no standing pat in check, nor if a capture is compulsory
+	evasions := checks && generator.kingUnderCheck || generator.mustCapture()
+
+	eval := 0
+	if !evasions {
+		eval = Evaluate(pv.board)
+
+		if eval >= beta {
+			pv.pop()
+			return beta
+		}
 
-		// only check capture moves
-		// TODO: should be optimized from the generator!
-		if move.Content == Empty {
+		if eval > alpha {
+			alpha = eval
+		}
+	}
+
+	if evasions {
+		generator.generate(generateAll, Invalid)
+	} else {
+		generator.generate(generateCaptures, Invalid)
+	}
+	moves := generator.moves
+	sortCaptures(moves)
+
+	// the checks are generated into their own buffer, appending them
+	// stays within the capacity of the move buffer
+	if checks && !evasions {
+		generator.buffer = &frame.checks
+		moves = append(moves, generator.GenerateQuietChecks()...)
+	}
+
+	playedMove := false
+
+	for _, move := range moves {
+
+		// losing captures won't raise alpha
+		if !evasions && pv.board.SEE(move) < 0 {
+			continue
+		}
+
+		// neither do captures which don't even win enough material
+		if !evasions && move.Content != Empty && eval+seeValue(move.Content)+deltaMargin <= alpha &&
+			move.Special != movePromotion {
 			continue
 		}
 
 		pv.board.MakeMove(move)
-		score := -pv.quiescence(-beta, -alpha)
+		score := -pv.quiescence(-beta, -alpha, checks && !evasions && isQuietMove(move))
 		pv.board.UndoMove()
+		playedMove = true
+
 		if score > alpha {
 			if score >= beta {
+				pv.pop()
 				return beta
 			}
 			alpha = score
@@ -219,20 +681,11 @@ func (pv *pvSearch) quiescence(alpha, beta int) int {
 			pv.pathLength[pv.board.ply] = pv.pathLength[pv.board.ply+1]
 		}
 	}
+	pv.pop()
 
-	return alpha
-}
-
-func (pv *pvSearch) sortPv(moves []Move) []Move {
-	pv.followPv = false
-	for i := 0; i < len(moves); i++ {
-		if moves[i] == pv.path[0][pv.board.ply] {
-			pv.followPv = true
-			tmp := moves[0]
-			moves[0] = moves[i]
-			moves[i] = tmp
-			return moves
-		}
+	if evasions && !playedMove {
+		return -(scoreMate + pv.board.ply)
 	}
-	return moves
+
+	return alpha
 }
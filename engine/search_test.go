@@ -34,3 +34,100 @@ func doTestBestMoveForFEN(fen string, e Move, t *testing.T) {
 		t.Errorf("Expected %s but found %s\n%s\n", e.String(), a.String(), formatBoard(b))
 	}
 }
+
+func TestQuiescenceFindsQuietMate(t *testing.T) {
+	pv := pvSearch{board: NewBoard("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1"), history: new(moveHistory)}
+
+	if score := pv.quiescence(-searchEvalStart, searchEvalStart, false); score >= scoreMate {
+		t.Errorf("Expected no mate without checks but got %d\n", score)
+	}
+
+	if score := pv.quiescence(-searchEvalStart, searchEvalStart, true); score < scoreMate {
+		t.Errorf("Expected a mate score but got %d\n", score)
+	}
+}
+
+func TestAspirationWidensWindow(t *testing.T) {
+	b := NewBoard(position2FEN)
+
+	// the full window search after the same previous iteration
+	full := pvSearch{board: b, history: new(moveHistory), tt: NewTranspositionTable(1)}
+	full.aspiration(aspirationMinDepth-1, 0)
+	full.rootDepth, full.followPv = aspirationMinDepth, true
+	expected := full.alphaBeta(aspirationMinDepth, -searchEvalStart, searchEvalStart)
+
+	// far off scores fail low or high, the window is widened until the
+	// search finds the same score
+	for _, last := range []int{-1000, expected, 1000} {
+		pv := pvSearch{board: b, history: new(moveHistory), tt: NewTranspositionTable(1)}
+		pv.aspiration(aspirationMinDepth-1, 0)
+
+		if score := pv.aspiration(aspirationMinDepth, last); score != expected {
+			t.Errorf("Expected the score %d of the full window but got %d for %d\n", expected, score, last)
+		}
+		if len(b.history) != 0 {
+			t.Fatalf("Expected the board to be restored\n")
+		}
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	pv := pvSearch{board: NewBoard("4k3/8/8/1P6/8/8/1p6/4K3 w - - 0 1"), history: new(moveHistory), rootDepth: 4}
+
+	if ext := pv.extension(Move{From: B5, To: B6, MovedPiece: WhitePawn}, false, false); ext != 0 {
+		t.Errorf("Expected no extension for b5b6 but got %d\n", ext)
+	}
+
+	pv.board = NewBoard("4k3/8/1P6/8/8/8/1p6/4K3 w - - 0 1")
+	if ext := pv.extension(Move{From: B6, To: B7, MovedPiece: WhitePawn}, false, false); ext != 1 {
+		t.Errorf("Expected an extension for b6b7 but got %d\n", ext)
+	}
+
+	pv.board.ply = extensionPlyFactor * pv.rootDepth
+	if ext := pv.extension(Move{From: B6, To: B7, MovedPiece: WhitePawn}, false, true); ext != 0 {
+		t.Errorf("Expected no extension beyond the ply limit but got %d\n", ext)
+	}
+}
+
+func TestSearchDoesntAllocate(t *testing.T) {
+	pv := pvSearch{board: NewBoard(position2FEN), history: new(moveHistory), tt: NewTranspositionTable(1), rootDepth: 4}
+
+	allocs := testing.AllocsPerRun(5, func() {
+		pv.alphaBeta(4, -searchEvalStart, searchEvalStart)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations but got %f\n", allocs)
+	}
+	if pv.sp != 0 {
+		t.Errorf("Expected every frame to be popped but got %d left\n", pv.sp)
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	board := NewBoard(position2FEN)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		SearchWithLimits(board, SearchLimits{Depth: 5})
+	}
+}
+
+func TestSearchKeepsTable(t *testing.T) {
+	b := NewBoard(position2FEN)
+	tt := NewTranspositionTable(1)
+
+	first := SearchWithLimits(b, SearchLimits{Depth: 4, TT: tt})
+	if _, ok := tt.probe(b.currentHash); !ok {
+		t.Fatalf("Expected the root in the table after the search\n")
+	}
+
+	// the second search profits from the first
+	second := SearchWithLimits(b, SearchLimits{Depth: 4, TT: tt})
+	if second.Nodes >= first.Nodes {
+		t.Errorf("Expected fewer nodes with a filled table but got %d and %d\n", first.Nodes, second.Nodes)
+	}
+
+	tt.Clear()
+	if _, ok := tt.probe(b.currentHash); ok {
+		t.Errorf("Expected an empty table after clearing it\n")
+	}
+}
@@ -0,0 +1,153 @@
+package engine
+
+// seeValue is the material value of a piece for exchange evaluation
+func seeValue(piece int8) int {
+	switch abs(piece) {
+	case Pawn:
+		return pawnValue
+	case Knight:
+		return knightValue
+	case Bishop:
+		return bishopValue
+	case Rook:
+		return rookValue
+	case Queen:
+		return queenValue
+	case King:
+		return kingValue
+	}
+	return 0
+}
+
+// SEE statically evaluates the exchange on the target square of a move
+//
+// Both sides alternately recapture with their least valuable attacker,
+// pieces behind a capturing slider (x-rays) join the exchange as soon as
+// the line is open. Each side may stop capturing when it is ahead. Pins are
+// not considered. The result is the expected material gain of the move for
+// the side to move.
+func (b *Board) SEE(m Move) int {
+	data := b.data
+	target := int8(m.To)
+
+	var gain [32]int
+	gain[0] = seeValue(m.Content)
+
+	onTarget := m.MovedPiece
+	if m.Special == movePromotion {
+		onTarget = m.Promoted
+		gain[0] += seeValue(m.Promoted) - pawnValue
+	}
+
+	data[m.From] = Empty
+	data[target] = onTarget
+	if m.Special == moveEnPassant {
+		data[target-m.MovedPiece*nextRank] = Empty
+	}
+
+	side := opponent(b.sideToMove)
+	d := 0
+
+	for d < len(gain)-1 {
+		from := leastValuableAttacker(&data, target, side)
+		if from == int8(Invalid) {
+			break
+		}
+
+		// the king may only capture if the square is not defended anymore
+		if abs(data[from]) == King && leastValuableAttacker(&data, target, opponent(side)) != int8(Invalid) {
+			break
+		}
+
+		d++
+		gain[d] = seeValue(onTarget) - gain[d-1]
+
+		onTarget = data[from]
+		data[from] = Empty
+		side = opponent(side)
+	}
+
+	for ; d > 0; d-- {
+		if -gain[d] < gain[d-1] {
+			gain[d-1] = -gain[d]
+		}
+	}
+
+	return gain[0]
+}
+
+// leastValuableAttacker returns the square of the cheapest piece of the
+// given color attacking the target square, or Invalid
+func leastValuableAttacker(data *[boardSize]int8, target int8, color int8) int8 {
+	best := int8(Invalid)
+	bestPiece := King + 1
+
+	consider := func(square int8) {
+		if piece := data[square] * color; piece > 0 && piece < bestPiece {
+			best = square
+			bestPiece = piece
+		}
+	}
+
+	// pawns capture diagonally forward
+	for _, delta := range []int8{moveUpLeft, moveUpRight} {
+		from := target - delta*color
+		if uint8(from)&0x88 == 0 && data[from] == Pawn*color {
+			consider(from)
+		}
+	}
+
+	for _, delta := range deltaKnight {
+		from := target + delta
+		if uint8(from)&0x88 == 0 && data[from] == Knight*color {
+			consider(from)
+		}
+	}
+
+	for _, delta := range deltaKing {
+		from := target + delta
+		if uint8(from)&0x88 == 0 && data[from] == King*color {
+			consider(from)
+		}
+	}
+
+	for _, delta := range deltaAll {
+		diagonal := delta == moveUpLeft || delta == moveUpRight || delta == moveDownLeft || delta == moveDownRight
+
+		for from := target + delta; uint8(from)&0x88 == 0; from += delta {
+			piece := data[from] * color
+			if data[from] == Empty {
+				continue
+			}
+			if piece == Queen || (diagonal && piece == Bishop) || (!diagonal && piece == Rook) {
+				consider(from)
+			}
+			break
+		}
+	}
+
+	return best
+}
+
+// sortCaptures orders captures by MVV-LVA, the insertion sort is stable and
+// doesn't allocate
+func sortCaptures(moves []Move) {
+	for i := 1; i < len(moves); i++ {
+		move := moves[i]
+		score := mvvLva(move)
+		j := i
+		for ; j > 0 && mvvLva(moves[j-1]) < score; j-- {
+			moves[j] = moves[j-1]
+		}
+		moves[j] = move
+	}
+}
+
+// mvvLva orders captures by most valuable victim, least valuable attacker
+func mvvLva(m Move) int {
+	score := 8*int(abs(m.Content)) - int(abs(m.MovedPiece))
+	if m.Special == movePromotion {
+		score += 8 * int(abs(m.Promoted))
+	}
+	return score
+}
@@ -0,0 +1,41 @@
+package engine
+
+import "testing"
+
+func TestSEE(t *testing.T) {
+	tests := []struct {
+		fen      string
+		from, to Square
+		expected int
+	}{
+		// undefended pawn
+		{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", E1, E5, pawnValue},
+		// pawn defended by a pawn, rook is lost
+		{"1k1r4/1pp4p/p4p2/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", E1, E5, pawnValue - rookValue},
+		// knight takes pawn defended by knight and x-rayed rooks
+		{"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", D3, E5, pawnValue - knightValue},
+		// rook battery takes an undefended pawn, the rook behind is never needed
+		{"4k3/8/8/3p4/8/8/3R4/3RK3 w - - 0 1", D2, D5, pawnValue},
+		// rook battery against a defended pawn: the second rook can't save it
+		{"3rk3/8/8/3p4/8/8/3R4/3RK3 w - - 0 1", D2, D5, pawnValue},
+		// queen takes a pawn defended by a pawn
+		{"4k3/8/2p5/3p4/8/8/8/3QK3 w - - 0 1", D1, D5, pawnValue - queenValue},
+		// the king may not recapture a defended piece
+		{"8/8/8/4k3/3p4/4Q3/8/4K3 w - - 0 1", E3, D4, pawnValue - queenValue},
+		{"8/8/8/4k3/3p4/4Q3/2N5/4K3 w - - 0 1", E3, D4, pawnValue},
+	}
+
+	for _, test := range tests {
+		b := NewBoard(test.fen)
+		m := Move{}
+		for _, move := range NewGenerator(b).GenerateMoves() {
+			if move.From == test.from && move.To == test.to {
+				m = move
+			}
+		}
+
+		if actual := b.SEE(m); actual != test.expected {
+			t.Errorf("Expected SEE %d but got %d for %s in %s\n", test.expected, actual, m, test.fen)
+		}
+	}
+}
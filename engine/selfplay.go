@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	selfPlayMaxPlies      = 400  // games are drawn after this many plies
+	selfPlayAdjudication  = 2000 // score after which a game is adjudicated
+	selfPlayAdjudicateFor = 8    // plies the score has to stay above
+)
+
+// SelfPlayOptions configures the generation of training data
+type SelfPlayOptions struct {
+	OutFile     string // positions are appended to this file
+	Games       int    // total number of games
+	Threads     int    // games played in parallel, defaults to the number of cores
+	Depth       int    // search depth per move
+	Nodes       int64  // search nodes per move
+	RandomPlies int    // random moves at the start of each game
+	Seed        int64  // games are reproducible for a given seed
+	Resume      bool   // skip the games already found in OutFile
+}
+
+type selfPlayGame struct {
+	index     int
+	result    string
+	positions []string
+}
+
+// SelfPlay lets the engine play against itself and writes quiet positions
+// together with the search score and the game result to a file
+//
+// Every position is written as EPD line with the score relative to the
+// side to move (ce) and the result from white's point of view (c9). Each
+// finished game is closed by a "# game <index> <result>" line, which is
+// used to continue an interrupted run.
+func SelfPlay(options SelfPlayOptions) error {
+	if options.Threads < 1 {
+		options.Threads = runtime.NumCPU()
+	}
+
+	done := map[int]bool{}
+	if options.Resume {
+		var err error
+		if done, err = readSelfPlayProgress(options.OutFile); err != nil {
+			return err
+		}
+		fmt.Printf("resuming with %d of %d games done\n", len(done), options.Games)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !options.Resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(options.OutFile, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	indexes := make(chan int)
+	games := make(chan selfPlayGame)
+
+	var wg sync.WaitGroup
+	for i := 0; i < options.Threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				games <- playSelfPlayGame(index, options)
+			}
+		}()
+	}
+
+	go func() {
+		for i := 0; i < options.Games; i++ {
+			if !done[i] {
+				indexes <- i
+			}
+		}
+		close(indexes)
+		wg.Wait()
+		close(games)
+	}()
+
+	start := time.Now()
+	count, positions := len(done), 0
+
+	for game := range games {
+		block := strings.Join(game.positions, "")
+		block += fmt.Sprintf("# game %d %s\n", game.index, game.result)
+
+		if _, err := io.WriteString(f, block); err != nil {
+			return err
+		}
+
+		count++
+		positions += len(game.positions)
+		fmt.Printf("game %d/%d %s, %d positions, %ss\n",
+			count, options.Games, game.result, positions, formatDuration(time.Since(start)))
+	}
+
+	return nil
+}
+
+// playSelfPlayGame plays a single game, which only depends on the index
+// and the seed
+func playSelfPlayGame(index int, options SelfPlayOptions) selfPlayGame {
+	r := rand.New(rand.NewSource(options.Seed + int64(index)))
+	game := selfPlayGame{index: index}
+
+	b := NewBoard(defaultFEN)
+	randomOpening(b, r, options.RandomPlies)
+
+	limits := SearchLimits{Depth: options.Depth, Nodes: options.Nodes, TT: NewTranspositionTable(searchHashSize)}
+	quiet := pvSearch{}
+	candidates := []string{}
+	adjudicate := 0
+
+	for b.updateStatus(); !b.gameOver() && len(b.history) < selfPlayMaxPlies; b.updateStatus() {
+		result := SearchWithLimits(b, limits)
+
+		if b.status != statusCheck && isQuietMove(result.Move) && isQuiet(&quiet, b) {
+			candidates = append(candidates, fmt.Sprintf("%s ce %d;", epdPosition(b), result.Score))
+		}
+
+		// adjudicate clearly decided games
+		if result.Score >= selfPlayAdjudication || result.Score <= -selfPlayAdjudication {
+			adjudicate++
+		} else {
+			adjudicate = 0
+		}
+
+		if adjudicate >= selfPlayAdjudicateFor {
+			if int(b.sideToMove)*result.Score > 0 {
+				b.status = statusWhiteMates
+			} else {
+				b.status = statusBlackMates
+			}
+			break
+		}
+
+		b.MakeMove(result.Move)
+	}
+
+	switch b.status {
+	case statusWhiteMates:
+		game.result = "1-0"
+	case statusBlackMates:
+		game.result = "0-1"
+	default:
+		game.result = "1/2-1/2"
+	}
+
+	for _, c := range candidates {
+		game.positions = append(game.positions, fmt.Sprintf("%s c9 \"%s\";\n", c, game.result))
+	}
+
+	return game
+}
+
+// randomOpening plays random moves, the last move must not end the game
+func randomOpening(b *Board, r *rand.Rand, plies int) {
+	for i := 0; i < plies; i++ {
+		moves := NewGenerator(b).GenerateMoves()
+		r.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+
+		played := false
+		for _, move := range moves {
+			b.MakeMove(move)
+			if b.updateStatus(); !b.gameOver() {
+				played = true
+				break
+			}
+			b.UndoMove()
+		}
+
+		if !played {
+			return
+		}
+	}
+}
+
+// isQuiet is true if there are no captures pending, i.e. the quiescence
+// search does not change the static evaluation. Like a search it runs on
+// a copy starting at ply 0, the plies of the game would overflow the
+// search stack.
+func isQuiet(pv *pvSearch, b *Board) bool {
+	pv.board = b.Clone()
+	pv.board.ply = 0
+	return pv.quiescence(-searchEvalStart, searchEvalStart, false) == Evaluate(b)
+}
+
+// epdPosition returns the first four fields of the board's FEN
+func epdPosition(b *Board) string {
+	return strings.Join(strings.Fields(generateFEN(b))[:4], " ")
+}
+
+// readSelfPlayProgress returns the finished games of a previous run and
+// cuts off the positions of an unfinished game
+func readSelfPlayProgress(path string) (map[int]bool, error) {
+	done := map[int]bool{}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	end := int64(0)
+	offset := int64(0)
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(len(line))
+
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "#" && fields[1] == "game" {
+			index, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid game %q", path, fields[2])
+			}
+			done[index] = true
+			end = offset
+		}
+	}
+
+	return done, f.Truncate(end)
+}
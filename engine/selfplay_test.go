@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelfPlayResume(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "selfplay.epd")
+	options := SelfPlayOptions{OutFile: out, Games: 2, Threads: 2, Depth: 1, RandomPlies: 8, Seed: 7}
+
+	if err := SelfPlay(options); err != nil {
+		t.Fatal(err)
+	}
+
+	// an interrupted game must be dropped on resume
+	f, err := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("8/8/8/8/8/8/8/K6k w - - ce 0;")
+	f.Close()
+
+	options.Games = 3
+	options.Resume = true
+	if err := SelfPlay(options); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	games := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.HasPrefix(line, "# game ") {
+			games++
+			continue
+		}
+		if _, _, err := parseTuneLine(line); err != nil || !strings.Contains(line, " ce ") {
+			t.Errorf("Expected a position with score and result but got %q\n", line)
+		}
+	}
+
+	if games != 3 {
+		t.Errorf("Expected 3 games but found %d\n", games)
+	}
+}
+
+func TestSelfPlayGameIsReproducible(t *testing.T) {
+	options := SelfPlayOptions{Depth: 1, RandomPlies: 6, Seed: 3}
+	a := playSelfPlayGame(5, options)
+	b := playSelfPlayGame(5, options)
+
+	if a.result != b.result || strings.Join(a.positions, "") != strings.Join(b.positions, "") {
+		t.Errorf("Expected the same game for the same seed and index\n")
+	}
+}
+
+func TestIsQuietInLongGame(t *testing.T) {
+	b := NewBoard(defaultFEN)
+	shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+	for i := 0; i < 2*searchMaxPly; i++ {
+		m, err := parseSAN(b, shuffle[i%len(shuffle)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.MakeMove(m)
+	}
+
+	ply := b.ply
+	if !isQuiet(&pvSearch{}, b) {
+		t.Errorf("Expected the start position to be quiet\n")
+	}
+	if b.ply != ply || len(b.history) != 2*searchMaxPly {
+		t.Errorf("Expected the game board to be unchanged but got ply %d\n", b.ply)
+	}
+}
@@ -0,0 +1,375 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const serverMaxTime = 10 * time.Second // default of the longest search
+
+var errServerBusy = errors.New("all workers are busy")
+
+// ServerOptions configures the HTTP analysis server
+type ServerOptions struct {
+	Addr    string        // address to listen on, e.g. ":8080"
+	Workers int           // concurrent searches, defaults to the number of cores
+	MaxTime time.Duration // longest search of a request, also used without a limit
+}
+
+// server answers analysis requests, searches are limited by a pool of
+// workers
+type server struct {
+	options ServerOptions
+	pool    *searchPool
+}
+
+// searchPool limits the number of concurrent searches, the transposition
+// tables of idle workers are kept for the next searches
+type searchPool struct {
+	workers chan struct{}
+	tables  chan pooledTable
+}
+
+// pooledTable remembers who searched with a table last
+type pooledTable struct {
+	tt    *TranspositionTable
+	owner string
+}
+
+// serverRequest is read from the JSON body of a POST or the query of a GET,
+// where the moves are separated by spaces or commas. All requests describe
+// a position by a FEN, which defaults to the start position, and the moves
+// played from there.
+type serverRequest struct {
+	FEN      string   `json:"fen"`
+	Variant  string   `json:"variant"`
+	Chess960 bool     `json:"chess960"`
+	Moves    []string `json:"moves"`
+	Depth    int      `json:"depth"`
+	Nodes    int64    `json:"nodes"`
+	Time     int64    `json:"time"` // in milliseconds
+}
+
+type jsonMove struct {
+	UCI string `json:"uci"`
+	SAN string `json:"san"`
+}
+
+type jsonTerm struct {
+	Name  string `json:"name"`
+	White int    `json:"white"`
+	Black int    `json:"black"`
+}
+
+type validateResponse struct {
+	Valid bool   `json:"valid"`
+	FEN   string `json:"fen,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type movesResponse struct {
+	FEN    string     `json:"fen"`
+	Status string     `json:"status"`
+	Moves  []jsonMove `json:"moves"`
+}
+
+type moveResponse struct {
+	FEN    string     `json:"fen"`
+	Status string     `json:"status"`
+	Played []jsonMove `json:"played"`
+}
+
+type evalResponse struct {
+	FEN   string     `json:"fen"`
+	Score int        `json:"score"` // relative to the side to move
+	Terms []jsonTerm `json:"terms"` // from white's point of view
+}
+
+type searchResponse struct {
+	FEN      string     `json:"fen"`
+	Status   string     `json:"status"`
+	BestMove *jsonMove  `json:"bestmove"` // none if the game is over
+	Score    int        `json:"score"`    // relative to the side to move
+	Mate     int        `json:"mate,omitempty"`
+	Depth    int        `json:"depth"`
+	Nodes    int64      `json:"nodes"`
+	Time     int64      `json:"time"` // in milliseconds
+	PV       []jsonMove `json:"pv"`
+}
+
+var statusNames = map[int]string{
+	statusNormal:     "normal",
+	statusCheck:      "check",
+	statusWhiteMates: "white mates",
+	statusBlackMates: "black mates",
+	statusStaleMate:  "stalemate",
+	statusDraw:       "draw",
+	statusWhiteWins:  "white wins",
+	statusBlackWins:  "black wins",
+}
+
+// NewServer returns the handler of the analysis endpoints /validate,
+// /moves, /move, /eval and /search
+func NewServer(options ServerOptions) http.Handler {
+	return newServer(options).handler()
+}
+
+// Serve answers analysis requests until the listener fails
+func Serve(options ServerOptions) error {
+	fmt.Printf("listening on %s\n", options.Addr)
+	return http.ListenAndServe(options.Addr, NewServer(options))
+}
+
+func newServer(options ServerOptions) *server {
+	if options.Workers < 1 {
+		options.Workers = runtime.NumCPU()
+	}
+	if options.MaxTime <= 0 {
+		options.MaxTime = serverMaxTime
+	}
+	return &server{options: options, pool: newSearchPool(options.Workers)}
+}
+
+func newSearchPool(workers int) *searchPool {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	return &searchPool{workers: make(chan struct{}, workers), tables: make(chan pooledTable, workers)}
+}
+
+// acquire waits for a free worker and returns its table, it fails with
+// errServerBusy after the timeout (0 waits without limit) or once done is
+// closed. A table last used by another owner is cleared, without an owner
+// the entries of earlier searches are kept.
+func (p *searchPool) acquire(timeout time.Duration, done <-chan struct{}, owner string) (*TranspositionTable, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+	case <-expired:
+		return nil, errServerBusy
+	case <-done:
+		return nil, errServerBusy
+	}
+
+	select {
+	case t := <-p.tables:
+		if owner != "" && t.owner != owner {
+			t.tt.Clear()
+		}
+		return t.tt, nil
+	default:
+		return NewTranspositionTable(searchHashSize), nil
+	}
+}
+
+// release hands the worker and its table back
+func (p *searchPool) release(tt *TranspositionTable, owner string) {
+	p.tables <- pooledTable{tt, owner}
+	<-p.workers
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate", s.handle(s.validate))
+	mux.HandleFunc("/moves", s.handle(s.moves))
+	mux.HandleFunc("/move", s.handle(s.move))
+	mux.HandleFunc("/eval", s.handle(s.eval))
+	mux.HandleFunc("/search", s.handle(s.search))
+	return mux
+}
+
+// handle reads the request and writes the response or the error as JSON
+func (s *server) handle(f func(*http.Request, *serverRequest) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "only GET and POST are allowed"})
+			return
+		}
+
+		req, err := readServerRequest(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		response, err := f(r, req)
+		switch {
+		case err == errServerBusy:
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		case err != nil:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, response)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func readServerRequest(r *http.Request) (*serverRequest, error) {
+	req := &serverRequest{}
+
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, fmt.Errorf("invalid request: %v", err)
+		}
+		return req, nil
+	}
+
+	query := r.URL.Query()
+	req.FEN = query.Get("fen")
+	req.Variant = query.Get("variant")
+	req.Chess960 = query.Get("chess960") == "true"
+	req.Moves = strings.FieldsFunc(query.Get("moves"), func(r rune) bool { return r == ' ' || r == ',' })
+
+	depth := int64(0)
+	for name, value := range map[string]*int64{"depth": &depth, "nodes": &req.Nodes, "time": &req.Time} {
+		if query.Get(name) == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(query.Get(name), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", name, query.Get(name))
+		}
+		*value = n
+	}
+	req.Depth = int(depth)
+
+	return req, nil
+}
+
+// position sets up the board of a request and plays its moves, which are
+// returned in both notations
+func (req *serverRequest) position() (*Board, []jsonMove, error) {
+	b, err := NewVariantBoard(req.Variant, req.FEN)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Chess960 {
+		b.setChess960()
+	}
+	if err := validatePosition(b); err != nil {
+		return nil, nil, err
+	}
+
+	played := []jsonMove{}
+	for _, move := range req.Moves {
+		m, err := parseSAN(b, move)
+		if err != nil {
+			return nil, nil, err
+		}
+		played = append(played, jsonMove{UCI: m.coordinate(), SAN: formatSAN(b, m)})
+		b.MakeMove(m)
+	}
+	b.updateStatus()
+
+	return b, played, nil
+}
+
+func (s *server) validate(r *http.Request, req *serverRequest) (interface{}, error) {
+	b, _, err := req.position()
+	if err != nil {
+		return validateResponse{Error: err.Error()}, nil
+	}
+	return validateResponse{Valid: true, FEN: generateFEN(b)}, nil
+}
+
+func (s *server) moves(r *http.Request, req *serverRequest) (interface{}, error) {
+	b, _, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+
+	moves := []jsonMove{}
+	for _, m := range NewGenerator(b).GenerateMoves() {
+		moves = append(moves, jsonMove{UCI: m.coordinate(), SAN: formatSAN(b, m)})
+	}
+	return movesResponse{FEN: generateFEN(b), Status: statusNames[b.status], Moves: moves}, nil
+}
+
+func (s *server) move(r *http.Request, req *serverRequest) (interface{}, error) {
+	b, played, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+	return moveResponse{FEN: generateFEN(b), Status: statusNames[b.status], Played: played}, nil
+}
+
+func (s *server) eval(r *http.Request, req *serverRequest) (interface{}, error) {
+	b, _, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+
+	terms := []jsonTerm{}
+	for _, term := range traceEvaluation(b) {
+		terms = append(terms, jsonTerm{Name: term.name, White: term.white, Black: term.black})
+	}
+	return evalResponse{FEN: generateFEN(b), Score: Evaluate(b), Terms: terms}, nil
+}
+
+// search waits for a free worker at most as long as the search may take,
+// the search ends early if the client goes away
+func (s *server) search(r *http.Request, req *serverRequest) (interface{}, error) {
+	b, _, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+
+	limits := SearchLimits{Depth: req.Depth, Nodes: req.Nodes, Time: s.options.MaxTime, Stop: r.Context().Done()}
+	if t := time.Duration(req.Time) * time.Millisecond; t > 0 && t < limits.Time {
+		limits.Time = t
+	}
+
+	response := searchResponse{FEN: generateFEN(b), Status: statusNames[b.status], PV: []jsonMove{}}
+	if b.gameOver() {
+		return response, nil
+	}
+
+	if limits.TT, err = s.pool.acquire(limits.Time, r.Context().Done(), ""); err != nil {
+		if r.Context().Err() != nil {
+			return nil, r.Context().Err()
+		}
+		return nil, err
+	}
+	defer s.pool.release(limits.TT, "")
+
+	result := SearchWithLimits(b, limits)
+	response.Score, response.Depth, response.Nodes = result.Score, result.Depth, result.Nodes
+	response.Time, response.Mate = result.Time.Milliseconds(), mateMoves(result.Score)
+
+	pv := result.PV
+	if len(pv) == 0 {
+		pv = []Move{result.Move}
+	}
+	// the moves of the principal variation are checked, as they may come
+	// from the transposition table
+	for _, m := range pv {
+		if !NewGenerator(b).IsLegal(m) {
+			break
+		}
+		response.PV = append(response.PV, jsonMove{UCI: m.coordinate(), SAN: formatSAN(b, m)})
+		b.MakeMove(m)
+	}
+	if len(response.PV) > 0 {
+		response.BestMove = &response.PV[0]
+	}
+
+	return response, nil
+}
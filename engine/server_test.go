@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// serverGet sends a GET request to the handler and decodes the response
+func serverGet(t *testing.T, h http.Handler, path string, query url.Values, response interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil))
+	if err := json.NewDecoder(w.Body).Decode(response); err != nil {
+		t.Fatalf("Expected JSON from %s but got %v\n", path, err)
+	}
+	return w.Code
+}
+
+func serverPost(t *testing.T, h http.Handler, path, body string, response interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	if err := json.NewDecoder(w.Body).Decode(response); err != nil {
+		t.Fatalf("Expected JSON from %s but got %v\n", path, err)
+	}
+	return w.Code
+}
+
+func TestServerValidate(t *testing.T) {
+	h := NewServer(ServerOptions{})
+
+	for _, c := range []struct {
+		fen   string
+		valid bool
+	}{
+		{"", true},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/8 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/P3K3 w - - 0 1", false},
+		// the side not to move is in check
+		{"4k3/8/8/8/8/8/8/4K2R b - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/4K2R w - - 0 1", true},
+		{"4k2R/8/8/8/8/8/8/4K3 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/4K3 x", false},
+	} {
+		response := validateResponse{}
+		serverGet(t, h, "/validate", url.Values{"fen": {c.fen}}, &response)
+		if response.Valid != c.valid {
+			t.Errorf("Expected %s to be valid %v but got %v (%s)\n", c.fen, c.valid, response.Valid, response.Error)
+		}
+	}
+}
+
+func TestServerMoves(t *testing.T) {
+	h := NewServer(ServerOptions{})
+
+	response := movesResponse{}
+	if code := serverPost(t, h, "/moves", `{"moves": ["e4", "e7e5"]}`, &response); code != http.StatusOK {
+		t.Fatalf("Expected status %d but got %d\n", http.StatusOK, code)
+	}
+	if len(response.Moves) != 29 {
+		t.Errorf("Expected 29 moves but got %d\n", len(response.Moves))
+	}
+	found := false
+	for _, m := range response.Moves {
+		found = found || m == jsonMove{UCI: "g1f3", SAN: "Nf3"}
+	}
+	if !found {
+		t.Errorf("Expected Nf3 among the moves but got %v\n", response.Moves)
+	}
+
+	errorResponse := map[string]string{}
+	if code := serverPost(t, h, "/moves", `{"moves": ["e5"]}`, &errorResponse); code != http.StatusBadRequest || errorResponse["error"] == "" {
+		t.Errorf("Expected an error for an illegal move but got %d %v\n", code, errorResponse)
+	}
+	if code := serverPost(t, h, "/moves", `{"moves": `, &errorResponse); code != http.StatusBadRequest {
+		t.Errorf("Expected an error for invalid JSON but got %d\n", code)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/moves", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d but got %d\n", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestServerMove(t *testing.T) {
+	h := NewServer(ServerOptions{})
+
+	response := moveResponse{}
+	serverGet(t, h, "/move", url.Values{"moves": {"f3,e5 g4 Qh4"}}, &response)
+
+	expected := "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"
+	if response.FEN != expected || response.Status != "black mates" {
+		t.Errorf("Expected %s mated but got %s %s\n", expected, response.FEN, response.Status)
+	}
+	if len(response.Played) != 4 || response.Played[3] != (jsonMove{UCI: "d8h4", SAN: "Qh4#"}) {
+		t.Errorf("Expected the moves played but got %v\n", response.Played)
+	}
+}
+
+func TestServerEval(t *testing.T) {
+	h := NewServer(ServerOptions{})
+
+	fen := "4k3/8/8/8/8/8/3Q4/4K3 b - - 0 1"
+	response := evalResponse{}
+	serverGet(t, h, "/eval", url.Values{"fen": {fen}}, &response)
+
+	if expected := Evaluate(NewBoard(fen)); response.Score != expected {
+		t.Errorf("Expected %d but got %d\n", expected, response.Score)
+	}
+	sum := 0
+	for _, term := range response.Terms {
+		sum += term.White - term.Black
+	}
+	if -sum != response.Score || len(response.Terms) != numTerms || response.Terms[0] != (jsonTerm{Name: "material", White: queenValue}) {
+		t.Errorf("Expected the terms to add up to the score but got %v\n", response.Terms)
+	}
+
+	serverGet(t, h, "/eval", url.Values{"fen": {"4k3/8/8/8/8/8/3Q4/4K3 b - - 0 1"}, "variant": {"kingofthehill"}}, &response)
+	if last := response.Terms[len(response.Terms)-1]; last.Name != "kingofthehill" {
+		t.Errorf("Expected the variant's adjustment but got %v\n", last)
+	}
+}
+
+func TestServerSearch(t *testing.T) {
+	h := NewServer(ServerOptions{Workers: 1})
+
+	response := searchResponse{}
+	code := serverPost(t, h, "/search", `{"fen": "4k3/8/4K3/8/8/8/8/7R w - - 0 1", "depth": 4}`, &response)
+	if code != http.StatusOK || response.BestMove == nil || response.BestMove.SAN != "Rh8#" || response.Mate != 1 {
+		t.Errorf("Expected Rh8# but got %d %v\n", code, response)
+	}
+	if len(response.PV) != 1 || response.Depth == 0 || response.Nodes == 0 {
+		t.Errorf("Expected the principal variation but got %v\n", response)
+	}
+
+	serverGet(t, h, "/search", url.Values{"depth": {"3"}}, &response)
+	if response.BestMove == nil || len(response.PV) < 2 || response.PV[0] != *response.BestMove {
+		t.Errorf("Expected a best move and its variation but got %v\n", response)
+	}
+
+	// the game is over, there is nothing to search
+	serverGet(t, h, "/search", url.Values{"moves": {"f3 e5 g4 Qh4"}}, &response)
+	if response.BestMove != nil || response.Status != "black mates" {
+		t.Errorf("Expected no move but got %v\n", response)
+	}
+
+	errorResponse := map[string]string{}
+	if code := serverGet(t, h, "/search", url.Values{"depth": {"x"}}, &errorResponse); code != http.StatusBadRequest {
+		t.Errorf("Expected an error for an invalid depth but got %d\n", code)
+	}
+}
+
+func TestServerBusy(t *testing.T) {
+	s := newServer(ServerOptions{Workers: 1})
+	s.pool.workers <- struct{}{}
+
+	response := map[string]string{}
+	if code := serverGet(t, s.handler(), "/search", url.Values{"time": {"20"}}, &response); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d but got %d\n", http.StatusServiceUnavailable, code)
+	}
+
+	<-s.pool.workers
+	if code := serverGet(t, s.handler(), "/search", url.Values{"time": {"20"}}, &searchResponse{}); code != http.StatusOK {
+		t.Errorf("Expected status %d but got %d\n", http.StatusOK, code)
+	}
+}
+
+func TestSearchPoolOwners(t *testing.T) {
+	p := newSearchPool(1)
+
+	// the table stays with its owner and is cleared for another one
+	for _, c := range []struct {
+		owner string
+		kept  bool
+	}{{"1", false}, {"1", true}, {"2", false}, {"", true}, {"", true}} {
+		tt, err := p.acquire(0, nil, c.owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tt.probe(42); ok != c.kept {
+			t.Errorf("Expected the entry to be kept %v for %q but got %v\n", c.kept, c.owner, ok)
+		}
+		tt.store(42, 1, 0, ttExact, Move{}, 0)
+		p.release(tt, c.owner)
+	}
+}
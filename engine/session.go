@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sessionExtension = ".json"
+	defaultSession   = "last" // of REPL games that were not saved under a name
+)
+
+// SessionDir is the directory of the saved game sessions, when empty it is
+// .gochess/sessions in the home directory
+var SessionDir = ""
+
+// SessionInfo describes a saved game session
+type SessionInfo struct {
+	Name  string
+	Saved time.Time
+	Moves int
+	FEN   string // current position
+}
+
+// sessionFile is a game session as saved, the moves in coordinate
+// notation lead from the start position to the current one
+type sessionFile struct {
+	Saved     time.Time         `json:"saved"`
+	FEN       string            `json:"fen"`
+	Variant   string            `json:"variant"`
+	Chess960  bool              `json:"chess960,omitempty"`
+	Moves     []string          `json:"moves"`
+	Clocks    []int64           `json:"clocks,omitempty"` // in milliseconds, white first
+	Increment int64             `json:"increment,omitempty"`
+	Base      int64             `json:"base,omitempty"`
+	Network   string            `json:"network,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Current   string            `json:"current"` // FEN of the last position
+}
+
+func sessionDir() (string, error) {
+	if SessionDir != "" {
+		return SessionDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".gochess", "sessions"), nil
+}
+
+// sessionPath returns the file of a session, names are restricted so they
+// can't leave the session directory
+func sessionPath(name string) (string, error) {
+	if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") != "" || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid session name %q", name)
+	}
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+sessionExtension), nil
+}
+
+// Save writes the game to the session of the given name, which is saved
+// again after every move from now on
+func (g *Game) Save(name string) error {
+	path, err := sessionPath(name)
+	if err != nil {
+		return err
+	}
+
+	// the start position is found by taking back all moves
+	start := g.board.Clone()
+	moves := make([]string, len(start.history))
+	for i := len(start.history) - 1; i >= 0; i-- {
+		moves[i] = start.history[i].move.coordinate()
+		start.UndoMove()
+	}
+
+	s := sessionFile{Saved: time.Now(), FEN: generateFEN(start), Variant: g.board.variantName(),
+		Chess960: g.board.castling.chess960, Moves: moves, Network: g.network, Params: g.params,
+		Current: generateFEN(g.board)}
+	if g.timed {
+		clocks := g.clocks
+		clocks[colorIndex(g.board.sideToMove)] -= time.Since(g.turnStart)
+		s.Clocks = []int64{clocks[0].Milliseconds(), clocks[1].Milliseconds()}
+		s.Base, s.Increment = g.base.Milliseconds(), g.increment.Milliseconds()
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// like the parameter files, a session is replaced in one step
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	g.session = name
+	return nil
+}
+
+// LoadGame resumes the saved session of the given name, the parameters and
+// the network of the session replace the current ones, which are reset to
+// the defaults first
+func LoadGame(name string) (*Game, error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := sessionFile{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("session %s: %v", name, err)
+	}
+
+	b, err := NewVariantBoard(s.Variant, s.FEN)
+	if err != nil {
+		return nil, err
+	}
+	if s.Chess960 {
+		b.setChess960()
+	}
+	for _, move := range s.Moves {
+		m, err := parseSAN(b, move)
+		if err != nil {
+			return nil, fmt.Errorf("session %s: %v", name, err)
+		}
+		b.MakeMove(m)
+	}
+	b.updateStatus()
+
+	g := &Game{board: b, session: name, params: map[string]string{}}
+	if len(s.Clocks) == 2 {
+		g.timed = true
+		g.clocks = [2]time.Duration{time.Duration(s.Clocks[0]) * time.Millisecond, time.Duration(s.Clocks[1]) * time.Millisecond}
+		g.base, g.increment = time.Duration(s.Base)*time.Millisecond, time.Duration(s.Increment)*time.Millisecond
+		g.turnStart = time.Now()
+	}
+
+	var network *Network
+	if s.Network != "" {
+		if network, err = LoadNetwork(s.Network); err != nil {
+			return nil, err
+		}
+		g.network = s.Network
+	}
+
+	// the settings of the session start from the defaults, the current
+	// ones stay if the session has invalid parameters
+	current := snapshotParams()
+	restoreParams(defaultParams)
+	for param, values := range s.Params {
+		if err := SetParam(param, values); err != nil {
+			restoreParams(current)
+			return nil, err
+		}
+		g.params[param] = values
+	}
+	UseNetwork(network)
+
+	return g, nil
+}
+
+// Sessions lists the saved sessions, the most recent first
+func Sessions() ([]SessionInfo, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+sessionExtension))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []SessionInfo{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s := sessionFile{}
+		if json.Unmarshal(data, &s) != nil {
+			continue
+		}
+		sessions = append(sessions, SessionInfo{Name: strings.TrimSuffix(filepath.Base(path), sessionExtension),
+			Saved: s.Saved, Moves: len(s.Moves), FEN: s.Current})
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Saved.After(sessions[j].Saved)
+	})
+	return sessions, nil
+}
+
+// autosave saves the game to its session, if it has one
+func (g *Game) autosave() {
+	if g.session == "" {
+		return
+	}
+	if err := g.Save(g.session); err != nil {
+		fmt.Printf("could not save session %s: %v\n", g.session, err)
+	}
+}
+
+// resume runs "load <name>" or "resume [name]", without a name the most
+// recently saved session is resumed, which is the default session unless
+// a named one was played later
+func (g *Game) resume(fields []string) {
+	name := ""
+	if len(fields) > 1 {
+		name = fields[1]
+	} else if fields[0] == "resume" {
+		sessions, err := Sessions()
+		if err == nil && len(sessions) == 0 {
+			err = errors.New("no saved sessions")
+		}
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		name = sessions[0].Name
+	} else {
+		fmt.Printf("usage: load <name>\n")
+		return
+	}
+
+	loaded, err := LoadGame(name)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	loaded.db = g.db
+	*g = *loaded
+	fmt.Printf("session %s, %d moves\n%s\n", name, len(g.board.history), formatBoard(g.board))
+}
+
+// printSessions runs "sessions"
+func printSessions() {
+	sessions, err := Sessions()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	for _, s := range sessions {
+		fmt.Printf("%-16s %s %4d moves  %s\n", s.Name, s.Saved.Format("2006-01-02 15:04"), s.Moves, s.FEN)
+	}
+}
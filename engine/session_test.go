@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+// playMoves makes the given moves in the game as if typed into the REPL
+func playMoves(t *testing.T, g *Game, moves ...string) {
+	for _, move := range moves {
+		m, err := parseSAN(g.board, move)
+		if err != nil {
+			t.Fatalf("Expected %s to be legal but got %v\n", move, err)
+		}
+		g.play(m)
+	}
+}
+
+func TestSessionResume(t *testing.T) {
+	SessionDir = t.TempDir()
+	defer func() { SessionDir = "" }()
+
+	params := snapshotParams()
+	defer restoreParams(params)
+
+	g := NewGame()
+	g.setBoard(NewBoard("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"))
+	g.clock([]string{"clock", "60+1"})
+	if err := g.Save("first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the session is saved after every move
+	playMoves(t, g, "O-O", "Kd8", "Rf7")
+	SetParam("pawnValue", "90")
+	g.params["pawnValue"] = "90"
+	g.autosave()
+	fen := generateFEN(g.board)
+
+	pawnValue = 100
+	loaded, err := LoadGame("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generateFEN(loaded.board) != fen || len(loaded.board.history) != 3 {
+		t.Errorf("Expected %s after 3 moves but got %s\n", fen, generateFEN(loaded.board))
+	}
+	if !loaded.timed || loaded.increment != time.Second || loaded.clocks[0] < 60*time.Second || loaded.clocks[1] > 61*time.Second {
+		t.Errorf("Expected the clocks of 60+1 but got %v %v\n", loaded.clocks, loaded.increment)
+	}
+	if pawnValue != 90 || loaded.params["pawnValue"] != "90" {
+		t.Errorf("Expected the parameters of the session but got %d\n", pawnValue)
+	}
+
+	// the moves can be taken back to the start
+	for len(loaded.board.history) > 0 {
+		loaded.board.UndoMove()
+	}
+	if expected := "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"; generateFEN(loaded.board) != expected {
+		t.Errorf("Expected %s but got %s\n", expected, generateFEN(loaded.board))
+	}
+}
+
+func TestSessionSettings(t *testing.T) {
+	SessionDir = t.TempDir()
+	defer func() { SessionDir = "" }()
+
+	params := snapshotParams()
+	defer restoreParams(params)
+	defer UseNetwork(nil)
+
+	g := NewGame()
+	g.Save("plain")
+
+	// the settings changed after saving don't leak into the session
+	SetParam("pawnValue", "90")
+	g.params["pawnValue"] = "90"
+	UseNetwork(randomNetwork(4, 1))
+	g.network = "net.bin"
+	g.resume([]string{"load", "plain"})
+
+	if pawnValue != 100 || activeNetwork != nil || g.network != "" || len(g.params) != 0 {
+		t.Errorf("Expected the default settings but got %d %v %q %v\n", pawnValue, activeNetwork != nil, g.network, g.params)
+	}
+}
+
+func TestSessionVariants(t *testing.T) {
+	SessionDir = t.TempDir()
+	defer func() { SessionDir = "" }()
+
+	g := NewGame()
+	b, _ := NewChess960Board(200)
+	g.setBoard(b)
+	g.Save("chess960")
+	playMoves(t, g, "Nf3", "Nf6", "g3", "g6", "e3", "e6", "O-O")
+
+	b, _ = NewVariantBoard("crazyhouse", "")
+	g.setBoard(b)
+	g.Save("crazyhouse")
+	playMoves(t, g, "e4", "d5", "exd5", "Qxd5", "Nc3", "Qa5", "P@d5")
+
+	for _, name := range []string{"chess960", "crazyhouse"} {
+		saved := NewGame()
+		saved.resume([]string{"load", name})
+		if saved.session != name || len(saved.board.history) != 7 {
+			t.Errorf("Expected to resume %s but got %s %d\n", name, saved.session, len(saved.board.history))
+		}
+	}
+	if g.board.pockets[0][Pawn-1] != 0 || g.board.pockets[1][Pawn-1] != 1 {
+		t.Errorf("Expected the dropped pawn to leave the pocket but got %v\n", g.board.pockets)
+	}
+}
+
+func TestDefaultSession(t *testing.T) {
+	SessionDir = t.TempDir()
+	defer func() { SessionDir = "" }()
+
+	// a REPL game is saved without being named
+	g := NewGame()
+	g.session = defaultSession
+	playMoves(t, g, "e4", "e5")
+
+	resumed := NewGame()
+	resumed.resume([]string{"resume"})
+	if resumed.session != defaultSession || len(resumed.board.history) != 2 {
+		t.Errorf("Expected to resume the default session but got %q %d\n", resumed.session, len(resumed.board.history))
+	}
+
+	// a new game leaves the named session and replaces the default one
+	g.Save("named")
+	g.setBoard(NewBoard(defaultFEN))
+	playMoves(t, g, "d4")
+	if g.session != defaultSession {
+		t.Errorf("Expected the new game in the default session but got %q\n", g.session)
+	}
+	for name, moves := range map[string]int{"named": 2, defaultSession: 1} {
+		if loaded, err := LoadGame(name); err != nil || len(loaded.board.history) != moves {
+			t.Errorf("Expected %d moves in %s but got %v\n", moves, name, err)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	SessionDir = t.TempDir()
+	defer func() { SessionDir = "" }()
+
+	if sessions, err := Sessions(); err != nil || len(sessions) != 0 {
+		t.Errorf("Expected no sessions but got %v %v\n", sessions, err)
+	}
+
+	for _, name := range []string{"old", "new"} {
+		g := NewGame()
+		playMoves(t, g, "e4")
+		if err := g.Save(name); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sessions, _ := Sessions()
+	if len(sessions) != 2 || sessions[0].Name != "new" || sessions[0].Moves != 1 {
+		t.Errorf("Expected the sessions, the most recent first, but got %v\n", sessions)
+	}
+
+	g := NewGame()
+	g.resume([]string{"resume"})
+	if g.session != "new" {
+		t.Errorf("Expected to resume the last session but got %q\n", g.session)
+	}
+
+	for _, name := range []string{"", "../x", ".hidden", "a/b"} {
+		if err := NewGame().Save(name); err == nil {
+			t.Errorf("Expected an error for the session name %q\n", name)
+		}
+	}
+	if _, err := LoadGame("missing"); err == nil {
+		t.Errorf("Expected an error for a missing session\n")
+	}
+}
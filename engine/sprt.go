@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// MatchScore counts the results of a match from the first engine's point of
+// view
+type MatchScore struct {
+	Wins   int
+	Draws  int
+	Losses int
+}
+
+func (s MatchScore) games() int {
+	return s.Wins + s.Draws + s.Losses
+}
+
+// score returns the mean result per game and its variance
+func (s MatchScore) score() (float64, float64) {
+	n := float64(s.games())
+	if n == 0 {
+		return 0.5, 0
+	}
+
+	mean := (float64(s.Wins) + float64(s.Draws)/2) / n
+	variance := (float64(s.Wins)*math.Pow(1-mean, 2) +
+		float64(s.Draws)*math.Pow(0.5-mean, 2) +
+		float64(s.Losses)*math.Pow(mean, 2)) / n
+
+	return mean, variance
+}
+
+// Elo returns the rating difference and the margin of its 95% confidence
+// interval
+func (s MatchScore) Elo() (float64, float64) {
+	mean, variance := s.score()
+	if s.games() == 0 {
+		return 0, 0
+	}
+
+	deviation := math.Sqrt(variance / float64(s.games()))
+	low := eloDifference(mean - 1.96*deviation)
+	high := eloDifference(mean + 1.96*deviation)
+
+	return eloDifference(mean), (high - low) / 2
+}
+
+// eloDifference converts a score to a rating difference, clamped for
+// scores of 0 or 1
+func eloDifference(score float64) float64 {
+	score = math.Max(0.001, math.Min(0.999, score))
+	return 400 * math.Log10(score/(1-score))
+}
+
+// eloScore is the expected score of a rating difference
+func eloScore(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// LLR returns the log likelihood ratio of the hypotheses that the first
+// engine is elo1 rather than elo0 stronger, using the normal approximation
+// of the results
+func (s MatchScore) LLR(elo0, elo1 float64) float64 {
+	mean, variance := s.score()
+	if variance == 0 {
+		return 0
+	}
+
+	s0, s1 := eloScore(elo0), eloScore(elo1)
+	return (s1 - s0) * (2*mean - s0 - s1) * float64(s.games()) / (2 * variance)
+}
+
+// sprtBounds returns the log likelihood ratios at which H0 respectively H1
+// is accepted for the given error probabilities
+func sprtBounds(alpha, beta float64) (float64, float64) {
+	return math.Log(beta / (1 - alpha)), math.Log((1 - beta) / alpha)
+}
+
+// SPRT is a sequential probability ratio test of elo0 against elo1
+type SPRT struct {
+	Elo0, Elo1  float64
+	Alpha, Beta float64
+}
+
+// Verdict returns "H1" if the first engine is elo1 stronger, "H0" if it is
+// not elo0 stronger, or an empty string if more games are needed
+func (t SPRT) Verdict(s MatchScore) string {
+	lower, upper := sprtBounds(t.Alpha, t.Beta)
+	switch llr := s.LLR(t.Elo0, t.Elo1); {
+	case llr >= upper:
+		return "H1"
+	case llr <= lower:
+		return "H0"
+	}
+	return ""
+}
+
+func (t SPRT) String() string {
+	return fmt.Sprintf("SPRT elo0=%g elo1=%g alpha=%g beta=%g", t.Elo0, t.Elo1, t.Alpha, t.Beta)
+}
+
+func (s MatchScore) String() string {
+	elo, margin := s.Elo()
+	return fmt.Sprintf("+%d =%d -%d, elo %.1f +/- %.1f", s.Wins, s.Draws, s.Losses, elo, margin)
+}
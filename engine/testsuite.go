@@ -0,0 +1,321 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TestSuiteOptions configures a run of a tactical test suite
+type TestSuiteOptions struct {
+	File    string        // EPD file with bm, am, dm or c0 operations
+	OutFile string        // a summary line is appended to this file
+	Label   string        // names the run in the summary, e.g. the version
+	Time    time.Duration // search limits per position
+	Depth   int
+	Nodes   int64
+	Threads int // positions searched in parallel, defaults to the number of cores
+}
+
+// suiteTest is a position of a test suite with its solution: best moves
+// (bm), moves to avoid (am), a mate in n moves (dm) and points for several
+// moves as in STS (c0 "f5=10, Be5+=2")
+type suiteTest struct {
+	id        string
+	fen       string
+	expected  string // the operations as written in the file
+	best      []Move
+	avoid     []Move
+	mate      int
+	points    map[Move]int
+	maxPoints int
+}
+
+type suiteResult struct {
+	test   *suiteTest
+	move   string
+	solved bool
+	points int
+	time   time.Duration // of the iteration from which on the move was right
+	depth  int
+	nodes  int64
+}
+
+// readTestSuite reads the positions of an EPD file, positions without a
+// solution are rejected
+func readTestSuite(path string) ([]*suiteTest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tests := []*suiteTest{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		t, err := parseSuiteTest(text, fmt.Sprintf("%d", len(tests)+1))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		tests = append(tests, t)
+	}
+
+	return tests, scanner.Err()
+}
+
+func parseSuiteTest(line, id string) (*suiteTest, error) {
+	record, err := parseEPD(line)
+	if err != nil {
+		return nil, err
+	}
+
+	b, _ := parseFEN(record.fen)
+	t := &suiteTest{id: record.id(id), fen: record.fen}
+	expected := []string{}
+
+	for _, op := range []string{"bm", "am"} {
+		sans, ok := record.ops[op]
+		if !ok {
+			continue
+		}
+		for _, san := range sans {
+			move, err := parseSAN(b, san)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", op, err)
+			}
+			if op == "bm" {
+				t.best = append(t.best, move)
+			} else {
+				t.avoid = append(t.avoid, move)
+			}
+		}
+		expected = append(expected, op+" "+strings.Join(sans, " "))
+	}
+
+	if dm, ok := record.ops["dm"]; ok {
+		if len(dm) != 1 {
+			return nil, errors.New("dm: invalid mate")
+		}
+		if t.mate, err = strconv.Atoi(dm[0]); err != nil || t.mate < 1 {
+			return nil, fmt.Errorf("dm: invalid mate %q", dm[0])
+		}
+		expected = append(expected, "dm "+dm[0])
+	}
+
+	if c0, ok := record.ops["c0"]; ok && len(c0) == 1 && strings.Contains(c0[0], "=") {
+		if t.points, err = parsePoints(b, c0[0]); err != nil {
+			return nil, fmt.Errorf("c0: %v", err)
+		}
+		for _, p := range t.points {
+			if p > t.maxPoints {
+				t.maxPoints = p
+			}
+		}
+		if len(t.best) == 0 {
+			expected = append(expected, "c0 "+c0[0])
+		}
+	}
+
+	if len(expected) == 0 {
+		return nil, errors.New("no bm, am, dm or c0 operation")
+	}
+	t.expected = strings.Join(expected, "; ")
+
+	return t, nil
+}
+
+// parsePoints reads a list like "f5=10, Be5+=2, Bf2=3"
+func parsePoints(b *Board, list string) (map[Move]int, error) {
+	points := map[Move]int{}
+	for _, entry := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "=")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+
+		// promotions contain a "=" too
+		value := parts[len(parts)-1]
+		san := strings.Join(parts[:len(parts)-1], "=")
+
+		move, err := parseSAN(b, san)
+		if err != nil {
+			return nil, err
+		}
+		if points[move], err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid points %q", value)
+		}
+	}
+	return points, nil
+}
+
+// solves tells whether a search result fulfills all operations
+func (t *suiteTest) solves(result SearchResult) bool {
+	if t.mate > 0 && (result.Score < scoreMate || result.Score-scoreMate > 2*t.mate-1) {
+		return false
+	}
+	if len(t.best) > 0 && !moveIn(t.best, result.Move) {
+		return false
+	}
+	if moveIn(t.avoid, result.Move) {
+		return false
+	}
+	if len(t.best) == 0 && len(t.points) > 0 && t.points[result.Move] < t.maxPoints {
+		return false
+	}
+	return true
+}
+
+func moveIn(moves []Move, m Move) bool {
+	for _, move := range moves {
+		if move == m {
+			return true
+		}
+	}
+	return false
+}
+
+// run searches the position, the time to solution is the time of the
+// iteration from which on all iterations found a solution
+func (t *suiteTest) run(limits SearchLimits) suiteResult {
+	b := NewBoard(t.fen)
+	r := suiteResult{test: t, time: -1}
+
+	limits.Progress = func(result SearchResult) {
+		if !t.solves(result) {
+			r.time = -1
+		} else if r.time < 0 {
+			r.time = result.Time
+		}
+	}
+	result := SearchWithLimits(b, limits)
+
+	r.move = formatSAN(b, result.Move)
+	r.solved = t.solves(result)
+	r.points = t.points[result.Move]
+	r.depth = result.Depth
+	r.nodes = result.Nodes
+	if !r.solved {
+		r.time = 0
+	} else if r.time < 0 {
+		r.time = result.Time
+	}
+
+	return r
+}
+
+// TestSuite searches the positions of an EPD test suite in parallel and
+// prints for every position whether it was solved and after which time.
+// The totals, together with the STS points if the suite has any, are
+// appended as one line to the OutFile, so runs of different versions can
+// be compared.
+func TestSuite(options TestSuiteOptions) error {
+	if options.Threads < 1 {
+		options.Threads = runtime.NumCPU()
+	}
+	if options.Time <= 0 && options.Depth <= 0 && options.Nodes <= 0 {
+		return errors.New("either a time, depth or node limit is required")
+	}
+
+	tests, err := readTestSuite(options.File)
+	if err != nil {
+		return err
+	}
+
+	limits := SearchLimits{Time: options.Time, Depth: options.Depth, Nodes: options.Nodes}
+	indexes := make(chan int)
+	results := make(chan suiteResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < options.Threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the positions are independent, each starts with an empty table
+			limits := limits
+			limits.TT = NewTranspositionTable(searchHashSize)
+			for index := range indexes {
+				limits.TT.Clear()
+				results <- tests[index].run(limits)
+			}
+		}()
+	}
+
+	go func() {
+		for i := range tests {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	solved, points, maxPoints := 0, 0, 0
+	solutionTime := time.Duration(0)
+
+	for r := range results {
+		status := "unsolved"
+		if r.solved {
+			status = "solved"
+			solved++
+			solutionTime += r.time
+		}
+		points += r.points
+		maxPoints += r.test.maxPoints
+
+		fmt.Printf("%-12s %-8s %-8s %5ss  depth %2d %7s nodes  (%s)\n", r.test.id, status, r.move,
+			formatDuration(r.time), r.depth, formatNodesCount(r.nodes), r.test.expected)
+	}
+
+	summary := fmt.Sprintf("solved %d/%d", solved, len(tests))
+	if maxPoints > 0 {
+		summary += fmt.Sprintf(" points %d/%d", points, maxPoints)
+	}
+	summary += fmt.Sprintf(" time-to-solution %ss", formatDuration(solutionTime))
+	fmt.Printf("%s in %ss\n", summary, formatDuration(time.Since(start)))
+
+	if options.OutFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(options.OutFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	label := options.Label
+	if label == "" {
+		label = "-"
+	}
+	_, err = fmt.Fprintf(f, "%s %s %s %s %s\n", time.Now().Format("2006-01-02 15:04"), label,
+		filepath.Base(options.File), limitsString(limits), summary)
+	return err
+}
+
+// limitsString describes the search limits, e.g. "time=1s depth=8"
+func limitsString(limits SearchLimits) string {
+	s := []string{}
+	if limits.Time > 0 {
+		s = append(s, "time="+limits.Time.String())
+	}
+	if limits.Depth > 0 {
+		s = append(s, fmt.Sprintf("depth=%d", limits.Depth))
+	}
+	if limits.Nodes > 0 {
+		s = append(s, fmt.Sprintf("nodes=%d", limits.Nodes))
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEPD(t *testing.T) {
+	r, err := parseEPD(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC 001; mate";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.fen != "2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - -" {
+		t.Errorf("Expected the position but got %s\n", r.fen)
+	}
+	if bm := r.ops["bm"]; len(bm) != 1 || bm[0] != "Qg6" {
+		t.Errorf("Expected bm Qg6 but got %v\n", bm)
+	}
+	if id := r.id(""); id != "WAC 001; mate" {
+		t.Errorf("Expected the quoted id but got %s\n", id)
+	}
+}
+
+func TestParseSuiteTest(t *testing.T) {
+	test, err := parseSuiteTest(`4k3/8/8/3q4/8/8/8/3QK3 w - - c0 "Qxd5=10, Kf2=1";`, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test.maxPoints != 10 || test.points[Move{From: E1, To: F2, MovedPiece: WhiteKing}] != 1 {
+		t.Errorf("Expected the points of the moves but got %v\n", test.points)
+	}
+
+	for _, line := range []string{"7k/8/8/8/8/8/8/K7 w - - id \"none\";", "7k/8/8/8/8/8/8/K7 w - - bm Kb3;", "7k/8/8/8/8/8/8/K7 w - - dm x;"} {
+		if _, err := parseSuiteTest(line, "1"); err == nil {
+			t.Errorf("Expected an error for %s\n", line)
+		}
+	}
+}
+
+func TestTestSuite(t *testing.T) {
+	tests, err := readTestSuite("testdata/tactics.epd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		if r := test.run(SearchLimits{Depth: 4}); !r.solved || r.time < 0 {
+			t.Errorf("Expected %s to be solved but got %s (%s)\n", test.id, r.move, test.expected)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "summary.txt")
+	options := TestSuiteOptions{File: "testdata/tactics.epd", OutFile: out, Label: "test", Depth: 4, Threads: 2}
+	for i := 0; i < 2; i++ {
+		if err := TestSuite(options); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, _ := os.ReadFile(out)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "test tactics.epd depth=4 solved 5/5 points 10/10") {
+		t.Errorf("Expected a summary line per run but got\n%s\n", data)
+	}
+}
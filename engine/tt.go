@@ -0,0 +1,93 @@
+package engine
+
+import "unsafe"
+
+var searchHashSize = 16 // size of the transposition table in MB
+
+const (
+	ttExact int8 = iota + 1
+	ttLower      // score is a lower bound (fail high)
+	ttUpper      // score is an upper bound (fail low)
+)
+
+type ttEntry struct {
+	key   int64
+	move  PackedMove
+	score int32
+	depth int8
+	flag  int8
+}
+
+// TranspositionTable stores search results by position hash, an engine
+// keeps one across the moves of a game
+type TranspositionTable struct {
+	entries []ttEntry
+	mask    int64
+	size    int // in MB
+}
+
+// NewTranspositionTable creates a table of at most the given size in MB
+func NewTranspositionTable(mb int) *TranspositionTable {
+	n := int64(1)
+	for (n*2)*int64(unsafe.Sizeof(ttEntry{})) <= int64(mb)<<20 {
+		n *= 2
+	}
+	return &TranspositionTable{entries: make([]ttEntry, n), mask: n - 1, size: mb}
+}
+
+// Clear empties the table for a new game
+func (tt *TranspositionTable) Clear() {
+	for i := range tt.entries {
+		tt.entries[i] = ttEntry{}
+	}
+}
+
+// gameTable returns the table of an engine, which is created on first use
+// and again after the hash size changed
+func gameTable(tt **TranspositionTable) *TranspositionTable {
+	if *tt == nil || (*tt).size != searchHashSize {
+		*tt = NewTranspositionTable(searchHashSize)
+	}
+	return *tt
+}
+
+func (tt *TranspositionTable) probe(key int64) (ttEntry, bool) {
+	e := tt.entries[key&tt.mask]
+	return e, e.flag != 0 && e.key == key
+}
+
+// store replaces entries of other positions or of shallower searches, mate
+// scores are stored relative to the position
+func (tt *TranspositionTable) store(key int64, depth, score int, flag int8, move Move, ply int) {
+	e := &tt.entries[key&tt.mask]
+	if e.key == key && int(e.depth) > depth && flag != ttExact {
+		return
+	}
+
+	packed := move.Pack()
+	if e.key == key && move.MovedPiece == Empty {
+		packed = e.move
+	}
+
+	*e = ttEntry{key: key, move: packed, score: int32(scoreToTT(score, ply)), depth: int8(depth), flag: flag}
+}
+
+func scoreToTT(score, ply int) int {
+	switch {
+	case score >= scoreMate:
+		return score - ply
+	case score <= -scoreMate:
+		return score + ply
+	}
+	return score
+}
+
+func scoreFromTT(score, ply int) int {
+	switch {
+	case score >= scoreMate:
+		return score + ply
+	case score <= -scoreMate:
+		return score - ply
+	}
+	return score
+}
@@ -0,0 +1,344 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TuneOptions configures a Texel tuning run
+type TuneOptions struct {
+	DataFile   string // quiet positions with game results
+	OutFile    string // parameter file written after every improvement
+	Quiescence bool   // score positions with quiescence instead of Evaluate
+	Threads    int    // number of workers, defaults to the number of cores
+	Iterations int    // maximum number of local search passes, 0 = unlimited
+	Resume     bool   // continue a previous run from OutFile
+}
+
+type tunePosition struct {
+	board  *Board
+	result float64 // game result from white's point of view
+}
+
+type tuneState struct {
+	iteration int
+	param     int
+	improved  bool
+	k         float64
+}
+
+type tuner struct {
+	options   TuneOptions
+	positions []tunePosition
+	searches  []pvSearch
+	state     tuneState
+}
+
+// Tune optimizes the evaluation weights against a set of labeled positions
+//
+// The mean squared error between the game results and the sigmoid-mapped
+// score of each position is minimized with a local search over all weights
+// registered in params.go (see Texel's tuning method).
+func Tune(options TuneOptions) error {
+	if options.Threads < 1 {
+		options.Threads = runtime.NumCPU()
+	}
+
+	t := tuner{options: options}
+	t.searches = make([]pvSearch, options.Threads)
+
+	if options.Resume {
+		if err := t.loadState(); err != nil {
+			return err
+		}
+	}
+
+	if err := t.loadPositions(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d positions loaded, %d parameters, %d threads\n",
+		len(t.positions), len(paramVector()), options.Threads)
+
+	if t.state.k == 0 {
+		t.state.k = t.fitK()
+		fmt.Printf("K: %.3f\n", t.state.k)
+	}
+
+	t.localSearch()
+
+	return nil
+}
+
+func (t *tuner) localSearch() {
+	v := paramVector()
+	best := t.error(t.state.k)
+	fmt.Printf("iteration %d, parameter %d, error %.6f\n", t.state.iteration, t.state.param, best)
+
+	for t.options.Iterations == 0 || t.state.iteration < t.options.Iterations {
+		start := time.Now()
+
+		for t.state.param < len(v) {
+			i := t.state.param
+			improved := t.tryParam(v, i, &best)
+			t.state.param++
+
+			// checkpoint after improvements and once per parameter group
+			if improved || t.isLastOfGroup(i) {
+				t.save()
+			}
+		}
+
+		fmt.Printf("iteration %d, error %.6f, %ss\n",
+			t.state.iteration, best, formatDuration(time.Since(start)))
+
+		improved := t.state.improved
+		t.state.iteration++
+		t.state.param = 0
+		t.state.improved = false
+		t.save()
+
+		if !improved {
+			break
+		}
+	}
+}
+
+// tryParam changes a single weight by one in both directions and keeps the
+// change if it lowers the error
+func (t *tuner) tryParam(v []int, i int, best *float64) bool {
+	for _, delta := range []int{1, -2} {
+		v[i] += delta
+		setParamVector(v)
+		if e := t.error(t.state.k); e < *best {
+			*best = e
+			t.state.improved = true
+			return true
+		}
+	}
+
+	v[i]++
+	setParamVector(v)
+
+	return false
+}
+
+func (t *tuner) isLastOfGroup(index int) bool {
+	for _, p := range evalParams {
+		index -= len(p.values)
+		if index < 0 {
+			return index == -1
+		}
+	}
+	return false
+}
+
+// fitK finds the scaling constant which minimizes the error of the
+// current weights
+func (t *tuner) fitK() float64 {
+	best := 1.0
+	bestError := t.error(best)
+
+	for step := 0.1; step >= 0.001; step /= 10 {
+		from, to := best-10*step, best+10*step
+		for k := from; k <= to; k += step {
+			if k <= 0 {
+				continue
+			}
+			if e := t.error(k); e < bestError {
+				best = k
+				bestError = e
+			}
+		}
+	}
+
+	return best
+}
+
+// error computes the mean squared error over all positions in parallel
+func (t *tuner) error(k float64) float64 {
+	threads := len(t.searches)
+	chunk := (len(t.positions) + threads - 1) / threads
+	sums := make([]float64, threads)
+
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		from := i * chunk
+		to := from + chunk
+		if to > len(t.positions) {
+			to = len(t.positions)
+		}
+		if from >= to {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, positions []tunePosition) {
+			defer wg.Done()
+			for _, p := range positions {
+				d := p.result - sigmoid(k, t.score(&t.searches[i], p.board))
+				sums[i] += d * d
+			}
+		}(i, t.positions[from:to])
+	}
+	wg.Wait()
+
+	sum := 0.0
+	for _, s := range sums {
+		sum += s
+	}
+
+	return sum / float64(len(t.positions))
+}
+
+// score returns the evaluation from white's point of view
+func (t *tuner) score(pv *pvSearch, b *Board) int {
+	score := 0
+	if t.options.Quiescence {
+		pv.board = b
+		score = pv.quiescence(-searchEvalStart, searchEvalStart, false)
+	} else {
+		score = evaluateClassic(b)
+	}
+	return int(b.sideToMove) * score
+}
+
+func sigmoid(k float64, score int) float64 {
+	return 1 / (1 + math.Pow(10, -k*float64(score)/400))
+}
+
+func (t *tuner) loadPositions() error {
+	f, err := os.Open(t.options.DataFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fen, result, err := parseTuneLine(text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", t.options.DataFile, line, err)
+		}
+
+		b, err := parseFEN(fen)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", t.options.DataFile, line, err)
+		}
+
+		t.positions = append(t.positions, tunePosition{board: b, result: result})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(t.positions) == 0 {
+		return errors.New("no positions found in " + t.options.DataFile)
+	}
+
+	return nil
+}
+
+// parseTuneLine splits a line of training data into FEN and result
+//
+// Supported are EPD lines with a c9 "1-0" style result as well as FENs
+// followed by a result like "1/2-1/2" or "[0.5]".
+func parseTuneLine(line string) (string, float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return "", 0, errors.New("invalid position")
+	}
+
+	fen := strings.Join(fields[:4], " ")
+	rest := strings.Join(fields[4:], " ")
+
+	switch {
+	case strings.Contains(rest, "1/2-1/2"):
+		return fen, 0.5, nil
+	case strings.Contains(rest, "1-0"):
+		return fen, 1, nil
+	case strings.Contains(rest, "0-1"):
+		return fen, 0, nil
+	}
+
+	if from, to := strings.Index(rest, "["), strings.Index(rest, "]"); from >= 0 && to > from {
+		result, err := strconv.ParseFloat(rest[from+1:to], 64)
+		if err != nil || result < 0 || result > 1 {
+			return "", 0, fmt.Errorf("invalid result %q", rest[from:to+1])
+		}
+		return fen, result, nil
+	}
+
+	return "", 0, errors.New("missing result")
+}
+
+func (t *tuner) statePath() string {
+	return t.options.OutFile + ".state"
+}
+
+// save writes the current weights together with a checkpoint to continue
+// an interrupted run
+func (t *tuner) save() {
+	if err := SaveParams(t.options.OutFile); err != nil {
+		fmt.Printf("could not save parameters: %v\n", err)
+		return
+	}
+
+	state := fmt.Sprintf("iteration %d\nparam %d\nimproved %t\nk %g\n",
+		t.state.iteration, t.state.param, t.state.improved, t.state.k)
+
+	if err := os.WriteFile(t.statePath(), []byte(state), 0644); err != nil {
+		fmt.Printf("could not save state: %v\n", err)
+	}
+}
+
+func (t *tuner) loadState() error {
+	if err := LoadParams(t.options.OutFile); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(t.statePath())
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "iteration":
+			t.state.iteration, err = strconv.Atoi(fields[1])
+		case "param":
+			t.state.param, err = strconv.Atoi(fields[1])
+		case "improved":
+			t.state.improved, err = strconv.ParseBool(fields[1])
+		case "k":
+			t.state.k, err = strconv.ParseFloat(fields[1], 64)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.statePath(), err)
+		}
+	}
+
+	fmt.Printf("resuming at iteration %d, parameter %d\n", t.state.iteration, t.state.param)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTuneLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		fen    string
+		result float64
+	}{
+		{`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - c9 "1/2-1/2";`, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -", 0.5},
+		{"8/8/8/8/8/8/8/K6k w - - 0 1 [1.0]", "8/8/8/8/8/8/8/K6k w - -", 1},
+		{"8/8/8/8/8/8/8/K6k b - - 0-1", "8/8/8/8/8/8/8/K6k b - -", 0},
+	}
+
+	for _, test := range tests {
+		fen, result, err := parseTuneLine(test.line)
+		if err != nil || fen != test.fen || result != test.result {
+			t.Errorf("Expected %q %.1f but got %q %.1f (%v)\n", test.fen, test.result, fen, result, err)
+		}
+	}
+
+	if _, _, err := parseTuneLine("8/8/8/8/8/8/8/K6k w - - 0 1"); err == nil {
+		t.Errorf("Expected an error for a missing result\n")
+	}
+}
+
+func TestSaveAndLoadParams(t *testing.T) {
+	original := paramVector()
+	defer setParamVector(original)
+
+	path := filepath.Join(t.TempDir(), "params.txt")
+
+	pawnValue = 123
+	knightTable[square(3, 4)] = -7
+	if err := SaveParams(path); err != nil {
+		t.Fatal(err)
+	}
+
+	setParamVector(original)
+	if err := LoadParams(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if pawnValue != 123 || knightTable[square(3, 4)] != -7 {
+		t.Errorf("Expected saved parameters but got %d and %d\n", pawnValue, knightTable[square(3, 4)])
+	}
+}
+
+func TestTuneResume(t *testing.T) {
+	original := paramVector()
+	defer setParamVector(original)
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "quiet.epd")
+	out := filepath.Join(dir, "params.txt")
+
+	positions := `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - c9 "1/2-1/2";
+4k3/8/8/8/8/8/PPPPPPPP/4K3 w - - c9 "1-0";
+4k3/pppppppp/8/8/8/8/8/4K3 b - - c9 "0-1";
+4k3/8/8/3q4/8/8/8/4K3 w - - c9 "0-1";
+4k3/8/8/8/8/8/3PP3/4K3 b - - c9 "1/2-1/2";
+`
+	if err := os.WriteFile(data, []byte(positions), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	full := filepath.Join(dir, "full.txt")
+	if err := Tune(TuneOptions{DataFile: data, OutFile: full, Threads: 2, Iterations: 2}); err != nil {
+		t.Fatal(err)
+	}
+	expected := paramVector()
+
+	setParamVector(original)
+	if err := Tune(TuneOptions{DataFile: data, OutFile: out, Threads: 2, Iterations: 1}); err != nil {
+		t.Fatal(err)
+	}
+	interrupted := paramVector()
+
+	// the resumed run has to take its weights from the checkpoint
+	pawnValue += 50
+	if err := Tune(TuneOptions{DataFile: data, OutFile: out, Threads: 2, Iterations: 2, Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	same := true
+	for i, v := range interrupted {
+		if v != expected[i] {
+			same = false
+		}
+	}
+	if same {
+		t.Fatalf("Expected the second iteration to change the weights\n")
+	}
+
+	// the resumed run picks up the second iteration from the checkpoint and
+	// must end where an uninterrupted run does
+	for i, v := range paramVector() {
+		if v != expected[i] {
+			t.Fatalf("Expected resumed weights to match an uninterrupted run\n")
+		}
+	}
+}
+
+func TestSetParam(t *testing.T) {
+	defer func(margin int) { futilityMargin = margin }(futilityMargin)
+
+	if err := SetParam("futilityMargin", "123"); err != nil || futilityMargin != 123 {
+		t.Errorf("Expected futilityMargin 123 but got %d (%v)\n", futilityMargin, err)
+	}
+
+	if err := SetParam("futilityMargin", "1 2"); err == nil {
+		t.Errorf("Expected an error for too many values\n")
+	}
+
+	if err := SetParam("unknown", "1"); err == nil {
+		t.Errorf("Expected an error for an unknown parameter\n")
+	}
+}
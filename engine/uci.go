@@ -0,0 +1,289 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const uciMaxHash = 4096 // in MB
+
+// uciServer plays as a UCI engine, a search runs in the background until
+// it completes or is stopped
+type uciServer struct {
+	out      io.Writer
+	board    *Board
+	variant  string
+	chess960 bool
+	tt       *TranspositionTable // kept between the moves of a game
+	stop     chan struct{}
+	done     chan struct{}
+	infinite bool       // the best move is held back until stop
+	mutex    sync.Mutex // the search prints its results concurrently
+}
+
+func newUCIServer(out io.Writer) *uciServer {
+	return &uciServer{out: out, board: NewBoard(defaultFEN), variant: "chess"}
+}
+
+// UCI speaks the Universal Chess Interface on the given streams until quit
+// is received or the input ends
+func UCI(in io.Reader, out io.Writer) {
+	newUCIServer(out).run(bufio.NewScanner(in))
+}
+
+// run reads the commands, a running search is completed at the end of the
+// input and an infinite one is stopped
+func (u *uciServer) run(scanner *bufio.Scanner) {
+	defer u.finish()
+
+	for scanner.Scan() {
+		if !u.command(strings.Fields(scanner.Text())) {
+			return
+		}
+	}
+}
+
+// command runs a command, it returns false on quit
+func (u *uciServer) command(fields []string) bool {
+	if len(fields) == 0 {
+		return true
+	}
+
+	switch fields[0] {
+	case "uci":
+		u.identify()
+	case "isready":
+		u.printf("readyok\n")
+	case "setoption":
+		u.finish()
+		u.setOption(fields[1:])
+	case "ucinewgame":
+		u.finish()
+		if u.tt != nil {
+			u.tt.Clear()
+		}
+		u.position([]string{"startpos"})
+	case "position":
+		u.finish()
+		u.position(fields[1:])
+	case "go":
+		u.finish()
+		u.goSearch(fields[1:])
+	case "stop":
+		u.stopSearch()
+	case "quit":
+		u.stopSearch()
+		return false
+	default:
+		u.printf("info string unknown command %s\n", fields[0])
+	}
+
+	return true
+}
+
+func (u *uciServer) identify() {
+	u.printf("id name gochess\n")
+	u.printf("id author Franziskus Domig\n")
+	u.printf("option name Hash type spin default %d min 1 max %d\n", searchHashSize, uciMaxHash)
+	u.printf("option name UCI_Chess960 type check default false\n")
+	u.printf("option name UCI_Variant type combo default chess var %s\n", strings.Join(variantNames(), " var "))
+	u.printf("uciok\n")
+}
+
+// setOption takes "name <name> value <value>"
+func (u *uciServer) setOption(fields []string) {
+	if len(fields) < 4 || fields[0] != "name" || fields[2] != "value" {
+		u.printf("info string usage: setoption name <name> value <value>\n")
+		return
+	}
+
+	value := strings.Join(fields[3:], " ")
+	switch strings.ToLower(fields[1]) {
+	case "hash":
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 || size > uciMaxHash {
+			u.printf("info string invalid hash size %s\n", value)
+			return
+		}
+		searchHashSize = size
+	case "uci_chess960":
+		u.chess960 = value == "true"
+	case "uci_variant":
+		v, err := lookupVariant(value)
+		if err != nil {
+			u.printf("info string %v\n", err)
+			return
+		}
+		// the entries of another variant are of no use
+		if old, _ := lookupVariant(u.variant); old != v && u.tt != nil {
+			u.tt.Clear()
+		}
+		u.variant = value
+	default:
+		u.printf("info string unknown option %s\n", fields[1])
+	}
+}
+
+// position takes "startpos" or "fen <fen>", both optionally followed by
+// "moves" and the moves in coordinate notation
+func (u *uciServer) position(fields []string) {
+	fen, moves := "", []string{}
+	for i, field := range fields {
+		if field == "moves" {
+			moves = fields[i+1:]
+			fields = fields[:i]
+			break
+		}
+	}
+
+	if len(fields) > 1 && fields[0] == "fen" {
+		fen = strings.Join(fields[1:], " ")
+	} else if len(fields) != 1 || fields[0] != "startpos" {
+		u.printf("info string usage: position startpos|fen <fen> [moves ...]\n")
+		return
+	}
+
+	b, err := NewVariantBoard(u.variant, fen)
+	if err != nil {
+		u.printf("info string %v\n", err)
+		return
+	}
+	if u.chess960 {
+		b.setChess960()
+	}
+
+	for _, move := range moves {
+		m, err := parseSAN(b, move)
+		if err != nil {
+			u.printf("info string %v\n", err)
+			return
+		}
+		b.MakeMove(m)
+	}
+	u.board = b
+}
+
+// goSearch starts a search with the limits depth, nodes, movetime or the
+// clocks wtime, btime, winc and binc, without any it runs until stopped
+func (u *uciServer) goSearch(fields []string) {
+	limits := SearchLimits{}
+	clocks, increments := [2]time.Duration{}, [2]time.Duration{}
+	infinite := false
+
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "infinite" {
+			infinite = true
+			continue
+		}
+		if i+1 == len(fields) {
+			break
+		}
+		value, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			continue
+		}
+		ms := time.Duration(value) * time.Millisecond
+
+		switch fields[i] {
+		case "depth":
+			limits.Depth = int(value)
+		case "nodes":
+			limits.Nodes = value
+		case "movetime":
+			limits.Time = ms
+		case "wtime":
+			clocks[0] = ms
+		case "btime":
+			clocks[1] = ms
+		case "winc":
+			increments[0] = ms
+		case "binc":
+			increments[1] = ms
+		default:
+			continue
+		}
+		i++
+	}
+
+	if side := colorIndex(u.board.sideToMove); limits.Time == 0 && clocks[side] > 0 {
+		limits.Time = planTime(clocks[side], increments[side])
+	}
+	// without limits the search is infinite as well, the protocol doesn't
+	// allow a best move before stop then
+	if limits.Depth == 0 && limits.Nodes == 0 && limits.Time == 0 {
+		infinite = true
+	}
+
+	u.stop, u.done, u.infinite = make(chan struct{}), make(chan struct{}), infinite
+	limits.Stop, limits.TT = u.stop, gameTable(&u.tt)
+	limits.Progress = func(r SearchResult) {
+		u.printf("info depth %d score %s nodes %d time %d pv %s\n",
+			r.Depth, formatUCIScore(r.Score), r.Nodes, r.Time.Milliseconds(), r.Move.coordinate())
+	}
+
+	board, stop, done := u.board.Clone(), u.stop, u.done
+	go func() {
+		defer close(done)
+		result := SearchWithLimits(board, limits)
+		if infinite {
+			<-stop
+		}
+		if result.Move.MovedPiece == Empty {
+			u.printf("bestmove 0000\n")
+			return
+		}
+		u.printf("bestmove %s\n", result.Move.coordinate())
+	}()
+}
+
+// stopSearch ends a running search, which prints its best move
+func (u *uciServer) stopSearch() {
+	if u.done != nil {
+		close(u.stop)
+		u.infinite = false
+		u.finish()
+	}
+}
+
+// finish waits for a running search, an infinite one is stopped as it
+// wouldn't end otherwise
+func (u *uciServer) finish() {
+	if u.infinite {
+		u.stopSearch()
+	}
+	if u.done != nil {
+		<-u.done
+		u.stop, u.done = nil, nil
+	}
+}
+
+func (u *uciServer) printf(format string, args ...interface{}) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	fmt.Fprintf(u.out, format, args...)
+}
+
+// formatUCIScore writes a score in centipawns or as moves to mate
+func formatUCIScore(score int) string {
+	if score >= scoreMate || score <= -scoreMate {
+		return fmt.Sprintf("mate %d", mateMoves(score))
+	}
+	return fmt.Sprintf("cp %d", score)
+}
+
+// mateMoves returns the moves to mate of a mate score, negative if the side
+// to move is mated, and 0 for other scores
+func mateMoves(score int) int {
+	switch {
+	case score >= scoreMate:
+		return (score - scoreMate + 1) / 2
+	case score <= -scoreMate:
+		return -(-score - scoreMate) / 2
+	}
+	return 0
+}
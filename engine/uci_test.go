@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUCI(t *testing.T) {
+	defer func(size int) { searchHashSize = size }(searchHashSize)
+
+	in := strings.Join([]string{
+		"uci",
+		"isready",
+		"setoption name Hash value 8",
+		"setoption name UCI_Variant value kingofthehill",
+		"position fen 7k/8/8/8/8/2K5/8/8 w - - 0 1",
+		"go depth 3",
+		"setoption name UCI_Variant value 3check",
+		"position fen 4k3/8/8/8/8/8/8/4K2R w K - 1+3 0 1 moves e1f1 e8d8",
+		"go depth 3",
+		"setoption name UCI_Variant value atomic",
+	}, "\n")
+	out := &bytes.Buffer{}
+	UCI(strings.NewReader(in), out)
+
+	for _, expected := range []string{
+		"uciok\n",
+		"readyok\n",
+		"option name UCI_Variant type combo default chess var chess var kingofthehill var 3check var antichess var crazyhouse\n",
+		"score mate 1",
+		"bestmove c3d4\n",
+		"bestmove h1h8\n",
+		"info string unknown variant atomic\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in the output but got %s\n", expected, out)
+		}
+	}
+	if searchHashSize != 8 {
+		t.Errorf("Expected a hash size of 8 MB but got %d\n", searchHashSize)
+	}
+}
+
+func TestUCIStop(t *testing.T) {
+	out := &bytes.Buffer{}
+	UCI(strings.NewReader("position startpos moves e2e4\ngo infinite\nstop\n"), out)
+
+	if !strings.Contains(out.String(), "bestmove ") {
+		t.Errorf("Expected a best move after stop but got %s\n", out)
+	}
+}
+
+func TestUCIClearsTable(t *testing.T) {
+	u := newUCIServer(&bytes.Buffer{})
+	tt := gameTable(&u.tt)
+
+	for _, c := range []struct {
+		command string
+		kept    bool
+	}{
+		{"setoption name UCI_Variant value chess", true},
+		{"setoption name UCI_Variant value 3check", false},
+		{"setoption name UCI_Variant value 3Check", true},
+		{"ucinewgame", false},
+	} {
+		tt.store(42, 1, 0, ttExact, Move{}, 0)
+		u.command(strings.Fields(c.command))
+		if _, ok := tt.probe(42); ok != c.kept {
+			t.Errorf("Expected the table to be kept %v after %s but got %v\n", c.kept, c.command, ok)
+		}
+	}
+}
+
+func TestUCIInfinite(t *testing.T) {
+	out := &bytes.Buffer{}
+	u := newUCIServer(out)
+	output := func() string {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		return out.String()
+	}
+
+	// the mate is found at once, the best move still waits for stop
+	for _, command := range []string{"go infinite", "go"} {
+		out.Reset()
+		u.command([]string{"position", "fen", "7k/5K2/8/8/8/8/8/6R1", "w", "-", "-", "0", "1"})
+		u.command(strings.Fields(command))
+		for deadline := time.Now().Add(10 * time.Second); !strings.Contains(output(), "score mate 1"); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the mate to be found but got %s\n", output())
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		if strings.Contains(output(), "bestmove") {
+			t.Errorf("Expected no best move before stop after %s but got %s\n", command, output())
+		}
+
+		u.command([]string{"stop"})
+		if !strings.Contains(output(), "bestmove g1h1\n") {
+			t.Errorf("Expected the mate after stop but got %s\n", output())
+		}
+	}
+}
+
+func TestFormatUCIScore(t *testing.T) {
+	for score, expected := range map[int]string{
+		35:               "cp 35",
+		scoreMate + 1:    "mate 1",
+		scoreMate + 3:    "mate 2",
+		-(scoreMate + 2): "mate -1",
+	} {
+		if actual := formatUCIScore(score); actual != expected {
+			t.Errorf("Expected %s for %d but got %s\n", expected, score, actual)
+		}
+	}
+}
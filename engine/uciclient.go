@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uciStartTimeout limits the time an engine needs to start and to answer
+// isready
+var uciStartTimeout = 10 * time.Second
+
+// uciEngine is an external engine speaking UCI, run as a subprocess
+type uciEngine struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string // the output of the engine, closed when it exits
+}
+
+// startUCIEngine runs a command line and waits for the engine to be ready,
+// the options are sent as setoption commands
+func startUCIEngine(command string, options map[string]string) (*uciEngine, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("missing engine command")
+	}
+
+	e := &uciEngine{name: fields[0], cmd: exec.Command(fields[0], fields[1:]...), lines: make(chan string, 64)}
+
+	stdout, err := e.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if e.stdin, err = e.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := e.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			e.lines <- scanner.Text()
+		}
+		close(e.lines)
+	}()
+
+	if err := e.send("uci"); err != nil {
+		e.close()
+		return nil, err
+	}
+
+	for {
+		line, err := e.read(uciStartTimeout)
+		if err != nil {
+			e.close()
+			return nil, err
+		}
+		if strings.HasPrefix(line, "id name ") {
+			e.name = strings.TrimSpace(line[len("id name "):])
+		}
+		if line == "uciok" {
+			break
+		}
+	}
+
+	for name, value := range options {
+		if err := e.send("setoption name %s value %s", name, value); err != nil {
+			e.close()
+			return nil, err
+		}
+	}
+
+	if err := e.ready(); err != nil {
+		e.close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *uciEngine) send(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(e.stdin, format+"\n", args...)
+	return err
+}
+
+// read returns the next line of output
+func (e *uciEngine) read(timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case line, ok := <-e.lines:
+		if !ok {
+			return "", fmt.Errorf("%s exited", e.name)
+		}
+		return line, nil
+	case <-timer.C:
+		return "", fmt.Errorf("%s does not respond", e.name)
+	}
+}
+
+func (e *uciEngine) ready() error {
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	for {
+		line, err := e.read(uciStartTimeout)
+		if err != nil {
+			return err
+		}
+		if line == "readyok" {
+			return nil
+		}
+	}
+}
+
+func (e *uciEngine) newGame() error {
+	if err := e.send("ucinewgame"); err != nil {
+		return err
+	}
+	return e.ready()
+}
+
+// search sends the position and the go command and returns the best move
+// in coordinate notation together with the last score reported, relative to
+// the side to move
+func (e *uciEngine) search(fen string, moves []Move, goCommand string, timeout time.Duration) (string, int, error) {
+	position := "position fen " + fen
+	if len(moves) > 0 {
+		position += " moves"
+		for _, move := range moves {
+			position += " " + move.coordinate()
+		}
+	}
+
+	if err := e.send("%s", position); err != nil {
+		return "", 0, err
+	}
+	if err := e.send("%s", goCommand); err != nil {
+		return "", 0, err
+	}
+
+	score := 0
+	deadline := time.Now().Add(timeout)
+	for {
+		line, err := e.read(time.Until(deadline))
+		if err != nil {
+			return "", score, err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "bestmove" {
+			return fields[1], score, nil
+		}
+		if len(fields) > 0 && fields[0] == "info" {
+			if s, ok := uciScore(fields); ok {
+				score = s
+			}
+		}
+	}
+}
+
+// uciScore reads "score cp <x>" or "score mate <n>" of an info line
+func uciScore(fields []string) (int, bool) {
+	for i := 1; i+2 < len(fields); i++ {
+		if fields[i] != "score" {
+			continue
+		}
+		value, err := strconv.Atoi(fields[i+2])
+		if err != nil {
+			return 0, false
+		}
+		switch fields[i+1] {
+		case "cp":
+			return value, true
+		case "mate":
+			// mates are given in moves, the own scores count plies
+			if value < 0 {
+				return -(scoreMate - 2*value), true
+			}
+			return scoreMate + 2*value - 1, true
+		}
+	}
+	return 0, false
+}
+
+// close asks the engine to quit and kills it if it doesn't
+func (e *uciEngine) close() {
+	e.send("quit")
+	e.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- e.cmd.Wait() }()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		e.cmd.Process.Kill()
+		<-done
+	}
+
+	// let the reader finish
+	for range e.lines {
+	}
+}
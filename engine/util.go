@@ -7,16 +7,16 @@ import (
 	"github.com/fatih/color"
 )
 
-func printSearchHead() {
-	if !searchVerbose {
+func (pv *pvSearch) printSearchHead() {
+	if !pv.verbose {
 		return
 	}
 
 	fmt.Printf("ply  score   time   nodes  pv\n")
 }
 
-func printSearchLevel(pv *pvSearch, depth, score int, startTime time.Time) {
-	if !searchVerbose {
+func (pv *pvSearch) printSearchLevel(depth, score int, startTime time.Time) {
+	if !pv.verbose {
 		return
 	}
 
@@ -42,8 +42,8 @@ func printSearchLevel(pv *pvSearch, depth, score int, startTime time.Time) {
 	fmt.Printf("\n")
 }
 
-func printSearchResult(pv *pvSearch, startTime time.Time) {
-	if !searchVerbose {
+func (pv *pvSearch) printSearchResult(startTime time.Time) {
+	if !pv.verbose {
 		return
 	}
 
@@ -58,7 +58,7 @@ func printPerftData(board *Board, expected []PerftData) {
 		return
 	}
 
-	fmt.Printf(color.WhiteString("D   Nodes    Capt.   E.p.   Cast.   Prom.  Checks   Mates   Time\n"))
+	fmt.Print(color.WhiteString("D   Nodes    Capt.   E.p.   Cast.   Prom.  Checks   Mates   Time\n"))
 	for i := 0; i < len(expected); i++ {
 
 		res := perft(i, board)
@@ -88,6 +88,20 @@ func printPerftData(board *Board, expected []PerftData) {
 
 }
 
+// printPerftResult prints the total and, divided, the nodes below each of
+// the root moves
+func printPerftResult(result PerftResult, divide bool) {
+	if divide {
+		for i, move := range result.Moves {
+			fmt.Printf("%s: %d\n", move.coordinate(), result.Divide[i])
+		}
+		fmt.Printf("\n%d moves\n", len(result.Moves))
+	}
+
+	fmt.Printf("perft(%d) = %d in %s secs (%.1fK nodes/sec)\n", result.Depth, result.Nodes,
+		formatDuration(result.Elapsed), result.NPS()/1000)
+}
+
 func formatPerftEntry(actual, expected int64) string {
 
 	diff := actual - expected
@@ -175,8 +189,7 @@ func formatBoard(b *Board) string {
 			s += fmt.Sprintf("\tCasteling: %s", c)
 		}
 		if r == 2 {
-			gen := NewGenerator(b)
-			if gen.CheckSimple() {
+			if b.InCheck() {
 				s += fmt.Sprintf("\tCheck!")
 			}
 		}
@@ -199,6 +212,10 @@ func formatBoard(b *Board) string {
 		str += "Mate! Black wins."
 	case statusStaleMate:
 		str += "Stale mate!"
+	case statusWhiteWins:
+		str += "White wins."
+	case statusBlackWins:
+		str += "Black wins."
 	}
 
 	str += "\n"
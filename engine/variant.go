@@ -0,0 +1,289 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	threeCheckWin = 3 // the checks which win a game of Three-check
+
+	evalBonusHill         = 40  // per step of the king towards the center
+	evalBonusGivenCheck   = 150 // per check given in Three-check, growing with the count
+	evalAntichessPiece    = 100 // a piece less is worth as much as a pawn more in chess
+	evalAntichessMobility = 5   // per move, having options avoids forced captures
+)
+
+// Variant changes the rules of standard chess: which moves are generated,
+// when a game ends and how positions are evaluated. Boards of standard chess
+// have no variant, so the hooks cost nothing in standard games.
+type Variant interface {
+	// Name is the value of the UCI_Variant option
+	Name() string
+	// StartFEN is the start position of the variant
+	StartFEN() string
+
+	rules() variantRules
+	// over tells whether the last move ended the game, the side to move
+	// has no moves then
+	over(b *Board) bool
+	// result returns the status of a game in which the side to move has no
+	// moves, either as the game is over or it is mated or stalemated
+	result(b *Board, inCheck bool) int
+	// evaluate scores the position relative to the side to move
+	evaluate(b *Board) int
+}
+
+// variantRules change the move generation
+type variantRules struct {
+	noCheck        bool // kings are ordinary pieces which may be captured, there is no castling
+	forcedCaptures bool // if a piece can be captured, one has to be
+	kingPromotion  bool // pawns may promote to a king
+	countChecks    bool // the checks given are counted and part of the FEN
+	drops          bool // captured pieces may be dropped by the capturing side
+}
+
+// maxVariants is the room for variants in the Zobrist keys
+const maxVariants = 8
+
+// variants are selected by name, e.g. with the UCI_Variant option
+var variants = []Variant{kingOfTheHill{}, threeCheck{}, antichess{}, crazyhouse{}}
+
+// lookupVariant returns the variant of a name, nil for standard chess
+func lookupVariant(name string) (Variant, error) {
+	name = strings.ToLower(name)
+	if name == "chess" || name == "standard" || name == "" {
+		return nil, nil
+	}
+	for _, v := range variants {
+		if v.Name() == name {
+			return v, nil
+		}
+	}
+	return nil, errors.New("unknown variant " + name)
+}
+
+// variantIndex numbers the variants from 1, standard chess is 0
+func variantIndex(v Variant) uint8 {
+	for i, w := range variants {
+		if v == w {
+			return uint8(i + 1)
+		}
+	}
+	return 0
+}
+
+// variantNames lists standard chess and all variants
+func variantNames() []string {
+	names := []string{"chess"}
+	for _, v := range variants {
+		names = append(names, v.Name())
+	}
+	return names
+}
+
+// NewVariantBoard creates a board of a variant from a FEN, an empty FEN
+// selects the start position of the variant
+func NewVariantBoard(name, fen string) (*Board, error) {
+	v, err := lookupVariant(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if fen == "" {
+		fen = defaultFEN
+		if v != nil {
+			fen = v.StartFEN()
+		}
+	}
+
+	b, err := parseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	b.setVariant(v)
+	if v != nil && v.rules().drops {
+		if err := checkPocketMaterial(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// setVariant changes the rules of the board, without check there is no
+// castling, only Three-check keeps the counted checks and only Crazyhouse
+// the pockets
+func (b *Board) setVariant(v Variant) {
+	b.variant = v
+
+	if v != nil && v.rules().noCheck {
+		b.whiteCastle, b.blackCastle = castleNone, castleNone
+	}
+	if v == nil || !v.rules().countChecks {
+		b.checks = [2]int8{}
+	}
+	if v == nil || !v.rules().drops {
+		b.pockets, b.promoted = [2][pocketPieces]int8{}, 0
+	}
+
+	b.currentHash = b.generateHash()
+}
+
+// variantName returns the name of the board's rules
+func (b *Board) variantName() string {
+	if b.variant == nil {
+		return "chess"
+	}
+	return b.variant.Name()
+}
+
+// standardResult is the status of a mated or stalemated side to move
+func standardResult(b *Board, inCheck bool) int {
+	switch {
+	case inCheck && b.sideToMove == White:
+		return statusBlackMates
+	case inCheck:
+		return statusWhiteMates
+	}
+	return statusStaleMate
+}
+
+// winner returns the status of a win of the given color
+func winner(color int8) int {
+	if color == White {
+		return statusWhiteWins
+	}
+	return statusBlackWins
+}
+
+// statusScore converts the status of a finished game into a score relative
+// to the side to move, like the mate scores of the search
+func statusScore(b *Board, status int) int {
+	switch status {
+	case statusWhiteMates, statusWhiteWins:
+		if b.sideToMove == White {
+			return scoreMate + b.ply
+		}
+		return -(scoreMate + b.ply)
+	case statusBlackMates, statusBlackWins:
+		if b.sideToMove == Black {
+			return scoreMate + b.ply
+		}
+		return -(scoreMate + b.ply)
+	}
+	return scoreDraw
+}
+
+// kingOfTheHill is won by bringing the king to one of the four center
+// squares, besides the usual checkmate
+type kingOfTheHill struct{}
+
+func (kingOfTheHill) Name() string        { return "kingofthehill" }
+func (kingOfTheHill) StartFEN() string    { return defaultFEN }
+func (kingOfTheHill) rules() variantRules { return variantRules{} }
+
+func (kingOfTheHill) over(b *Board) bool {
+	return onHill(b.kingSquare(opponent(b.sideToMove)))
+}
+
+func (v kingOfTheHill) result(b *Board, inCheck bool) int {
+	if v.over(b) {
+		return winner(opponent(b.sideToMove))
+	}
+	return standardResult(b, inCheck)
+}
+
+// evaluate adds a bonus for the king's closeness to the center, which
+// counts more the less material is left to attack it
+func (kingOfTheHill) evaluate(b *Board) int {
+	score := evaluateStandard(b)
+	for _, color := range [2]int8{White, Black} {
+		bonus := evalBonusHill * (3 - centerDistance(b.kingSquare(color)))
+		if b.onlyPawns(opponent(color)) {
+			bonus *= 2
+		}
+		score += int(color*b.sideToMove) * bonus
+	}
+	return score
+}
+
+func onHill(sq Square) bool {
+	return centerDistance(sq) == 0
+}
+
+// centerDistance is 0 on the four center squares and 3 on the edge
+func centerDistance(sq Square) int {
+	distance := func(x int8) int {
+		if x < 4 {
+			return int(3 - x)
+		}
+		return int(x - 4)
+	}
+	f, r := distance(file(int8(sq))), distance(rank(int8(sq)))
+	if f > r {
+		return f
+	}
+	return r
+}
+
+// threeCheck is won by giving the third check, besides the usual
+// checkmate
+type threeCheck struct{}
+
+func (threeCheck) Name() string { return "3check" }
+func (threeCheck) StartFEN() string {
+	return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1"
+}
+func (threeCheck) rules() variantRules { return variantRules{countChecks: true} }
+
+func (threeCheck) over(b *Board) bool {
+	return b.checks[colorIndex(opponent(b.sideToMove))] >= threeCheckWin
+}
+
+func (v threeCheck) result(b *Board, inCheck bool) int {
+	if v.over(b) {
+		return winner(opponent(b.sideToMove))
+	}
+	return standardResult(b, inCheck)
+}
+
+// evaluate adds a bonus for the checks given, the last one before the win
+// is worth most
+func (threeCheck) evaluate(b *Board) int {
+	bonus := [threeCheckWin + 1]int{0, evalBonusGivenCheck, 3 * evalBonusGivenCheck, 9 * evalBonusGivenCheck}
+	us, them := colorIndex(b.sideToMove), colorIndex(opponent(b.sideToMove))
+	return evaluateStandard(b) + bonus[b.checks[us]] - bonus[b.checks[them]]
+}
+
+// antichess is won by losing all pieces or by being stalemated. Captures
+// are compulsory and kings are ordinary pieces.
+type antichess struct{}
+
+func (antichess) Name() string     { return "antichess" }
+func (antichess) StartFEN() string { return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1" }
+
+func (antichess) rules() variantRules {
+	return variantRules{noCheck: true, forcedCaptures: true, kingPromotion: true}
+}
+
+func (antichess) over(b *Board) bool { return false }
+
+func (antichess) result(b *Board, inCheck bool) int {
+	return winner(b.sideToMove)
+}
+
+// evaluate counts the pieces, fewer is better, and the moves of the side to
+// move
+func (antichess) evaluate(b *Board) int {
+	score := 0
+	for rank := int8(0); rank < size; rank++ {
+		for file := int8(0); file < size; file++ {
+			if piece := b.data[square(rank, file)]; piece != Empty {
+				score -= int(pieceColor(piece)*b.sideToMove) * evalAntichessPiece
+			}
+		}
+	}
+
+	var buffer MoveBuffer
+	return score + evalAntichessMobility*len(NewGenerator(b).GenerateMovesInto(&buffer))
+}
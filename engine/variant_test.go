@@ -0,0 +1,176 @@
+package engine
+
+import "testing"
+
+func TestLookupVariant(t *testing.T) {
+	for _, name := range []string{"chess", "Standard", ""} {
+		if v, err := lookupVariant(name); v != nil || err != nil {
+			t.Errorf("Expected standard chess for %q but got %v (%v)\n", name, v, err)
+		}
+	}
+	for _, name := range []string{"kingofthehill", "3check", "Antichess"} {
+		if v, err := lookupVariant(name); v == nil || err != nil {
+			t.Errorf("Expected a variant for %q but got %v\n", name, err)
+		}
+	}
+	if _, err := lookupVariant("atomic"); err == nil {
+		t.Errorf("Expected an error for an unknown variant\n")
+	}
+}
+
+func TestVariantFEN(t *testing.T) {
+	for _, c := range []struct {
+		variant, fen, expected string
+	}{
+		{"3check", "", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1"},
+		{"3check", "4k3/8/8/8/8/8/8/4K3 w - - 2+1 0 1", "4k3/8/8/8/8/8/8/4K3 w - - 2+1 0 1"},
+		// the checks given at the end
+		{"3check", "4k3/8/8/8/8/8/8/4K3 w - - 0 1 +1+2", "4k3/8/8/8/8/8/8/4K3 w - - 2+1 0 1"},
+		// the counts only belong to Three-check
+		{"chess", "4k3/8/8/8/8/8/8/4K3 w - - 2+1 0 1", "4k3/8/8/8/8/8/8/4K3 w - - 0 1"},
+		// there is no castling in Antichess
+		{"antichess", defaultFEN, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1"},
+	} {
+		b, err := NewVariantBoard(c.variant, c.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := generateFEN(b); actual != c.expected {
+			t.Errorf("Expected %s but got %s\n", c.expected, actual)
+		}
+		if b.currentHash != b.generateHash() {
+			t.Errorf("Expected the hash to cover the variant state of %s\n", c.fen)
+		}
+	}
+
+	for _, fen := range []string{"4k3/8/8/8/8/8/8/4K3 w - - 4+3 0 1", "4k3/8/8/8/8/8/8/4K3 w - - 1+x 0 1", "4k3/8/8/8/8/8/8/4K3 w - - 1+1+1 0 1"} {
+		if _, err := NewVariantBoard("3check", fen); err == nil {
+			t.Errorf("Expected an error for %s\n", fen)
+		}
+	}
+}
+
+func TestVariantHash(t *testing.T) {
+	if len(variants) > maxVariants {
+		t.Fatalf("Expected at most %d variants but got %d\n", maxVariants, len(variants))
+	}
+
+	// a table shared by several variants tells the same position apart
+	hashes := map[int64]string{}
+	for _, name := range variantNames() {
+		b, _ := NewVariantBoard(name, "4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+		if other, ok := hashes[b.currentHash]; ok {
+			t.Errorf("Expected different hashes for %s and %s\n", name, other)
+		}
+		hashes[b.currentHash] = name
+
+		playMovesOn(t, b, "Kd2")
+		if b.currentHash != b.generateHash() {
+			t.Errorf("Expected the variant to stay in the hash of %s\n", name)
+		}
+	}
+}
+
+func TestThreeCheckCounting(t *testing.T) {
+	b, _ := NewVariantBoard("3check", "4k3/8/8/8/8/8/8/4K2R w K - 1+3 0 1")
+	fen, hash := generateFEN(b), b.currentHash
+
+	m, _ := parseSAN(b, "Rh8+")
+	b.MakeMove(m)
+	if b.checks != [2]int8{3, 0} || b.currentHash != b.generateHash() {
+		t.Errorf("Expected the third check to be counted but got %v\n", b.checks)
+	}
+	if status := b.updateStatus(); status != statusWhiteWins {
+		t.Errorf("Expected white to win by the third check but got %d\n", status)
+	}
+
+	b.UndoMove()
+	if actual := generateFEN(b); actual != fen || b.currentHash != hash {
+		t.Errorf("Expected %s after undo but got %s\n", fen, actual)
+	}
+
+	// the same position without counted checks hashes differently
+	if standard, _ := NewVariantBoard("3check", "4k3/8/8/8/8/8/8/4K2R w K - 3+3 0 1"); standard.currentHash == hash {
+		t.Errorf("Expected the checks given to change the hash\n")
+	}
+}
+
+func TestVariantStatus(t *testing.T) {
+	for _, c := range []struct {
+		variant, fen, move string
+		expected           int
+	}{
+		{"kingofthehill", "7k/8/8/8/8/2K5/8/8 w - - 0 1", "Kd4", statusWhiteWins},
+		{"kingofthehill", "7k/8/8/8/8/2K5/8/8 w - - 0 1", "Kc4", statusNormal},
+		// a lone king and a bishop can still win
+		{"kingofthehill", "7k/8/8/8/8/2K5/8/1B6 w - - 0 1", "Kb3", statusNormal},
+		{"chess", "7k/8/8/8/8/2K5/8/1B6 w - - 0 1", "Kb3", statusDraw},
+		// the last piece is lost
+		{"antichess", "8/8/8/8/8/8/1p6/B7 b - - 0 1", "bxa1=Q", statusWhiteWins},
+		// stalemated
+		{"antichess", "8/8/8/8/8/p7/P7/8 w - - 0 1", "", statusWhiteWins},
+		{"antichess", "8/8/8/8/8/p7/P7/8 b - - 0 1", "", statusBlackWins},
+	} {
+		b, err := NewVariantBoard(c.variant, c.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.move != "" {
+			m, err := parseSAN(b, c.move)
+			if err != nil {
+				t.Fatalf("Expected %s to be legal in %s but got %v\n", c.move, c.fen, err)
+			}
+			b.MakeMove(m)
+		}
+		if status := b.updateStatus(); status != c.expected {
+			t.Errorf("Expected status %d after %s in %s but got %d\n", c.expected, c.move, c.fen, status)
+		}
+	}
+}
+
+func TestAntichessMoves(t *testing.T) {
+	for _, c := range []struct {
+		fen   string
+		moves int
+	}{
+		// the king is captured like any other piece
+		{"8/8/8/8/8/8/3k4/3Q4 w - - 0 1", 1},
+		// pieces are not pinned, kings may move into attacks
+		{"4r3/8/8/8/8/8/4B3/4K3 w - - 0 1", 13},
+		// promotions to a king
+		{"8/P7/8/8/8/8/8/7k w - - 0 1", 5},
+	} {
+		b, _ := NewVariantBoard("antichess", c.fen)
+		if moves := NewGenerator(b).GenerateMoves(); len(moves) != c.moves {
+			t.Errorf("Expected %d moves in %s but got %d\n", c.moves, c.fen, len(moves))
+		}
+	}
+
+	b, _ := NewVariantBoard("antichess", "8/P7/8/8/8/8/8/7k w - - 0 1")
+	if m, err := parseSAN(b, "a8=K"); err != nil || m.Promoted != WhiteKing {
+		t.Errorf("Expected a promotion to a king but got %v (%v)\n", m, err)
+	}
+	if b.InCheck() {
+		t.Errorf("Expected no check in Antichess\n")
+	}
+}
+
+func TestVariantSearch(t *testing.T) {
+	for _, c := range []struct {
+		variant, fen, expected string
+	}{
+		{"kingofthehill", "7k/8/8/8/8/2K5/8/8 w - - 0 1", "c3d4"},
+		{"3check", "4k3/8/8/8/8/8/8/4K2R w K - 1+3 0 1", "h1h8"},
+		// the only capture
+		{"antichess", "rnbqkbnr/p1pppppp/8/1p6/8/4P3/PPPP1PPP/RNBQKBNR w - - 0 2", "f1b5"},
+	} {
+		b, _ := NewVariantBoard(c.variant, c.fen)
+		result := SearchWithLimits(b, SearchLimits{Depth: 4})
+		if result.Move.coordinate() != c.expected {
+			t.Errorf("Expected %s in %s but got %s\n", c.expected, c.fen, result.Move.coordinate())
+		}
+		if c.variant != "antichess" && result.Score < scoreMate {
+			t.Errorf("Expected a winning score but got %d\n", result.Score)
+		}
+	}
+}
@@ -1,7 +1,242 @@
 package main
 
-import "github.com/fdomig/gochess/engine"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fdomig/gochess/engine"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "tune":
+			tune(os.Args[2:])
+			return
+		case "selfplay":
+			selfPlay(os.Args[2:])
+			return
+		case "testsuite":
+			testSuite(os.Args[2:])
+			return
+		case "bench":
+			bench(os.Args[2:])
+			return
+		case "match":
+			match(os.Args[2:])
+			return
+		case "uci":
+			engine.UCI(os.Stdin, os.Stdout)
+			return
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "play":
+			play(os.Args[2:])
+			return
+		case "db":
+			database(os.Args[2:])
+			return
+		}
+	}
+
 	engine.NewGame().Run()
 }
+
+func tune(args []string) {
+	options := engine.TuneOptions{}
+
+	flags := flag.NewFlagSet("tune", flag.ExitOnError)
+	flags.StringVar(&options.DataFile, "data", "", "file with quiet positions and game results")
+	flags.StringVar(&options.OutFile, "out", "params.txt", "parameter file to write")
+	flags.BoolVar(&options.Quiescence, "qsearch", false, "score positions with a quiescence search")
+	flags.IntVar(&options.Threads, "threads", 0, "number of threads (default: number of cores)")
+	flags.IntVar(&options.Iterations, "iterations", 0, "maximum number of iterations (default: unlimited)")
+	flags.BoolVar(&options.Resume, "resume", false, "resume a previous run from the parameter file")
+	params := flags.String("params", "", "parameter file to start from")
+	flags.Parse(args)
+
+	if options.DataFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *params != "" {
+		exitOnError(engine.LoadParams(*params))
+	}
+
+	exitOnError(engine.Tune(options))
+}
+
+func selfPlay(args []string) {
+	options := engine.SelfPlayOptions{}
+
+	flags := flag.NewFlagSet("selfplay", flag.ExitOnError)
+	flags.StringVar(&options.OutFile, "out", "selfplay.epd", "file to write the positions to")
+	flags.IntVar(&options.Games, "games", 1000, "number of games")
+	flags.IntVar(&options.Threads, "threads", 0, "number of threads (default: number of cores)")
+	flags.IntVar(&options.Depth, "depth", 6, "search depth per move (0: unlimited)")
+	flags.Int64Var(&options.Nodes, "nodes", 0, "search nodes per move (0: unlimited)")
+	flags.IntVar(&options.RandomPlies, "random", 8, "random moves at the start of each game")
+	flags.Int64Var(&options.Seed, "seed", 1, "random seed")
+	flags.BoolVar(&options.Resume, "resume", false, "continue a previous run")
+	params := flags.String("params", "", "parameter file to play with")
+	flags.Parse(args)
+
+	if options.Depth == 0 && options.Nodes == 0 {
+		exitOnError(errors.New("either -depth or -nodes is required"))
+	}
+
+	if *params != "" {
+		exitOnError(engine.LoadParams(*params))
+	}
+
+	exitOnError(engine.SelfPlay(options))
+}
+
+func testSuite(args []string) {
+	options := engine.TestSuiteOptions{}
+
+	flags := flag.NewFlagSet("testsuite", flag.ExitOnError)
+	flags.StringVar(&options.File, "epd", "", "EPD file with bm, am, dm or c0 operations")
+	flags.StringVar(&options.OutFile, "out", "", "file to append the summary to")
+	flags.StringVar(&options.Label, "label", "", "name of the run in the summary")
+	flags.DurationVar(&options.Time, "time", time.Second, "search time per position (0: unlimited)")
+	flags.IntVar(&options.Depth, "depth", 0, "search depth per position (0: unlimited)")
+	flags.Int64Var(&options.Nodes, "nodes", 0, "search nodes per position (0: unlimited)")
+	flags.IntVar(&options.Threads, "threads", 0, "positions searched in parallel (default: number of cores)")
+	params := flags.String("params", "", "parameter file to search with")
+	flags.Parse(args)
+
+	if options.File == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *params != "" {
+		exitOnError(engine.LoadParams(*params))
+	}
+
+	exitOnError(engine.TestSuite(options))
+}
+
+// bench takes the optional arguments depth, threads and hash size in MB
+func bench(args []string) {
+	values := []int{0, 1, 0}
+	if len(args) > len(values) {
+		exitOnError(errors.New("usage: gochess bench [depth] [threads] [hash]"))
+	}
+	for i, arg := range args {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v < 0 {
+			exitOnError(fmt.Errorf("invalid argument %q", arg))
+		}
+		values[i] = v
+	}
+
+	engine.PrintBench(engine.BenchOptions{Depth: values[0], Threads: values[1], Hash: values[2]})
+}
+
+func match(args []string) {
+	options := engine.MatchOptions{}
+
+	flags := flag.NewFlagSet("match", flag.ExitOnError)
+	flags.StringVar(&options.Engines[0], "engine1", "gochess", "first engine: gochess, gochess:<params file> or uci:<command>")
+	flags.StringVar(&options.Engines[1], "engine2", "gochess", "second engine")
+	flags.StringVar(&options.Openings, "openings", "", "EPD or FEN file with openings (default: start position)")
+	flags.IntVar(&options.Rounds, "rounds", 100, "number of openings played with both colors")
+	flags.IntVar(&options.Concurrency, "concurrency", 1, "games played in parallel")
+	flags.StringVar(&options.TimeControl, "tc", "10+0.1", "time control in seconds, base+increment")
+	flags.Int64Var(&options.Nodes, "nodes", 0, "search nodes per move instead of a time control")
+	flags.IntVar(&options.Hash, "hash", 16, "hash size of UCI engines in MB")
+	maxMoves := flags.Int("maxmoves", 200, "games are drawn after this many moves (0: unlimited)")
+	flags.IntVar(&options.ResignScore, "resignscore", 1000, "score to adjudicate a loss at")
+	flags.IntVar(&options.ResignMoves, "resignmoves", 4, "moves of both engines beyond the resign score for a loss (0: disabled)")
+	flags.IntVar(&options.DrawScore, "drawscore", 10, "score to adjudicate a draw at")
+	flags.IntVar(&options.DrawMoves, "drawmoves", 8, "moves of both engines within the draw score for a draw (0: disabled)")
+	flags.IntVar(&options.DrawAfter, "drawafter", 40, "first move number a draw is adjudicated at")
+	sprt := flags.Bool("sprt", false, "stop once the SPRT has a verdict")
+	test := engine.SPRT{}
+	flags.Float64Var(&test.Elo0, "elo0", 0, "SPRT elo of H0")
+	flags.Float64Var(&test.Elo1, "elo1", 5, "SPRT elo of H1")
+	flags.Float64Var(&test.Alpha, "alpha", 0.05, "SPRT probability of a false H1")
+	flags.Float64Var(&test.Beta, "beta", 0.05, "SPRT probability of a false H0")
+	flags.StringVar(&options.PGN, "pgn", "", "file to write the games to")
+	flags.Parse(args)
+
+	options.MaxPlies = 2 * *maxMoves
+	if *sprt {
+		options.SPRT = &test
+	}
+
+	_, err := engine.Match(options)
+	exitOnError(err)
+}
+
+func serve(args []string) {
+	options := engine.ServerOptions{}
+
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&options.Addr, "addr", ":8080", "address to listen on")
+	flags.IntVar(&options.Workers, "workers", 0, "concurrent searches (default: number of cores)")
+	flags.DurationVar(&options.MaxTime, "maxtime", 10*time.Second, "longest search of a request")
+	params := flags.String("params", "", "parameter file to search with")
+	flags.Parse(args)
+
+	if *params != "" {
+		exitOnError(engine.LoadParams(*params))
+	}
+
+	exitOnError(engine.Serve(options))
+}
+
+func play(args []string) {
+	options := engine.PlayOptions{}
+
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	flags.StringVar(&options.Addr, "addr", ":8080", "address to listen on")
+	flags.IntVar(&options.MaxGames, "games", 100, "games kept in memory")
+	flags.IntVar(&options.Workers, "workers", 0, "concurrent engine searches (default: number of cores)")
+	flags.DurationVar(&options.IdleTimeout, "idle", 30*time.Minute, "time after which a game nobody watches is dropped")
+	params := flags.String("params", "", "parameter file to play with")
+	flags.Parse(args)
+
+	if *params != "" {
+		exitOnError(engine.LoadParams(*params))
+	}
+
+	exitOnError(engine.Play(options))
+}
+
+// database runs a command on a game database: import <files>, games,
+// explore, material <signature> or pgn <id>
+func database(args []string) {
+	options := engine.DatabaseOptions{}
+
+	flags := flag.NewFlagSet("db", flag.ExitOnError)
+	flags.StringVar(&options.Dir, "dir", "games.db", "directory of the database")
+	flags.StringVar(&options.Variant, "variant", "", "variant of the position")
+	flags.StringVar(&options.FEN, "fen", "", "position of games and explore (default: start position)")
+	moves := flags.String("moves", "", "moves played from the position, separated by spaces")
+	flags.IntVar(&options.Limit, "limit", 50, "most games listed (0: all)")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		exitOnError(errors.New("usage: gochess db [flags] import <files> | games | explore | material <signature> | pgn <id>"))
+	}
+	options.Moves = strings.Fields(*moves)
+
+	exitOnError(engine.RunDatabase(options, flags.Arg(0), flags.Args()[1:]))
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gochess: %v\n", err)
+		os.Exit(1)
+	}
+}